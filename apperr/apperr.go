@@ -0,0 +1,170 @@
+// Package apperr defines the application's typed errors. Each error has a kind,
+// which decides the HTTP status, and a stable machine-readable code that clients
+// can rely on. Errors are rendered as RFC 7807 problem details.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+
+	"go-clickhouse-example/models"
+)
+
+// Kind classifies errors by the HTTP status they map to
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindTimeout
+	KindTooManyRequests
+)
+
+// Status returns the HTTP status for the kind
+func (k Kind) Status() int {
+	switch k {
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindValidation:
+		return http.StatusUnprocessableEntity
+	case KindTimeout:
+		return http.StatusGatewayTimeout
+	case KindTooManyRequests:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Codes of errors raised by the HTTP layer. Services declare their own codes
+// alongside their sentinel errors.
+const (
+	CodeInternal         = "internal_error"
+	CodeInvalidInput     = "invalid_input"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+)
+
+// Error is an error with a kind, a stable code and a message safe to show to clients
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Fields lists the invalid fields of a KindValidation error
+	Fields []models.FieldError
+
+	// cause is the underlying error of an internal error, it is logged but never shown
+	cause error
+	// parent is the sentinel error this error was derived from with WithMessage
+	parent *Error
+}
+
+// New creates an error of the given kind
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Invalid creates a 400 error for a malformed request
+func Invalid(code, message string) *Error {
+	return New(KindInvalid, code, message)
+}
+
+// Unauthorized creates a 401 error for missing or invalid credentials
+func Unauthorized(code, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+// Forbidden creates a 403 error for an authenticated user lacking permission
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+// NotFound creates a 404 error
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+// Conflict creates a 409 error for a request conflicting with the current state
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+// Timeout creates a 504 error for a request that took longer than allowed
+func Timeout(code, message string) *Error {
+	return New(KindTimeout, code, message)
+}
+
+// TooManyRequests creates a 429 error for a client that made too many attempts
+func TooManyRequests(code, message string) *Error {
+	return New(KindTooManyRequests, code, message)
+}
+
+// Validation creates a 422 error listing the invalid fields
+func Validation(fields ...models.FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidationFailed, Message: "Validation failed", Fields: fields}
+}
+
+// Internal creates a 500 error. The message is shown to the client, cause is only logged.
+func Internal(message string, cause error) *Error {
+	return &Error{Kind: KindInternal, Code: CodeInternal, Message: message, cause: cause}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	if e.cause != nil {
+		return e.cause
+	}
+	if e.parent != nil {
+		return e.parent
+	}
+	return nil
+}
+
+// Status returns the HTTP status of the error
+func (e *Error) Status() int {
+	return e.Kind.Status()
+}
+
+// WithMessage returns a copy of the error with a more specific message.
+// errors.Is still matches the original error.
+func (e *Error) WithMessage(message string) *Error {
+	derived := *e
+	derived.Message = message
+	derived.cause = nil
+	derived.parent = e
+	return &derived
+}
+
+// Wrap returns err unchanged if it is already typed, and otherwise an internal error
+// with the given message. It returns nil if err is nil.
+func Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return Internal(message, err)
+}
@@ -0,0 +1,69 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go-clickhouse-example/models"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want int
+	}{
+		{Invalid("bad", "bad"), http.StatusBadRequest},
+		{Unauthorized("login", "login"), http.StatusUnauthorized},
+		{Forbidden("admin", "admin"), http.StatusForbidden},
+		{NotFound("missing", "missing"), http.StatusNotFound},
+		{Conflict("taken", "taken"), http.StatusConflict},
+		{Validation(models.FieldError{Field: "name"}), http.StatusUnprocessableEntity},
+		{Timeout("slow", "slow"), http.StatusGatewayTimeout},
+		{TooManyRequests("again", "again"), http.StatusTooManyRequests},
+		{Internal("broken", errors.New("cause")), http.StatusInternalServerError},
+		{New(Kind(99), "unknown", "unknown"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Code, func(t *testing.T) {
+			if got := tt.err.Status(); got != tt.want {
+				t.Errorf("Status() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapAndFrom(t *testing.T) {
+	notFound := NotFound("item_not_found", "item not found")
+	cause := errors.New("connection refused")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    string
+		wantMessage string
+		wantIs      error
+	}{
+		{"typed error is kept", notFound, "item_not_found", "item not found", notFound},
+		{"wrapped typed error is kept", fmt.Errorf("lookup: %w", notFound), "item_not_found", "item not found", notFound},
+		{"derived error matches its sentinel", notFound.WithMessage("item 42 not found"), "item_not_found", "item 42 not found", notFound},
+		{"plain error becomes internal", cause, CodeInternal, "Failed to fetch item", cause},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := Wrap(tt.err, "Failed to fetch item")
+			appErr := From(wrapped)
+			if appErr.Code != tt.wantCode || appErr.Message != tt.wantMessage {
+				t.Errorf("From(Wrap()) = %s %q, want %s %q", appErr.Code, appErr.Message, tt.wantCode, tt.wantMessage)
+			}
+			if !errors.Is(wrapped, tt.wantIs) {
+				t.Errorf("errors.Is(Wrap(), %v) = false, want true", tt.wantIs)
+			}
+		})
+	}
+
+	if err := Wrap(nil, "unused"); err != nil {
+		t.Errorf("Wrap(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,6 @@
+package apperr
+
+import "go-clickhouse-example/logging"
+
+// logger writes the package's logs, at the level configured for "apperr"
+var logger = logging.For("apperr")
@@ -0,0 +1,77 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-clickhouse-example/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem details responses (RFC 7807)
+const ContentType = "application/problem+json"
+
+// TraceIDKey is the gin context key holding the ID of the current request's trace
+const TraceIDKey = "trace_id"
+
+// Problem is the body of every error response. Type is always "about:blank", so
+// clients should switch on Code, which is stable.
+type Problem struct {
+	Type     string              `json:"type" example:"about:blank"`
+	Title    string              `json:"title" example:"Not Found"`
+	Status   int                 `json:"status" example:"404"`
+	Detail   string              `json:"detail,omitempty" example:"item not found"`
+	Instance string              `json:"instance,omitempty" example:"/items/42"`
+	Code     string              `json:"code" example:"item_not_found"`
+	TraceID  string              `json:"trace_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	Errors   []models.FieldError `json:"errors,omitempty"`
+}
+
+// From returns err as an *Error. Errors that are not typed become internal errors,
+// so their message never reaches the client.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal("Internal server error", err)
+}
+
+// Write aborts the request with the problem details of err
+func Write(c *gin.Context, err error) {
+	appErr := From(err)
+	traceID := c.GetString(TraceIDKey)
+	if appErr.Kind == KindInternal {
+		logger.ErrorContext(c.Request.Context(), "Internal error", "method", c.Request.Method, "path", c.Request.URL.Path, "trace_id", traceID, "error", err)
+	}
+	_ = c.Error(err)
+
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(appErr.Status()),
+		Status:   appErr.Status(),
+		Detail:   appErr.Message,
+		Instance: c.Request.URL.Path,
+		Code:     appErr.Code,
+		TraceID:  traceID,
+		Errors:   appErr.Fields,
+	}
+	body, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		body = []byte(`{"type":"about:blank","status":500,"code":"internal_error"}`)
+	}
+	c.Abort()
+	c.Data(problem.Status, ContentType, body)
+}
+
+// Handler adapts a handler that returns an error into a gin handler, writing the
+// problem details of the returned error
+func Handler(fn func(c *gin.Context) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := fn(c); err != nil {
+			Write(c, err)
+		}
+	}
+}
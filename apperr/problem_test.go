@@ -0,0 +1,66 @@
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go-clickhouse-example/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWrite(t *testing.T) {
+	field := models.FieldError{Field: "price", Code: "too_small", Message: "price must be at least 0"}
+
+	tests := []struct {
+		name    string
+		err     error
+		traceID string
+		want    Problem
+	}{
+		{"not found", NotFound("item_not_found", "item not found"), "",
+			Problem{Type: "about:blank", Title: "Not Found", Status: 404, Detail: "item not found", Instance: "/items/42", Code: "item_not_found"}},
+		{"validation lists the fields", Validation(field), "",
+			Problem{Type: "about:blank", Title: "Unprocessable Entity", Status: 422, Detail: "Validation failed", Instance: "/items/42",
+				Code: CodeValidationFailed, Errors: []models.FieldError{field}}},
+		{"internal hides the cause", Internal("Failed to fetch item", errors.New("dial tcp 10.0.0.5:9000")), "abc123",
+			Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Detail: "Failed to fetch item", Instance: "/items/42",
+				Code: CodeInternal, TraceID: "abc123"}},
+		{"untyped error is internal", errors.New("secret DSN"), "",
+			Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Detail: "Internal server error", Instance: "/items/42",
+				Code: CodeInternal}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/items/42", nil)
+			if tt.traceID != "" {
+				c.Set(TraceIDKey, tt.traceID)
+			}
+
+			Write(c, tt.err)
+
+			if !c.IsAborted() {
+				t.Error("Write() did not abort the request")
+			}
+			if recorder.Code != tt.want.Status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want.Status)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != ContentType {
+				t.Errorf("Content-Type = %q, want %q", got, ContentType)
+			}
+			var got Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding %s: %v", recorder.Body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("body = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -10,15 +13,152 @@ type Config struct {
 	NATSURL     string
 	StreamName  string
 	SubjectName string
+
+	// ClickHouseNative is the DSN of ClickHouse's native protocol, used for batch inserts
+	ClickHouseNative string
+
+	// DefaultCurrency is the ISO 4217 currency of items created without one
+	DefaultCurrency string
+
+	// MFAIssuer is the issuer name shown by authenticator apps
+	MFAIssuer string
+	// MFARequiredRoles lists roles that must complete MFA before using write routes
+	MFARequiredRoles []string
+
+	// ImpersonationTTL is the lifetime of tokens issued to admins impersonating a user
+	ImpersonationTTL time.Duration
+
+	// ItemTrashRetention is how long deleted items stay in the trash before being
+	// purged, checked every ItemTrashPurgeInterval
+	ItemTrashRetention     time.Duration
+	ItemTrashPurgeInterval time.Duration
+
+	// ImportDir holds uploaded import files until they are processed by one of
+	// ImportWorkers workers. Uploads larger than ImportMaxBytes are rejected.
+	ImportDir      string
+	ImportWorkers  int
+	ImportMaxBytes int64
+
+	// AnalyticsQueryTimeout bounds each analytics query, whose results are cached
+	// for AnalyticsCacheTTL
+	AnalyticsQueryTimeout time.Duration
+	AnalyticsCacheTTL     time.Duration
+
+	// FrontendURL is used to build links in emails sent to users
+	FrontendURL string
+	// PasswordResetTTL and EmailVerificationTTL bound the lifetime of emailed tokens
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+
+	// MailTransport selects the Mailer implementation: smtp, file or memory
+	MailTransport string
+	MailFrom      string
+	MailDropDir   string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+
+	// LogLevel is the level of the logs, debug, info, warn or error. LogLevels
+	// overrides it for some packages, as "package=level" entries.
+	LogLevel  string
+	LogLevels []string
+
+	// Session configures the optional cookie-based session mode
+	Session SessionConfig
+
+	// Tracing configures the export of OpenTelemetry traces
+	Tracing TracingConfig
+}
+
+// SessionConfig controls how browser clients receive and present access tokens.
+// With CookieMode enabled /login stores the token in an HttpOnly cookie and
+// state-changing requests must echo the CSRF cookie in the CSRF header.
+type SessionConfig struct {
+	CookieMode     bool
+	CookieName     string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string
+	CookieMaxAge   time.Duration
+	CSRFCookieName string
+	CSRFHeaderName string
+	// CacheTTL is how long session state is cached before being re-read from ClickHouse
+	CacheTTL time.Duration
+}
+
+// TracingConfig selects where traces go. Exporter is none, otlp, stdout or file:
+// otlp sends spans over OTLP/HTTP to OTLPEndpoint, or to the endpoint set by the
+// standard OTEL_EXPORTER_OTLP_* variables when empty, stdout and file write them
+// as JSON, which needs no collector. SampleRatio is the share of new traces
+// recorded; requests continuing a trace follow the caller's decision.
+type TracingConfig struct {
+	Exporter     string
+	ServiceName  string
+	OTLPEndpoint string
+	OTLPInsecure bool
+	File         string
+	SampleRatio  float64
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		ServerPort:  getEnv("SERVER_PORT", ":8080"),
-		ClickHouse:  getEnv("CLICKHOUSE_URL", "http://localhost:8123"),
-		NATSURL:     getEnv("NATS_URL", "nats://localhost:4222"),
-		StreamName:  getEnv("NATS_STREAM", "items_stream"),
-		SubjectName: getEnv("NATS_SUBJECT", "items"),
+		ServerPort:       getEnv("SERVER_PORT", ":8080"),
+		ClickHouse:       getEnv("CLICKHOUSE_URL", "http://localhost:8123"),
+		ClickHouseNative: getEnv("CLICKHOUSE_NATIVE_URL", "clickhouse://localhost:9000"),
+		NATSURL:          getEnv("NATS_URL", "nats://localhost:4222"),
+		StreamName:       getEnv("NATS_STREAM", "items_stream"),
+		SubjectName:      getEnv("NATS_SUBJECT", "items"),
+		DefaultCurrency:  getEnv("DEFAULT_CURRENCY", "USD"),
+		MFAIssuer:        getEnv("MFA_ISSUER", "go-clickhouse-example"),
+		MFARequiredRoles: getEnvList("MFA_REQUIRED_ROLES", "admin"),
+		ImpersonationTTL: getEnvDuration("IMPERSONATION_TTL", 15*time.Minute),
+
+		ItemTrashRetention:     getEnvDuration("ITEM_TRASH_RETENTION", 30*24*time.Hour),
+		ItemTrashPurgeInterval: getEnvDuration("ITEM_TRASH_PURGE_INTERVAL", time.Hour),
+
+		ImportDir:      getEnv("IMPORT_DIR", "./imports"),
+		ImportWorkers:  getEnvInt("IMPORT_WORKERS", 2),
+		ImportMaxBytes: int64(getEnvInt("IMPORT_MAX_BYTES", 100<<20)),
+
+		AnalyticsQueryTimeout: getEnvDuration("ANALYTICS_QUERY_TIMEOUT", 10*time.Second),
+		AnalyticsCacheTTL:     getEnvDuration("ANALYTICS_CACHE_TTL", time.Minute),
+
+		FrontendURL:          getEnv("FRONTEND_URL", "http://localhost:3000"),
+		PasswordResetTTL:     getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL: getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+
+		MailTransport: getEnv("MAIL_TRANSPORT", "file"),
+		MailFrom:      getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailDropDir:   getEnv("MAIL_DROP_DIR", "./mail_drop"),
+		SMTPHost:      getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUsername:  getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:  getEnv("SMTP_PASSWORD", ""),
+
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
+		LogLevels: getEnvList("LOG_LEVELS", ""),
+
+		Session: SessionConfig{
+			CookieMode:     getEnvBool("SESSION_COOKIE_MODE", false),
+			CookieName:     getEnv("SESSION_COOKIE_NAME", "access_token"),
+			CookieDomain:   getEnv("SESSION_COOKIE_DOMAIN", ""),
+			CookieSecure:   getEnvBool("SESSION_COOKIE_SECURE", true),
+			CookieSameSite: getEnv("SESSION_COOKIE_SAMESITE", "lax"),
+			CookieMaxAge:   getEnvDuration("SESSION_COOKIE_MAX_AGE", 24*time.Hour),
+			CSRFCookieName: getEnv("CSRF_COOKIE_NAME", "csrf_token"),
+			CSRFHeaderName: getEnv("CSRF_HEADER_NAME", "X-CSRF-Token"),
+			CacheTTL:       getEnvDuration("SESSION_CACHE_TTL", 30*time.Second),
+		},
+
+		Tracing: TracingConfig{
+			Exporter:     getEnv("TRACING_EXPORTER", "none"),
+			ServiceName:  getEnv("TRACING_SERVICE_NAME", "go-clickhouse-example"),
+			OTLPEndpoint: getEnv("TRACING_OTLP_ENDPOINT", ""),
+			OTLPInsecure: getEnvBool("TRACING_OTLP_INSECURE", false),
+			File:         getEnv("TRACING_FILE", "./traces.jsonl"),
+			SampleRatio:  getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		},
 	}
 }
 
@@ -28,3 +168,66 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvList reads a comma separated list, ignoring empty entries
+func getEnvList(key, fallback string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, fallback), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvBool reads a boolean such as "true" or "0", falling back on parse errors
+func getEnvBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvInt reads an integer, falling back on parse errors
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvFloat reads a decimal number, falling back on parse errors
+func getEnvFloat(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration such as "30m" or "24h", falling back on parse errors
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
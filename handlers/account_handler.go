@@ -0,0 +1,118 @@
+// handlers/account_handler.go
+package handlers
+
+import (
+	"net/http"
+
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler handles password reset and email verification requests
+type AccountHandler struct {
+	AccountService *services.AccountService
+}
+
+// NewAccountHandler creates a new AccountHandler instance
+func NewAccountHandler(accountService *services.AccountService) *AccountHandler {
+	return &AccountHandler{AccountService: accountService}
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Emails a single-use password reset link in the background. The response is the same whether or not the email is registered. Links sent before are invalid once the password was reset
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Account email"
+// @Success 202 {object} map[string]string "Reset email sent if the account exists"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Router /password/forgot [post]
+func (h *AccountHandler) ForgotPassword(c *gin.Context) error {
+	var request models.ForgotPasswordRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	h.AccountService.ForgotPassword(c.Request.Context(), request.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a password reset link has been sent"})
+	return nil
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Sets a new password using the token from the password reset email. Each token can be used once. All sessions of the user are ended
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string "Password reset successfully"
+// @Failure 400 {object} apperr.Problem "Invalid input or token"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /password/reset [post]
+func (h *AccountHandler) ResetPassword(c *gin.Context) error {
+	var request models.ResetPasswordRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	if err := h.AccountService.ResetPassword(c.Request.Context(), request.Token, request.Password); err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+	return nil
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirms the user's email address using the token from the verification email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string "Email verified successfully"
+// @Failure 400 {object} apperr.Problem "Invalid input or token"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /verify-email [post]
+func (h *AccountHandler) VerifyEmail(c *gin.Context) error {
+	var request models.VerifyEmailRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	if err := h.AccountService.VerifyEmail(c.Request.Context(), request.Token); err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+	return nil
+}
+
+// @Security BearerAuth
+// ResendVerificationEmail godoc
+// @Summary Resend the verification email
+// @Description Sends a new email verification link to the current user
+// @Tags auth
+// @Produce json
+// @Success 202 {object} map[string]string "Verification email sent"
+// @Failure 400 {object} apperr.Problem "No email or already verified"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /verify-email/resend [post]
+func (h *AccountHandler) ResendVerificationEmail(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	if err := h.AccountService.SendVerificationEmail(c.Request.Context(), userID); err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	return nil
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of the analytics query parameters
+const (
+	maxPriceQuantiles  = 20
+	maxHistogramEdges  = 100
+	maxItemCountGroups = 1000
+	maxTopItems        = 100
+	maxTimeseriesSteps = 10000
+)
+
+// defaultTimeseriesWindows are the periods charted when from is not set
+var defaultTimeseriesWindows = map[string]time.Duration{
+	models.IntervalMinute: time.Hour,
+	models.IntervalHour:   24 * time.Hour,
+	models.IntervalDay:    30 * 24 * time.Hour,
+}
+
+// AnalyticsHandler handles item analytics requests
+type AnalyticsHandler struct {
+	AnalyticsService *services.AnalyticsService
+}
+
+// NewAnalyticsHandler creates a new AnalyticsHandler instance
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{AnalyticsService: analyticsService}
+}
+
+// @Security BearerAuth
+// GetPriceStats godoc
+// @Summary Item price statistics
+// @Description Returns the minimum, maximum, average and approximate quantiles of the prices of the items matching the search filters, per currency. Results are cached briefly. Admin only
+// @Tags analytics
+// @Produce json
+// @Param search query string false "Search query, matched against name and description"
+// @Param min_price query string false "Minimum price, in each item's own currency"
+// @Param max_price query string false "Maximum price, in each item's own currency"
+// @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match items of the category's descendants"
+// @Param tags query string false "Comma separated tags, items must have all of them"
+// @Param sku query string false "Exact SKU"
+// @Param quantiles query string false "Comma separated quantile levels between 0 and 1 (default 0.5,0.9,0.95,0.99)"
+// @Success 200 {object} map[string][]models.PriceStats "Statistics per currency"
+// @Failure 400 {object} apperr.Problem "Invalid query parameter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 504 {object} apperr.Problem "Query took too long"
+// @Router /analytics/items/price-stats [get]
+func (h *AnalyticsHandler) GetPriceStats(c *gin.Context) error {
+	filter, err := parseItemFilter(c)
+	if err != nil {
+		return err
+	}
+
+	var levels []float64
+	for _, value := range strings.Split(c.DefaultQuery("quantiles", "0.5,0.9,0.95,0.99"), ",") {
+		level, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || level <= 0 || level >= 1 {
+			return invalidQuery("quantiles")
+		}
+		levels = append(levels, level)
+	}
+	if len(levels) > maxPriceQuantiles {
+		return invalidQuery("quantiles")
+	}
+
+	stats, err := h.AnalyticsService.PriceStats(c.Request.Context(), filter, levels)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to compute price statistics")
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+	return nil
+}
+
+// @Security BearerAuth
+// GetPriceHistogram godoc
+// @Summary Item price histogram
+// @Description Counts the items matching the search filters per currency and price bucket. Buckets are either delimited by the given ascending bounds, with open-ended first and last buckets, or have a fixed width starting at zero. Empty buckets are omitted. Results are cached briefly. Admin only
+// @Tags analytics
+// @Produce json
+// @Param search query string false "Search query, matched against name and description"
+// @Param min_price query string false "Minimum price, in each item's own currency"
+// @Param max_price query string false "Maximum price, in each item's own currency"
+// @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match items of the category's descendants"
+// @Param tags query string false "Comma separated tags, items must have all of them"
+// @Param sku query string false "Exact SKU"
+// @Param bounds query string false "Comma separated ascending bucket bounds, e.g. 10,50,100"
+// @Param width query string false "Bucket width, used when bounds is not set (default 10)"
+// @Success 200 {object} map[string][]models.PriceBucket "Buckets per currency"
+// @Failure 400 {object} apperr.Problem "Invalid query parameter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 504 {object} apperr.Problem "Query took too long"
+// @Router /analytics/items/price-histogram [get]
+func (h *AnalyticsHandler) GetPriceHistogram(c *gin.Context) error {
+	filter, err := parseItemFilter(c)
+	if err != nil {
+		return err
+	}
+
+	var bounds []models.Money
+	if value := c.Query("bounds"); value != "" {
+		if bounds, err = parsePriceBounds(value); err != nil {
+			return invalidQuery("bounds")
+		}
+	}
+	// Widths are limited to the 4 decimal places prices are stored with
+	width, err := models.NewMoney(c.DefaultQuery("width", "10"))
+	if err != nil || !width.IsPositive() || !width.Round(4).Equal(width.Decimal) {
+		return invalidQuery("width")
+	}
+
+	buckets, err := h.AnalyticsService.PriceHistogram(c.Request.Context(), filter, bounds, width)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to compute price histogram")
+	}
+	c.JSON(http.StatusOK, gin.H{"buckets": buckets})
+	return nil
+}
+
+// parsePriceBounds parses comma separated, strictly ascending price bounds
+func parsePriceBounds(value string) ([]models.Money, error) {
+	var bounds []models.Money
+	for _, edge := range strings.Split(value, ",") {
+		bound, err := models.NewMoney(edge)
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) > 0 && !bound.GreaterThan(bounds[len(bounds)-1].Decimal) {
+			return nil, fmt.Errorf("bounds must be ascending")
+		}
+		bounds = append(bounds, bound)
+	}
+	if len(bounds) > maxHistogramEdges {
+		return nil, fmt.Errorf("at most %d bounds are allowed", maxHistogramEdges)
+	}
+	return bounds, nil
+}
+
+// @Security BearerAuth
+// GetItemCounts godoc
+// @Summary Item counts per group
+// @Description Counts the items matching the search filters grouped by category, tag or currency, largest groups first. Results are cached briefly. Admin only
+// @Tags analytics
+// @Produce json
+// @Param group_by query string true "Grouping: category, tag or currency"
+// @Param n query int false "Only return the n largest groups (default all, at most 1000)"
+// @Param search query string false "Search query, matched against name and description"
+// @Param min_price query string false "Minimum price, in each item's own currency"
+// @Param max_price query string false "Maximum price, in each item's own currency"
+// @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match items of the category's descendants"
+// @Param tags query string false "Comma separated tags, items must have all of them"
+// @Param sku query string false "Exact SKU"
+// @Success 200 {object} map[string][]models.ItemCount "Counts per group"
+// @Failure 400 {object} apperr.Problem "Invalid query parameter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 504 {object} apperr.Problem "Query took too long"
+// @Router /analytics/items/counts [get]
+func (h *AnalyticsHandler) GetItemCounts(c *gin.Context) error {
+	filter, err := parseItemFilter(c)
+	if err != nil {
+		return err
+	}
+
+	groupBy := c.Query("group_by")
+	switch groupBy {
+	case models.ItemGroupCategory, models.ItemGroupTag, models.ItemGroupCurrency:
+	default:
+		return invalidQuery("group_by")
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("n", "0"))
+	if err != nil || limit < 0 || limit > maxItemCountGroups {
+		return invalidQuery("n")
+	}
+
+	counts, err := h.AnalyticsService.Counts(c.Request.Context(), filter, groupBy, limit)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to count items")
+	}
+	c.JSON(http.StatusOK, gin.H{"group_by": groupBy, "counts": counts})
+	return nil
+}
+
+// @Security BearerAuth
+// GetTopItems godoc
+// @Summary Most or least expensive items
+// @Description Returns the n most expensive items matching the search filters of each currency, or the cheapest ones with order=asc. Results are cached briefly. Admin only
+// @Tags analytics
+// @Produce json
+// @Param n query int false "Items per currency (default 10, at most 100)"
+// @Param order query string false "desc for the most expensive items, asc for the cheapest (default desc)"
+// @Param search query string false "Search query, matched against name and description"
+// @Param min_price query string false "Minimum price, in each item's own currency"
+// @Param max_price query string false "Maximum price, in each item's own currency"
+// @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match items of the category's descendants"
+// @Param tags query string false "Comma separated tags, items must have all of them"
+// @Param sku query string false "Exact SKU"
+// @Success 200 {object} map[string][]models.ItemResponse "Top items, grouped by currency"
+// @Failure 400 {object} apperr.Problem "Invalid query parameter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 504 {object} apperr.Problem "Query took too long"
+// @Router /analytics/items/top [get]
+func (h *AnalyticsHandler) GetTopItems(c *gin.Context) error {
+	filter, err := parseItemFilter(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("n", "10"))
+	if err != nil || limit < 1 || limit > maxTopItems {
+		return invalidQuery("n")
+	}
+	var ascending bool
+	switch strings.ToLower(c.DefaultQuery("order", "desc")) {
+	case "asc":
+		ascending = true
+	case "desc":
+	default:
+		return invalidQuery("order")
+	}
+
+	items, err := h.AnalyticsService.TopByPrice(c.Request.Context(), filter, limit, ascending)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch top items")
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+	return nil
+}
+
+// @Security BearerAuth
+// GetTimeseries godoc
+// @Summary Timeseries of item changes
+// @Description Returns one point per minute, hour or day in [from, to) of the number of items created, updated, deleted or restored, of all item changes, or of the average price items were created or updated with. Points are read from rollups kept up to date by materialized views, intervals without changes are included with a zero count or a null average. from and to are aligned on the interval. Results are cached briefly. Admin only
+// @Tags analytics
+// @Produce json
+// @Param metric query string true "Metric: items_created, items_updated, items_deleted, items_restored, item_changes or avg_price"
+// @Param interval query string false "Interval: minute, hour or day (default hour)"
+// @Param from query string false "RFC 3339 start (default 1h, 24h or 30 days before to)"
+// @Param to query string false "RFC 3339 end, exclusive (default now)"
+// @Param currency query string false "Only count items of this ISO 4217 currency, required for avg_price"
+// @Success 200 {object} models.Timeseries "Timeseries"
+// @Failure 400 {object} apperr.Problem "Invalid query parameter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Failure 504 {object} apperr.Problem "Query took too long"
+// @Router /analytics/timeseries [get]
+func (h *AnalyticsHandler) GetTimeseries(c *gin.Context) error {
+	metric := c.Query("metric")
+	switch metric {
+	case models.MetricItemsCreated, models.MetricItemsUpdated, models.MetricItemsDeleted,
+		models.MetricItemsRestored, models.MetricItemChanges, models.MetricAvgPrice:
+	default:
+		return invalidQuery("metric")
+	}
+	interval := c.DefaultQuery("interval", models.IntervalHour)
+	window, ok := defaultTimeseriesWindows[interval]
+	if !ok {
+		return invalidQuery("interval")
+	}
+	currency := strings.ToUpper(c.Query("currency"))
+	if _, ok := models.CurrencyMinorUnits(currency); currency != "" && !ok {
+		return invalidQuery("currency")
+	}
+	// Averages of prices in different currencies would be meaningless
+	if metric == models.MetricAvgPrice && currency == "" {
+		return apperr.Invalid("invalid_query_parameter", "currency is required for avg_price")
+	}
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return invalidQuery("to")
+		}
+	}
+	from := to.Add(-window)
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return invalidQuery("from")
+		}
+	}
+	step, _ := services.TimeseriesStep(interval)
+	if !from.Before(to) || to.Sub(from)/step > maxTimeseriesSteps {
+		return apperr.Invalid("invalid_query_parameter", "from must be before to, with at most "+strconv.Itoa(maxTimeseriesSteps)+" intervals in between")
+	}
+
+	timeseries, err := h.AnalyticsService.Timeseries(c.Request.Context(), metric, interval, currency, from, to)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch timeseries")
+	}
+	c.JSON(http.StatusOK, timeseries)
+	return nil
+}
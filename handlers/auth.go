@@ -2,7 +2,10 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/config"
+	"go-clickhouse-example/middleware"
 	"go-clickhouse-example/models"
 	"go-clickhouse-example/services"
 	"go-clickhouse-example/utils"
@@ -13,99 +16,139 @@ import (
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	AuthService *services.AuthService
+	AuthService    *services.AuthService
+	AccountService *services.AccountService
+	SessionService *services.SessionService
+	Session        config.SessionConfig
 }
 
 // NewAuthHandler creates a new AuthHandler instance
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{AuthService: authService}
+func NewAuthHandler(authService *services.AuthService, accountService *services.AccountService, sessionService *services.SessionService, session config.SessionConfig) *AuthHandler {
+	return &AuthHandler{AuthService: authService, AccountService: accountService, SessionService: sessionService, Session: session}
 }
 
 // RegisterUser godoc
 // @Summary Register a new user
-// @Description Registers a new user with a role and returns a JWT token
+// @Description Registers a new user with a role and returns a JWT token. If an email is given, a verification link is sent to it
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body models.UserRequest true "User to register"
 // @Success 201 {string} string "JWT Token"
-// @Failure 400 {object} map[string]string "Invalid input"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 409 {object} apperr.Problem "Email already registered"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /register [post]
-func (h *AuthHandler) RegisterUser(c *gin.Context) {
+func (h *AuthHandler) RegisterUser(c *gin.Context) error {
 	var userRequest models.UserRequest
-	if err := c.ShouldBindJSON(&userRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-		return
+	if err := bindJSON(c, &userRequest); err != nil {
+		return err
 	}
 
-	// Hash the password
-	hashedPassword, err := utils.HashPassword(userRequest.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-		return
-	}
-
-	// Create a user model for storage
+	// Create a user model for storage, the AuthService hashes the password
 	user := &models.User{
 		Username: userRequest.Username,
-		Password: hashedPassword,
+		Email:    userRequest.Email,
+		Password: userRequest.Password,
 		Role:     userRequest.Role,
 	}
 
 	// Register user using the AuthService
-	createdUser, err := h.AuthService.RegisterUser(user)
+	createdUser, err := h.AuthService.RegisterUser(c.Request.Context(), user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return apperr.Wrap(err, "Failed to register user")
+	}
+
+	// Send the verification email, the user can request a new one if this fails
+	if createdUser.Email != "" {
+		if err := h.AccountService.SendVerificationEmail(c.Request.Context(), createdUser.ID); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to send verification email", "error", err)
+		}
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(createdUser)
+	// Start a session and generate JWT token
+	response, err := issueToken(c, h.SessionService, h.Session, createdUser, utils.AMRPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
-		return
+		return apperr.Internal("Could not generate token", err)
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"user":  createdUser,
-		"token": token,
-	})
+	body := gin.H{"user": createdUser}
+	if response.Token != "" {
+		body["token"] = response.Token
+	}
+	if response.CSRFToken != "" {
+		body["csrf_token"] = response.CSRFToken
+	}
+	c.JSON(http.StatusCreated, body)
+	return nil
 }
 
 // LoginUser godoc
 // @Summary Login user and get JWT token
-// @Description Logs in the user and returns a JWT token
+// @Description Logs in the user and returns a JWT token, or sets the session cookie in cookie session mode. If the account has MFA enabled, an MFA challenge token is returned instead and must be exchanged at /login/mfa
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param user body models.UserRequest true "User login credentials"
-// @Success 200 {string} string "JWT Token"
-// @Failure 400 {object} map[string]string "Invalid input"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Param user body models.LoginRequest true "User login credentials"
+// @Success 200 {object} models.LoginResponse "JWT token or MFA challenge"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /login [post]
-func (h *AuthHandler) LoginUser(c *gin.Context) {
-	var userRequest models.UserRequest
-	if err := c.ShouldBindJSON(&userRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-		return
+func (h *AuthHandler) LoginUser(c *gin.Context) error {
+	var userRequest models.LoginRequest
+	if err := bindJSON(c, &userRequest); err != nil {
+		return err
 	}
-	fmt.Println("Login request:", userRequest) // Add this line to see the parsed request
 
 	// Authenticate user
-	user, err := h.AuthService.AuthenticateUser(userRequest.Username, userRequest.Password)
+	user, err := h.AuthService.AuthenticateUser(c.Request.Context(), userRequest.Username, userRequest.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
-		return
+		middleware.RecordAuthFailure(err)
+		return apperr.Wrap(err, "Failed to authenticate user")
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user)
+	// Accounts with MFA enabled must complete a second step before getting an access token
+	if user.MFAEnabled {
+		mfaToken, err := utils.GenerateMFAChallenge(user)
+		if err != nil {
+			return apperr.Internal("Could not generate token", err)
+		}
+		c.JSON(http.StatusOK, models.LoginResponse{MFARequired: true, MFAToken: mfaToken})
+		return nil
+	}
+
+	// Start a session and generate JWT token
+	response, err := issueToken(c, h.SessionService, h.Session, user, utils.AMRPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
-		return
+		return apperr.Internal("Could not generate token", err)
+	}
+
+	c.JSON(http.StatusOK, response)
+	return nil
+}
+
+// @Security BearerAuth
+// LogoutUser godoc
+// @Summary Logout user
+// @Description Revokes the current session and clears the session and CSRF cookies used in cookie session mode
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]string "Logged out"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /logout [post]
+func (h *AuthHandler) LogoutUser(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+	sessionID := c.GetString("session_id")
+
+	if err := h.SessionService.Revoke(c.Request.Context(), userID, sessionID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		return apperr.Internal("Failed to revoke session", err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	middleware.ClearSessionCookies(c, h.Session)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	return nil
 }
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+	"go-clickhouse-example/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxBulkOperations bounds the number of operations of a bulk request
+const maxBulkOperations = 50000
+
+var errTooManyOperations = apperr.Invalid("too_many_operations",
+	fmt.Sprintf("A bulk request can hold at most %d operations", maxBulkOperations))
+
+// @Security BearerAuth
+// BulkItems godoc
+// @Summary Create, update and delete items in bulk
+// @Description Applies up to 50000 operations given as a JSON array or as NDJSON (one operation per line). Creates are written with a single batch insert. In atomic mode (the default) nothing is written unless every operation is valid, and the invalid ones are listed as "[index].field" errors. In best_effort mode the valid operations are written and the others reported in the results. One aggregated event is published to NATS. Admin only
+// @Tags items
+// @Accept json
+// @Accept application/x-ndjson
+// @Produce json
+// @Param mode query string false "atomic or best_effort (default is atomic)"
+// @Param operations body []models.BulkItemOperation true "Operations"
+// @Success 200 {object} models.BulkItemResponse "Result of every operation"
+// @Failure 400 {object} apperr.Problem "Invalid input or mode"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 422 {object} apperr.Problem "Invalid operations, in atomic mode"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/bulk [post]
+func (h *ItemHandler) BulkItems(c *gin.Context) error {
+	mode := c.DefaultQuery("mode", models.BulkModeAtomic)
+	if mode != models.BulkModeAtomic && mode != models.BulkModeBestEffort {
+		return invalidQuery("mode")
+	}
+
+	operations, err := decodeBulkOperations(c.Request.Body)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]services.BulkItemEntry, len(operations))
+	for i := range operations {
+		entries[i] = h.bulkEntry(&operations[i])
+	}
+
+	response, err := h.BulkItemService.Apply(c.Request.Context(), entries, mode, c.MustGet("user_id").(uint64))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to apply bulk operations")
+	}
+	c.JSON(http.StatusOK, response)
+	return nil
+}
+
+// decodeBulkOperations reads a JSON array of operations or one operation per line
+func decodeBulkOperations(body io.Reader) ([]models.BulkItemOperation, error) {
+	reader := bufio.NewReader(body)
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return nil, errInvalidInput
+	}
+
+	decoder := json.NewDecoder(reader)
+	isArray := first == '['
+	if isArray {
+		if _, err := decoder.Token(); err != nil {
+			return nil, errInvalidInput
+		}
+	}
+
+	operations := []models.BulkItemOperation{}
+	for {
+		if isArray && !decoder.More() {
+			if _, err := decoder.Token(); err != nil {
+				return nil, errInvalidInput
+			}
+			break
+		}
+		var operation models.BulkItemOperation
+		err := decoder.Decode(&operation)
+		if errors.Is(err, io.EOF) && !isArray {
+			break
+		}
+		if err != nil {
+			return nil, apperr.Invalid(apperr.CodeInvalidInput, fmt.Sprintf("Invalid input at operation %d", len(operations)))
+		}
+		if len(operations) == maxBulkOperations {
+			return nil, errTooManyOperations
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte without consuming it
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
+	}
+}
+
+// bulkEntry validates an operation the way the single item routes validate requests
+func (h *ItemHandler) bulkEntry(operation *models.BulkItemOperation) services.BulkItemEntry {
+	if operation.Op == "" {
+		operation.Op = models.BulkOpCreate
+	}
+	entry := services.BulkItemEntry{Op: operation.Op, ID: operation.ID}
+
+	if err := binding.Validator.ValidateStruct(operation); err != nil {
+		entry.Err = apperr.Validation(validation.FieldErrors(err)...)
+		return entry
+	}
+	if operation.Op != models.BulkOpCreate && operation.ID == 0 {
+		entry.Err = apperr.Validation(models.FieldError{Field: "id", Code: "required", Message: "id is required"})
+		return entry
+	}
+	if operation.Op == models.BulkOpDelete {
+		return entry
+	}
+	if operation.Item == nil {
+		entry.Err = apperr.Validation(models.FieldError{Field: "item", Code: "required", Message: "item is required"})
+		return entry
+	}
+
+	currency, err := h.validatePrice(operation.Item)
+	if err != nil {
+		fields := apperr.From(err).Fields
+		for i := range fields {
+			fields[i].Field = "item." + fields[i].Field
+		}
+		entry.Err = apperr.Validation(fields...)
+		return entry
+	}
+
+	request := operation.Item
+	entry.Item = models.ItemResponse{
+		Name:        request.Name,
+		Description: request.Description,
+		SKU:         request.SKU,
+		CategoryID:  request.CategoryID,
+		Tags:        request.Tags,
+		Price:       request.Price,
+		Currency:    currency,
+	}
+	return entry
+}
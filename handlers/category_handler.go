@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CategoryHandler handles item category requests
+type CategoryHandler struct {
+	CategoryService *services.CategoryService
+}
+
+// NewCategoryHandler creates a new CategoryHandler instance
+func NewCategoryHandler(categoryService *services.CategoryService) *CategoryHandler {
+	return &CategoryHandler{CategoryService: categoryService}
+}
+
+var errInvalidCategoryID = apperr.Invalid("invalid_category_id", "Invalid category ID")
+
+// parseCategoryID reads the category ID from the path
+func parseCategoryID(c *gin.Context) (uint64, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, errInvalidCategoryID
+	}
+	return id, nil
+}
+
+// @Security BearerAuth
+// ListCategories godoc
+// @Summary List categories
+// @Description Returns the whole category tree ordered by path, so that every subtree is contiguous, with direct and subtree item counts
+// @Tags categories
+// @Produce json
+// @Success 200 {array} models.Category "Categories"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /categories [get]
+func (h *CategoryHandler) ListCategories(c *gin.Context) error {
+	categories, err := h.CategoryService.List(c.Request.Context())
+	if err != nil {
+		return apperr.Internal("Failed to fetch categories", err)
+	}
+	c.JSON(http.StatusOK, categories)
+	return nil
+}
+
+// @Security BearerAuth
+// GetCategory godoc
+// @Summary Get a category
+// @Description Returns a category with its direct and subtree item counts
+// @Tags categories
+// @Produce json
+// @Param id path string true "Category ID"
+// @Success 200 {object} models.Category "Category"
+// @Failure 400 {object} apperr.Problem "Invalid category ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 404 {object} apperr.Problem "Category not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /categories/{id} [get]
+func (h *CategoryHandler) GetCategory(c *gin.Context) error {
+	id, err := parseCategoryID(c)
+	if err != nil {
+		return err
+	}
+
+	category, err := h.CategoryService.Get(c.Request.Context(), id)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch category")
+	}
+	c.JSON(http.StatusOK, category)
+	return nil
+}
+
+// @Security BearerAuth
+// CreateCategory godoc
+// @Summary Create a category
+// @Description Creates a category under the given parent, or a root category when parent_id is 0. Admin only
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param category body models.CategoryRequest true "Category to create"
+// @Success 201 {object} models.Category "Created category"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 422 {object} apperr.Problem "Invalid fields or parent not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /categories [post]
+func (h *CategoryHandler) CreateCategory(c *gin.Context) error {
+	var request models.CategoryRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	category, err := h.CategoryService.Create(c.Request.Context(), request)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to create category")
+	}
+	c.JSON(http.StatusCreated, category)
+	return nil
+}
+
+// @Security BearerAuth
+// UpdateCategory godoc
+// @Summary Update a category
+// @Description Renames a category and moves it, with its whole subtree, under a new parent. Moving a category under itself or one of its descendants is rejected. Admin only
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path string true "Category ID"
+// @Param category body models.CategoryRequest true "Category name and parent"
+// @Success 200 {object} models.Category "Updated category"
+// @Failure 400 {object} apperr.Problem "Invalid input or category ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Category not found"
+// @Failure 422 {object} apperr.Problem "Invalid fields, parent not found or cycle"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /categories/{id} [put]
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) error {
+	id, err := parseCategoryID(c)
+	if err != nil {
+		return err
+	}
+
+	var request models.CategoryRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	category, err := h.CategoryService.Update(c.Request.Context(), id, request)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to update category")
+	}
+	c.JSON(http.StatusOK, category)
+	return nil
+}
+
+// @Security BearerAuth
+// DeleteCategory godoc
+// @Summary Delete a category
+// @Description Deletes a category that has no subcategories and no items. Admin only
+// @Tags categories
+// @Produce json
+// @Param id path string true "Category ID"
+// @Success 200 {object} map[string]string "Category deleted"
+// @Failure 400 {object} apperr.Problem "Invalid category ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Category not found"
+// @Failure 409 {object} apperr.Problem "Category not empty"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /categories/{id} [delete]
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) error {
+	id, err := parseCategoryID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.CategoryService.Delete(c.Request.Context(), id); err != nil {
+		return apperr.Wrap(err, "Failed to delete category")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
+	return nil
+}
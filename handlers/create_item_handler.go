@@ -1,10 +1,9 @@
 package handlers
 
 import (
+	"go-clickhouse-example/apperr"
 	"go-clickhouse-example/models"
-	"go-clickhouse-example/utils"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,64 +17,52 @@ import (
 // @Produce  json
 // @Param item body models.ItemRequest true "Item to create"
 // @Success 201 {object} models.ItemResponse "Created item"
-// @Failure 400 {object} map[string]string "Invalid input"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 409 {object} apperr.Problem "SKU already in use"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /items [post]
-func (h *ItemHandler) CreateItem(c *gin.Context) {
-	// Extract token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-		return
-	}
-
-	// Ensure the token is prefixed with "Bearer "
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		return
-	}
-
-	// Now the tokenString is the actual JWT token
-	// Parse and validate the JWT token
-	user, err := utils.ParseJWT(tokenString)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
-	}
+func (h *ItemHandler) CreateItem(c *gin.Context) error {
+	// AuthMiddleware has already validated the token and stored the user's role
+	role := c.GetString("role")
 
 	// Check user role for access control (optional)
-	if user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to create an item"})
-		return
+	if role != "admin" {
+		return apperr.Forbidden(apperr.CodeForbidden, "You don't have permission to create an item")
 	}
 
 	// Bind the incoming request to the item model
 	var itemRequest models.ItemRequest
-	if err := c.ShouldBindJSON(&itemRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-		return
+	if err := bindJSON(c, &itemRequest); err != nil {
+		return err
+	}
+	currency, err := h.validatePrice(&itemRequest)
+	if err != nil {
+		return err
 	}
 
 	item := models.ItemResponse{
-		Name:  itemRequest.Name,
-		Price: itemRequest.Price,
+		Name:        itemRequest.Name,
+		Description: itemRequest.Description,
+		SKU:         itemRequest.SKU,
+		CategoryID:  itemRequest.CategoryID,
+		Tags:        itemRequest.Tags,
+		Price:       itemRequest.Price,
+		Currency:    currency,
+		CreatedBy:   c.MustGet("user_id").(uint64),
 	}
 
 	// Save item to database
-	err = h.DBService.SaveItem(&item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save item to database"})
-		return
+	if err := h.DBService.SaveItem(c.Request.Context(), &item); err != nil {
+		return apperr.Wrap(err, "Failed to save item to database")
 	}
 
 	// Publish the item to NATS
-	err = h.NATSService.PublishItem(item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish item to NATS"})
-		return
+	if err := h.NATSService.PublishItem(c.Request.Context(), item); err != nil {
+		return apperr.Internal("Failed to publish item to NATS", err)
 	}
 
 	// Return the created item as a response
 	c.JSON(http.StatusCreated, item)
+	return nil
 }
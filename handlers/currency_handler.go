@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrencyHandler handles exchange rate requests
+type CurrencyHandler struct {
+	CurrencyService *services.CurrencyService
+}
+
+// NewCurrencyHandler creates a new CurrencyHandler instance
+func NewCurrencyHandler(currencyService *services.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{CurrencyService: currencyService}
+}
+
+// @Security BearerAuth
+// ListExchangeRates godoc
+// @Summary List exchange rates
+// @Description Returns the exchange rates used to convert prices with the currency query parameter
+// @Tags currencies
+// @Produce json
+// @Success 200 {array} models.ExchangeRate "Exchange rates"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /exchange-rates [get]
+func (h *CurrencyHandler) ListExchangeRates(c *gin.Context) error {
+	rates, err := h.CurrencyService.ListRates(c.Request.Context())
+	if err != nil {
+		return apperr.Internal("Failed to fetch exchange rates", err)
+	}
+	c.JSON(http.StatusOK, rates)
+	return nil
+}
+
+// @Security BearerAuth
+// SetExchangeRate godoc
+// @Summary Set an exchange rate
+// @Description Sets how many units of the quote currency one unit of the base currency is worth, replacing the previous rate. Admin only
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param rate body models.ExchangeRate true "Exchange rate"
+// @Success 200 {object} models.ExchangeRate "Stored exchange rate"
+// @Failure 400 {object} apperr.Problem "Invalid exchange rate"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/exchange-rates [put]
+func (h *CurrencyHandler) SetExchangeRate(c *gin.Context) error {
+	var rate models.ExchangeRate
+	if err := bindJSON(c, &rate); err != nil {
+		return err
+	}
+
+	if err := h.CurrencyService.SetRate(c.Request.Context(), &rate, c.MustGet("user_id").(uint64)); err != nil {
+		return apperr.Wrap(err, "Failed to save exchange rate")
+	}
+	c.JSON(http.StatusOK, rate)
+	return nil
+}
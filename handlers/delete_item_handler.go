@@ -1,10 +1,9 @@
 package handlers
 
 import (
-	"go-clickhouse-example/utils"
 	"net/http"
-	"strconv"
-	"strings"
+
+	"go-clickhouse-example/apperr"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,73 +11,47 @@ import (
 // @Security BearerAuth
 // DeleteItem godoc
 // @Summary Delete an item
-// @Description Remove an item from the database by its ID
+// @Description Move an item to the trash, from which it can be restored until it is purged after the configured retention period
 // @Tags items
 // @Produce json
 // @Param id path string true "Item ID"
 // @Success 200 {object} map[string]string "Item deleted successfully"
-// @Failure 400 {object} map[string]string "Invalid item ID"
-// @Failure 404 {object} map[string]string "Item not found"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 400 {object} apperr.Problem "Invalid item ID"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /items/{id} [delete]
-func (h *ItemHandler) DeleteItem(c *gin.Context) {
-	// Extract token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-		return
-	}
-
-	// Ensure the token is prefixed with "Bearer "
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		return
-	}
-
-	// Now the tokenString is the actual JWT token
-	// Parse and validate the JWT token
-	user, err := utils.ParseJWT(tokenString)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
-	}
+func (h *ItemHandler) DeleteItem(c *gin.Context) error {
+	// AuthMiddleware has already validated the token and stored the user's role
+	role := c.GetString("role")
 
 	// Check user role for access control (optional)
-	if user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to delete this item"})
-		return
+	if role != "admin" {
+		return apperr.Forbidden(apperr.CodeForbidden, "You don't have permission to delete this item")
 	}
 
 	// Get the item ID from the path
-	id := c.Param("id")
-	itemID, err := strconv.ParseUint(id, 10, 64)
+	itemID, err := parseItemID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
-		return
+		return err
 	}
 
 	// Retrieve the item from the database
-	item, err := h.DBService.GetItemByID(itemID)
+	item, err := h.DBService.GetItemByID(c.Request.Context(), itemID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
-		return
+		return apperr.Wrap(err, "Failed to fetch item")
 	}
 
-	// Delete the item from the database
-	err = h.DBService.DeleteItem(itemID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete item"})
-		return
+	// Move the item to the trash
+	if err := h.DBService.DeleteItem(c.Request.Context(), &item, c.MustGet("user_id").(uint64)); err != nil {
+		return apperr.Internal("Failed to delete item", err)
 	}
 
-	// Publish the item deletion to NATS
-	err = h.NATSService.PublishItem(item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish item deletion to NATS"})
-		return
+	// Publish the item deletion to NATS, subscribers tell deletions apart by deleted_at
+	if err := h.NATSService.PublishItem(c.Request.Context(), item); err != nil {
+		return apperr.Internal("Failed to publish item deletion to NATS", err)
 	}
 
 	// Return success message
 	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
+	return nil
 }
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportMediaTypes lists the media types GET /items can be negotiated to, JSON first
+var exportMediaTypes = []string{
+	gin.MIMEJSON,
+	"text/csv",
+	"application/x-ndjson",
+	"application/vnd.apache.parquet",
+	"application/vnd.apache.arrow.stream",
+}
+
+// exportFormatsByMediaType maps negotiated media types to export formats
+var exportFormatsByMediaType = map[string]string{
+	"text/csv":                            models.ExportFormatCSV,
+	"application/x-ndjson":                models.ExportFormatNDJSON,
+	"application/vnd.apache.parquet":      models.ExportFormatParquet,
+	"application/vnd.apache.arrow.stream": models.ExportFormatArrow,
+}
+
+// @Security BearerAuth
+// ExportItems godoc
+// @Summary Export items
+// @Description Streams every item matching the search filters in CSV (with a header row), NDJSON, Parquet or Arrow stream format, as produced by ClickHouse. Pagination parameters are ignored. Admin only
+// @Tags items
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.apache.parquet
+// @Produce application/vnd.apache.arrow.stream
+// @Param format query string true "csv, ndjson, parquet or arrow"
+// @Param search query string false "Search query, matched against name and description"
+// @Param min_price query string false "Minimum price, in each item's own currency"
+// @Param max_price query string false "Maximum price, in each item's own currency"
+// @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match items of the category's descendants"
+// @Param tags query string false "Comma separated tags, items must have all of them"
+// @Param sku query string false "Exact SKU"
+// @Param sort_by query string false "Sort by field (e.g., price, name, created_at)"
+// @Param sort_order query string false "Sort order (ASC or DESC)"
+// @Success 200 {file} file "Items"
+// @Failure 400 {object} apperr.Problem "Invalid format or filter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/export [get]
+func (h *ItemHandler) ExportItems(c *gin.Context) error {
+	format := c.Query("format")
+	if _, ok := models.ExportContentTypes[format]; !ok {
+		return invalidQuery("format")
+	}
+	return h.exportItems(c, format)
+}
+
+// negotiateExportFormat returns the export format requested with the Accept header,
+// or an empty string if JSON is preferred
+func negotiateExportFormat(c *gin.Context) string {
+	return exportFormatsByMediaType[c.NegotiateFormat(exportMediaTypes...)]
+}
+
+// exportItems streams the items matching the search filters in the given format
+func (h *ItemHandler) exportItems(c *gin.Context, format string) error {
+	filter, err := parseItemFilter(c)
+	if err != nil {
+		return err
+	}
+	// GET /items names the category filter "category"
+	if category := c.Query("category"); category != "" && filter.CategoryID == 0 {
+		if filter.CategoryID, err = strconv.ParseUint(category, 10, 64); err != nil {
+			return invalidQuery("category")
+		}
+	}
+
+	// Headers are only sent with the first bytes, so that a failing query can still
+	// be reported as problem details
+	writer := &streamWriter{c: c, start: func() {
+		c.Header("Content-Type", models.ExportContentTypes[format])
+		c.Header("Content-Disposition", `attachment; filename="items.`+format+`"`)
+		c.Status(http.StatusOK)
+	}}
+	if err := h.DBService.ExportItems(c.Request.Context(), filter, format, writer); err != nil {
+		if !writer.started {
+			return apperr.Internal("Failed to export items", err)
+		}
+		// The response is already under way, it can only be cut short
+		_ = c.Error(err)
+		c.Abort()
+	}
+	return nil
+}
+
+// streamWriter writes to the response, flushing every chunk to the client
+type streamWriter struct {
+	c       *gin.Context
+	start   func()
+	started bool
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.start()
+		w.started = true
+	}
+	n, err := w.c.Writer.Write(p)
+	w.c.Writer.Flush()
+	return n, err
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
-	"go-clickhouse-example/utils"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,48 +14,73 @@ import (
 // @Security BearerAuth
 // GetItems godoc
 // @Summary Get all items
-// @Description Retrieve all items from the database
+// @Description Retrieve all items from the database, optionally only those of a category or of its whole subtree. Admin only.
+// @Description With as_of the items are returned as they were at that time, including items deleted since.
+// @Description Accept headers for CSV, NDJSON, Parquet or Arrow stream the items as GET /items/export does, with the search filters
 // @Tags items
 // @Produce  json
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.apache.parquet
+// @Produce application/vnd.apache.arrow.stream
+// @Param category query int false "Category ID"
+// @Param include_descendants query bool false "Also return items of the category's descendants"
+// @Param as_of query string false "RFC 3339 time to return the catalogue as of"
+// @Param currency query string false "ISO 4217 currency to convert prices into"
 // @Success 200 {array} models.ItemResponse "List of items"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 400 {object} apperr.Problem "Invalid category, time or currency"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /items [get]
-func (h *ItemHandler) GetItems(c *gin.Context) {
-	// Extract token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-		return
+func (h *ItemHandler) GetItems(c *gin.Context) error {
+	// Other formats than JSON are streamed straight from ClickHouse, like GET /items/export.
+	// Both routes are restricted to admins.
+	if format := negotiateExportFormat(c); format != "" {
+		if c.Query("as_of") != "" {
+			return apperr.Invalid("invalid_query_parameter", "as_of is only supported for JSON")
+		}
+		return h.exportItems(c, format)
 	}
 
-	// Ensure the token is prefixed with "Bearer "
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		return
+	var categoryID uint64
+	var err error
+	if category := c.Query("category"); category != "" {
+		if categoryID, err = strconv.ParseUint(category, 10, 64); err != nil {
+			return invalidQuery("category")
+		}
 	}
-
-	// Parse and validate the JWT token
-	user, err := utils.ParseJWT(tokenString)
+	includeDescendants, err := strconv.ParseBool(c.DefaultQuery("include_descendants", "false"))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
+		return invalidQuery("include_descendants")
 	}
 
-	// Optionally, check user role for access control (e.g., only admin can access all items)
-	if user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access all items"})
-		return
+	// Retrieve all items, or the items of a category, from the database
+	var items []models.ItemResponse
+	switch {
+	case c.Query("as_of") != "":
+		asOf, parseErr := time.Parse(time.RFC3339, c.Query("as_of"))
+		if parseErr != nil {
+			return invalidQuery("as_of")
+		}
+		items, err = h.DBService.GetItemsAsOf(c.Request.Context(), asOf.UTC(), categoryID, includeDescendants)
+	case categoryID != 0:
+		items, err = h.DBService.GetItemsByCategory(c.Request.Context(), categoryID, includeDescendants)
+	default:
+		items, err = h.DBService.GetAllItems(c.Request.Context())
 	}
-
-	// Retrieve all items from the database
-	items, err := h.DBService.GetAllItems()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
-		return
+		return apperr.Internal("Failed to fetch items", err)
+	}
+	if items == nil {
+		items = []models.ItemResponse{}
+	}
+
+	if err := h.convertPrices(c, items); err != nil {
+		return apperr.Wrap(err, "Failed to convert prices")
 	}
 
 	// Return the list of items as a response
 	c.JSON(http.StatusOK, items)
+	return nil
 }
@@ -1,12 +1,10 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 
-	"go-clickhouse-example/utils"
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,65 +16,41 @@ import (
 // @Tags items
 // @Produce  json
 // @Param id path string true "Item ID"
+// @Param currency query string false "ISO 4217 currency to convert the price into"
 // @Success 200 {object} models.ItemResponse "Retrieved item"
-// @Failure 400 {object} map[string]string "Invalid item ID"
-// @Failure 404 {object} map[string]string "Item not found"
-// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 400 {object} apperr.Problem "Invalid item ID or currency"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
 // @Router /items/{id} [get]
-func (h *ItemHandler) GetItem(c *gin.Context) {
-	// Extract token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-		return
-	}
-
-	// Ensure the token is prefixed with "Bearer "
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		return
-	}
-
-	// Now the tokenString is the actual JWT token
-	fmt.Println("Extracted token:", tokenString)
-
-	// Parse and validate the JWT token
-	user, err := utils.ParseJWT(tokenString)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
-	}
+func (h *ItemHandler) GetItem(c *gin.Context) error {
+	// AuthMiddleware has already validated the token and stored the user's role
+	role := c.GetString("role")
 
 	// Get the item ID from the path
-	id := c.Param("id")
-	itemID, err := strconv.ParseUint(id, 10, 64)
+	itemID, err := parseItemID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
-		return
+		return err
 	}
 
 	// Retrieve the item from the database
-	item, err := h.DBService.GetItemByID(itemID)
+	item, err := h.DBService.GetItemByID(c.Request.Context(), itemID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
-		return
+		return apperr.Wrap(err, "Failed to fetch item")
 	}
 
 	// Optionally, check user role for access control
 	// Example: Only admin can access all items
-	if user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this item"})
-		return
+	if role != "admin" {
+		return apperr.Forbidden(apperr.CodeForbidden, "You don't have permission to access this item")
 	}
 
-	// Publish the item to NATS (if needed)
-	err = h.NATSService.PublishItem(item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish item to NATS"})
-		return
+	// Convert the price if another currency was requested
+	items := []models.ItemResponse{item}
+	if err := h.convertPrices(c, items); err != nil {
+		return apperr.Wrap(err, "Failed to convert prices")
 	}
 
 	// Return the item as a response
-	c.JSON(http.StatusOK, item)
+	c.JSON(http.StatusOK, items[0])
+	return nil
 }
@@ -0,0 +1,86 @@
+// handlers/impersonation_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonationHandler handles admin impersonation and audit log requests
+type ImpersonationHandler struct {
+	ImpersonationService *services.ImpersonationService
+	AuditService         *services.AuditService
+}
+
+// NewImpersonationHandler creates a new ImpersonationHandler instance
+func NewImpersonationHandler(impersonationService *services.ImpersonationService, auditService *services.AuditService) *ImpersonationHandler {
+	return &ImpersonationHandler{ImpersonationService: impersonationService, AuditService: auditService}
+}
+
+// @Security BearerAuth
+// StartImpersonation godoc
+// @Summary Impersonate a user
+// @Description Issues a short-lived token to act as the given user. Responses to requests made with it carry the X-Impersonated-By header, user-management actions are blocked and every request is audited. Admin only
+// @Tags admin
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} models.ImpersonationResponse "Impersonation token"
+// @Failure 400 {object} apperr.Problem "Invalid user ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "User not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/impersonate/{user_id} [post]
+func (h *ImpersonationHandler) StartImpersonation(c *gin.Context) error {
+	targetID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	actorID := c.MustGet("user_id").(uint64)
+	amr, _ := c.MustGet("amr").([]string)
+
+	response, err := h.ImpersonationService.Start(c.Request.Context(), actorID, targetID, amr, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return apperr.Wrap(err, "Failed to start impersonation")
+	}
+	c.JSON(http.StatusOK, response)
+	return nil
+}
+
+// @Security BearerAuth
+// ListAuditLog godoc
+// @Summary List audit log entries
+// @Description Returns the most recent audit log entries, including every request made while impersonating. Admin only
+// @Tags admin
+// @Produce json
+// @Param actor_id query int false "Filter by acting admin"
+// @Param subject_id query int false "Filter by impersonated user"
+// @Param limit query int false "Maximum number of entries (default is 100)"
+// @Success 200 {array} models.AuditEntry "Audit entries"
+// @Failure 400 {object} apperr.Problem "Invalid filter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/audit [get]
+func (h *ImpersonationHandler) ListAuditLog(c *gin.Context) error {
+	actorID, err1 := strconv.ParseUint(c.DefaultQuery("actor_id", "0"), 10, 64)
+	subjectID, err2 := strconv.ParseUint(c.DefaultQuery("subject_id", "0"), 10, 64)
+	limit, err3 := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err1 != nil || err2 != nil || err3 != nil || limit <= 0 || limit > 1000 {
+		return apperr.Invalid("invalid_query_parameter", "Invalid filter")
+	}
+
+	entries, err := h.AuditService.List(c.Request.Context(), actorID, subjectID, limit)
+	if err != nil {
+		return apperr.Internal("Failed to fetch audit log", err)
+	}
+
+	c.JSON(http.StatusOK, entries)
+	return nil
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportHandler handles item import requests
+type ImportHandler struct {
+	ImportService *services.ImportService
+	// MaxBytes bounds the size of uploaded files
+	MaxBytes int64
+}
+
+// NewImportHandler creates a new ImportHandler instance
+func NewImportHandler(importService *services.ImportService, maxBytes int64) *ImportHandler {
+	return &ImportHandler{ImportService: importService, MaxBytes: maxBytes}
+}
+
+var (
+	errImportFileRequired = apperr.Validation(models.FieldError{Field: "file", Code: "required", Message: "file is required"})
+	errImportFileTooLarge = apperr.Invalid("file_too_large", "The uploaded file is too large")
+	errInvalidMapping     = apperr.Validation(models.FieldError{
+		Field: "mapping", Code: "invalid", Message: "mapping must be a JSON object of item fields to column names",
+	})
+)
+
+// @Security BearerAuth
+// CreateImport godoc
+// @Summary Import items from a file
+// @Description Uploads a CSV file with a header row or an NDJSON file and imports it in the background. Rows whose SKU belongs to an existing item update the mapped fields of that item, the other rows create items. Values are coerced to the field types: prices may carry a currency symbol and comma thousands separators, tags may be separated by commas, semicolons or pipes. Invalid rows are skipped and reported. An event is published to NATS when the import finishes. Admin only
+// @Tags imports
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV or NDJSON file"
+// @Param format formData string false "csv or ndjson, taken from the file extension by default"
+// @Param mapping formData string false "JSON object of item fields to source columns, e.g. {\"name\":\"Product\",\"price\":\"Unit Price\"}"
+// @Success 202 {object} models.Import "Queued import"
+// @Failure 400 {object} apperr.Problem "Invalid upload"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 409 {object} apperr.Problem "Too many imports waiting"
+// @Failure 422 {object} apperr.Problem "Invalid format or mapping"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /imports [post]
+func (h *ImportHandler) CreateImport(c *gin.Context) error {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxBytes)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errImportFileTooLarge
+		}
+		return errImportFileRequired
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".csv":
+			format = models.ImportFormatCSV
+		case ".ndjson", ".jsonl":
+			format = models.ImportFormatNDJSON
+		}
+	}
+
+	var mapping map[string]string
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return errInvalidMapping
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return apperr.Internal("Failed to read upload", err)
+	}
+	defer file.Close()
+
+	imp, err := h.ImportService.Start(c.Request.Context(), file, header.Filename, format, mapping, c.MustGet("user_id").(uint64))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to start import")
+	}
+	c.JSON(http.StatusAccepted, imp)
+	return nil
+}
+
+// @Security BearerAuth
+// GetImport godoc
+// @Summary Get an import
+// @Description Returns the status, progress and row counts of an import. Admin only
+// @Tags imports
+// @Produce json
+// @Param id path string true "Import ID"
+// @Success 200 {object} models.Import "Import"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Import not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /imports/{id} [get]
+func (h *ImportHandler) GetImport(c *gin.Context) error {
+	imp, err := h.ImportService.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch import")
+	}
+	c.JSON(http.StatusOK, imp)
+	return nil
+}
+
+// @Security BearerAuth
+// GetImportErrors godoc
+// @Summary Download an import's error report
+// @Description Returns the row errors recorded so far as a CSV file with the columns row, column, code and message. Admin only
+// @Tags imports
+// @Produce text/csv
+// @Param id path string true "Import ID"
+// @Success 200 {string} string "Error report"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Import not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /imports/{id}/errors [get]
+func (h *ImportHandler) GetImportErrors(c *gin.Context) error {
+	imp, err := h.ImportService.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch import")
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="import-`+imp.ID+`-errors.csv"`)
+	c.Status(http.StatusOK)
+
+	// The report is streamed, so errors past this point can only end the response
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"row", "column", "code", "message"})
+	err = h.ImportService.Errors(c.Request.Context(), imp.ID, func(e models.ImportError) error {
+		return writer.Write([]string{strconv.FormatUint(e.Row, 10), csvCell(e.Column), csvCell(e.Code), csvCell(e.Message)})
+	})
+	writer.Flush()
+	if err != nil {
+		_ = c.Error(err)
+	}
+	return nil
+}
+
+// csvCell keeps spreadsheets from evaluating a cell as a formula. Columns and
+// messages can quote the uploaded file, so cells starting with a formula character
+// are prefixed with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
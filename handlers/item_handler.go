@@ -1,14 +1,58 @@
 package handlers
 
 import (
+	"errors"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
 	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
 )
 
 type ItemHandler struct {
-	DBService   *services.DBService
-	NATSService *services.NATSService
+	DBService       *services.DBService
+	NATSService     *services.NATSService
+	CurrencyService *services.CurrencyService
+	BulkItemService *services.BulkItemService
+}
+
+func NewItemHandler(dbService *services.DBService, natsService *services.NATSService, currencyService *services.CurrencyService,
+	bulkItemService *services.BulkItemService) *ItemHandler {
+	return &ItemHandler{DBService: dbService, NATSService: natsService, CurrencyService: currencyService, BulkItemService: bulkItemService}
+}
+
+var errInvalidItemID = apperr.Invalid("invalid_item_id", "Invalid item ID")
+
+// parseItemID reads the item ID from the path
+func parseItemID(c *gin.Context) (uint64, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, errInvalidItemID
+	}
+	return id, nil
+}
+
+// validatePrice checks the request's currency and that its price has no more decimal
+// places than the currency allows, returning the normalized currency
+func (h *ItemHandler) validatePrice(request *models.ItemRequest) (string, error) {
+	currency, err := h.CurrencyService.ValidatePrice(request.Price, request.Currency)
+	switch {
+	case errors.Is(err, services.ErrUnsupportedCurrency):
+		return "", apperr.Validation(models.FieldError{Field: "currency", Code: "unsupported_currency", Message: err.Error()})
+	case err != nil:
+		return "", apperr.Validation(models.FieldError{Field: "price", Code: "too_precise", Message: err.Error()})
+	}
+	return currency, nil
 }
 
-func NewItemHandler(dbService *services.DBService, natsService *services.NATSService) *ItemHandler {
-	return &ItemHandler{DBService: dbService, NATSService: natsService}
+// convertPrices converts the items' prices into the currency requested with the
+// "currency" query parameter, if any
+func (h *ItemHandler) convertPrices(c *gin.Context, items []models.ItemResponse) error {
+	currency := c.Query("currency")
+	if currency == "" {
+		return nil
+	}
+	return h.CurrencyService.ConvertItems(c.Request.Context(), items, currency)
 }
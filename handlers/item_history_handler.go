@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Security BearerAuth
+// GetItemHistory godoc
+// @Summary Get an item's history
+// @Description Returns every recorded version of the item, newest first. Admin only. Deleted items keep their history, the last version of a deleted item has the change "deleted"
+// @Tags items
+// @Produce json
+// @Param id path string true "Item ID"
+// @Param currency query string false "ISO 4217 currency to convert prices into"
+// @Success 200 {array} models.ItemVersion "Item versions"
+// @Failure 400 {object} apperr.Problem "Invalid item ID or currency"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/{id}/history [get]
+func (h *ItemHandler) GetItemHistory(c *gin.Context) error {
+	itemID, err := parseItemID(c)
+	if err != nil {
+		return err
+	}
+
+	versions, err := h.DBService.GetItemVersions(c.Request.Context(), itemID)
+	if err != nil {
+		return apperr.Internal("Failed to fetch item history", err)
+	}
+	if len(versions) == 0 {
+		return services.ErrItemNotFound
+	}
+
+	if currency := c.Query("currency"); currency != "" {
+		for i := range versions {
+			items := []models.ItemResponse{versions[i].ItemResponse}
+			if err := h.CurrencyService.ConvertItems(c.Request.Context(), items, currency); err != nil {
+				return apperr.Wrap(err, "Failed to convert prices")
+			}
+			versions[i].ItemResponse = items[0]
+		}
+	}
+
+	c.JSON(http.StatusOK, versions)
+	return nil
+}
+
+// @Security BearerAuth
+// GetItemDiff godoc
+// @Summary Compare two versions of an item
+// @Description Returns the fields that changed between two versions of the item, in their stored currency. Admin only
+// @Tags items
+// @Produce json
+// @Param id path string true "Item ID"
+// @Param from query int true "Older version"
+// @Param to query int true "Newer version"
+// @Success 200 {object} models.ItemDiff "Changed fields"
+// @Failure 400 {object} apperr.Problem "Invalid item ID or version"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Item version not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/{id}/history/diff [get]
+func (h *ItemHandler) GetItemDiff(c *gin.Context) error {
+	itemID, err := parseItemID(c)
+	if err != nil {
+		return err
+	}
+	from, err := strconv.ParseUint(c.Query("from"), 10, 32)
+	if err != nil || from == 0 {
+		return invalidQuery("from")
+	}
+	to, err := strconv.ParseUint(c.Query("to"), 10, 32)
+	if err != nil || to == 0 {
+		return invalidQuery("to")
+	}
+
+	older, err := h.DBService.GetItemVersion(c.Request.Context(), itemID, uint32(from))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch item version")
+	}
+	newer, err := h.DBService.GetItemVersion(c.Request.Context(), itemID, uint32(to))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch item version")
+	}
+
+	c.JSON(http.StatusOK, models.ItemDiff{
+		ItemID:  itemID,
+		From:    older.Version,
+		To:      newer.Version,
+		Changes: models.DiffItems(older.ItemResponse, newer.ItemResponse),
+	})
+	return nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-clickhouse-example/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Security BearerAuth
+// GetTrashedItems godoc
+// @Summary List deleted items
+// @Description Returns the items in the trash, most recently deleted first. Items are purged once they have been in the trash for the configured retention period. Admin only
+// @Tags items
+// @Produce json
+// @Success 200 {array} models.ItemResponse "Deleted items"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/trash [get]
+func (h *ItemHandler) GetTrashedItems(c *gin.Context) error {
+	items, err := h.DBService.GetTrashedItems(c.Request.Context())
+	if err != nil {
+		return apperr.Internal("Failed to fetch deleted items", err)
+	}
+	c.JSON(http.StatusOK, items)
+	return nil
+}
+
+// @Security BearerAuth
+// RestoreItem godoc
+// @Summary Restore a deleted item
+// @Description Takes an item out of the trash and publishes it to NATS. Admin only
+// @Tags items
+// @Produce json
+// @Param id path string true "Item ID"
+// @Success 200 {object} models.ItemResponse "Restored item"
+// @Failure 400 {object} apperr.Problem "Invalid item ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Item not in the trash"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/{id}/restore [post]
+func (h *ItemHandler) RestoreItem(c *gin.Context) error {
+	itemID, err := parseItemID(c)
+	if err != nil {
+		return err
+	}
+
+	item, err := h.DBService.RestoreItem(c.Request.Context(), itemID, c.MustGet("user_id").(uint64))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to restore item")
+	}
+
+	if err := h.NATSService.PublishItem(c.Request.Context(), item); err != nil {
+		return apperr.Internal("Failed to publish item to NATS", err)
+	}
+
+	c.JSON(http.StatusOK, item)
+	return nil
+}
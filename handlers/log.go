@@ -0,0 +1,6 @@
+package handlers
+
+import "go-clickhouse-example/logging"
+
+// logger writes the package's logs, at the level configured for "handlers"
+var logger = logging.For("handlers")
@@ -0,0 +1,176 @@
+// handlers/mfa_handler.go
+package handlers
+
+import (
+	"net/http"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/config"
+	"go-clickhouse-example/middleware"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+	"go-clickhouse-example/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler handles multi-factor authentication requests
+type MFAHandler struct {
+	MFAService     *services.MFAService
+	SessionService *services.SessionService
+	Session        config.SessionConfig
+}
+
+// NewMFAHandler creates a new MFAHandler instance
+func NewMFAHandler(mfaService *services.MFAService, sessionService *services.SessionService, session config.SessionConfig) *MFAHandler {
+	return &MFAHandler{MFAService: mfaService, SessionService: sessionService, Session: session}
+}
+
+// @Security BearerAuth
+// EnrollTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generates a TOTP secret and an otpauth:// provisioning URI to render as a QR code. MFA is not active until confirmed with /mfa/totp/activate
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} models.TOTPEnrollResponse "TOTP secret and provisioning URI"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 409 {object} apperr.Problem "MFA already enabled"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /mfa/totp/enroll [post]
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	enrollment, err := h.MFAService.Enroll(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+	return nil
+}
+
+// @Security BearerAuth
+// ActivateTOTP godoc
+// @Summary Activate TOTP
+// @Description Confirms enrollment with a code from the authenticator app, enables MFA and returns single-use recovery codes
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body models.TOTPCodeRequest true "TOTP code"
+// @Success 200 {object} models.RecoveryCodesResponse "Recovery codes, shown only once"
+// @Failure 400 {object} apperr.Problem "Invalid input or enrollment not started"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 401 {object} apperr.Problem "Invalid code"
+// @Failure 409 {object} apperr.Problem "MFA already enabled"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /mfa/totp/activate [post]
+func (h *MFAHandler) ActivateTOTP(c *gin.Context) error {
+	var request models.TOTPCodeRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	userID := c.MustGet("user_id").(uint64)
+	codes, err := h.MFAService.Activate(c.Request.Context(), userID, request.Code)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+	return nil
+}
+
+// @Security BearerAuth
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Invalidates all existing recovery codes and returns new ones
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body models.TOTPCodeRequest true "TOTP code"
+// @Success 200 {object} models.RecoveryCodesResponse "Recovery codes, shown only once"
+// @Failure 400 {object} apperr.Problem "Invalid input or MFA not enabled"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 401 {object} apperr.Problem "Invalid code"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /mfa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) error {
+	var request models.TOTPCodeRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	userID := c.MustGet("user_id").(uint64)
+	codes, err := h.MFAService.RegenerateRecoveryCodes(c.Request.Context(), userID, request.Code)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+	return nil
+}
+
+// @Security BearerAuth
+// DisableTOTP godoc
+// @Summary Disable TOTP
+// @Description Turns off MFA for the current user and deletes the recovery codes
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body models.TOTPCodeRequest true "TOTP code"
+// @Success 200 {object} map[string]string "MFA disabled"
+// @Failure 400 {object} apperr.Problem "Invalid input or MFA not enabled"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 401 {object} apperr.Problem "Invalid code"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /mfa/totp/disable [post]
+func (h *MFAHandler) DisableTOTP(c *gin.Context) error {
+	var request models.TOTPCodeRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	userID := c.MustGet("user_id").(uint64)
+	if err := h.MFAService.Disable(c.Request.Context(), userID, request.Code); err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+	return nil
+}
+
+// LoginMFA godoc
+// @Summary Complete MFA login
+// @Description Exchanges the MFA challenge token from /login and a TOTP or recovery code for a JWT token, or sets the session cookie in cookie session mode
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFALoginRequest true "MFA challenge and code"
+// @Success 200 {object} models.LoginResponse "JWT token"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 429 {object} apperr.Problem "Too many invalid codes"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /login/mfa [post]
+func (h *MFAHandler) LoginMFA(c *gin.Context) error {
+	var request models.MFALoginRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	user, err := h.MFAService.VerifyLogin(c.Request.Context(), request.MFAToken, request.Code, request.RecoveryCode)
+	if err != nil {
+		middleware.RecordAuthFailure(err)
+		return apperr.Wrap(err, "Failed to verify MFA login")
+	}
+
+	// Start a session and generate JWT token recording that both factors were used
+	response, err := issueToken(c, h.SessionService, h.Session, user, utils.AMRPassword, utils.AMROTP)
+	if err != nil {
+		return apperr.Internal("Could not generate token", err)
+	}
+
+	c.JSON(http.StatusOK, response)
+	return nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SavedSearchHandler handles the saved searches of the current user
+type SavedSearchHandler struct {
+	SavedSearchService *services.SavedSearchService
+}
+
+// NewSavedSearchHandler creates a new SavedSearchHandler instance
+func NewSavedSearchHandler(savedSearchService *services.SavedSearchService) *SavedSearchHandler {
+	return &SavedSearchHandler{SavedSearchService: savedSearchService}
+}
+
+// @Security BearerAuth
+// ListMySavedSearches godoc
+// @Summary List saved searches
+// @Description Lists the current user's saved searches, oldest first
+// @Tags saved-searches
+// @Produce json
+// @Success 200 {array} models.SavedSearch "Saved searches"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/saved-searches [get]
+func (h *SavedSearchHandler) ListMySavedSearches(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	searches, err := h.SavedSearchService.List(c.Request.Context(), userID)
+	if err != nil {
+		return apperr.Internal("Failed to fetch saved searches", err)
+	}
+
+	c.JSON(http.StatusOK, searches)
+	return nil
+}
+
+// @Security BearerAuth
+// CreateSavedSearch godoc
+// @Summary Save a search
+// @Description Saves a filter expression such as "tag=clearance AND price<20". Fields are tag, category, currency and sku (= !=), price (= != < <= > >=), name (= != ~) and text (~); conditions combine with AND, OR, NOT and parentheses. Items created or changed afterwards that match are published once per search on the user's NATS subject (<subject>.saved_searches.<user_id>) and posted to the webhook if one is set
+// @Tags saved-searches
+// @Accept json
+// @Produce json
+// @Param search body models.SavedSearchRequest true "Saved search"
+// @Success 201 {object} models.SavedSearch "Saved search"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 409 {object} apperr.Problem "Too many saved searches"
+// @Failure 422 {object} apperr.Problem "Validation failed"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/saved-searches [post]
+func (h *SavedSearchHandler) CreateSavedSearch(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	var request models.SavedSearchRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	search, err := h.SavedSearchService.Create(c.Request.Context(), userID, request)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to save search")
+	}
+
+	c.JSON(http.StatusCreated, search)
+	return nil
+}
+
+// @Security BearerAuth
+// GetSavedSearch godoc
+// @Summary Get a saved search
+// @Description Returns one of the current user's saved searches
+// @Tags saved-searches
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Success 200 {object} models.SavedSearch "Saved search"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 404 {object} apperr.Problem "Saved search not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/saved-searches/{id} [get]
+func (h *SavedSearchHandler) GetSavedSearch(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	search, err := h.SavedSearchService.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch saved search")
+	}
+
+	c.JSON(http.StatusOK, search)
+	return nil
+}
+
+// @Security BearerAuth
+// UpdateSavedSearch godoc
+// @Summary Update a saved search
+// @Description Replaces the name, expression and webhook of one of the current user's saved searches. Only items created or changed afterwards are matched against it
+// @Tags saved-searches
+// @Accept json
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Param search body models.SavedSearchRequest true "Saved search"
+// @Success 200 {object} models.SavedSearch "Saved search"
+// @Failure 400 {object} apperr.Problem "Invalid input"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 404 {object} apperr.Problem "Saved search not found"
+// @Failure 422 {object} apperr.Problem "Validation failed"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/saved-searches/{id} [put]
+func (h *SavedSearchHandler) UpdateSavedSearch(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	var request models.SavedSearchRequest
+	if err := bindJSON(c, &request); err != nil {
+		return err
+	}
+
+	search, err := h.SavedSearchService.Update(c.Request.Context(), userID, c.Param("id"), request)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to update saved search")
+	}
+
+	c.JSON(http.StatusOK, search)
+	return nil
+}
+
+// @Security BearerAuth
+// DeleteSavedSearch godoc
+// @Summary Delete a saved search
+// @Description Deletes one of the current user's saved searches, stopping its notifications
+// @Tags saved-searches
+// @Produce json
+// @Param id path string true "Saved search ID"
+// @Success 200 {object} map[string]string "Saved search deleted"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 404 {object} apperr.Problem "Saved search not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/saved-searches/{id} [delete]
+func (h *SavedSearchHandler) DeleteSavedSearch(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	if err := h.SavedSearchService.Delete(c.Request.Context(), userID, c.Param("id")); err != nil {
+		return apperr.Wrap(err, "Failed to delete saved search")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved search deleted"})
+	return nil
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
+	"go-clickhouse-example/apperr"
 	"go-clickhouse-example/models"
 
 	"github.com/gin-gonic/gin"
@@ -14,84 +16,154 @@ import (
 
 // SearchItems handles the search, filter, and sorting functionality with pagination
 // @Summary Search, filter, and sort items with pagination
-// @Description Searches, filters, sorts, and paginates items based on query parameters
+// @Description Searches, filters, sorts, and paginates items based on query parameters. Items found by a search query come with their relevance score and the fragments of their name and description that matched, HTML-escaped with matches wrapped in <em> tags. Requested facets are counted in a single query; the counts of each facet, except tags, ignore the facet's own filter, and facets without any match are omitted. Admin only
 // @Tags Items
 // @Accept json
 // @Produce json
-// @Param search query string false "Search query"
-// @Param min_price query float64 false "Minimum price"
-// @Param max_price query float64 false "Maximum price"
-// @Param sort_by query string false "Sort by field (e.g., price, name)"
+// @Param search query string false "Search query, matched against name and description. Words must all match, OR separates alternatives"
+// @Param fuzzy query bool false "Also match name words with a typo or two"
+// @Param min_price query string false "Minimum price, in each item's own currency"
+// @Param max_price query string false "Maximum price, in each item's own currency"
+// @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match items of the category's descendants"
+// @Param tags query string false "Comma separated tags, items must have all of them"
+// @Param sku query string false "Exact SKU"
+// @Param sort_by query string false "Sort by field (e.g., price, name, created_at) or relevance, the default when searching"
 // @Param sort_order query string false "Sort order (ASC or DESC)"
 // @Param page query int false "Page number (default is 1)"
 // @Param limit query int false "Items per page (default is 10)"
+// @Param currency query string false "ISO 4217 currency to convert prices into"
+// @Param facets query string false "Comma separated facets to count: category, tags, price_range"
+// @Param price_ranges query string false "Comma separated ascending bounds of the price_range facet (default 10,25,50,100,250,500,1000)"
 // @Security BearerAuth
-// @Success 200 {object} map[string]interface{} "List of items with pagination metadata"
-// @Failure 400 {object} map[string]interface{} "Invalid request"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Success 200 {object} map[string]interface{} "List of items with pagination metadata, and the facet counts when requested"
+// @Failure 400 {object} apperr.Problem "Invalid request"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /items/search [get]
-func (h *ItemHandler) SearchItems(c *gin.Context) {
-	// Get search parameters from the query string
-	searchQuery := c.DefaultQuery("search", "")
-	minPrice := c.DefaultQuery("min_price", "0")
-	maxPrice := c.DefaultQuery("max_price", "100000")
-	sortBy := c.DefaultQuery("sort_by", "price")
-	sortOrder := c.DefaultQuery("sort_order", "ASC")
+func (h *ItemHandler) SearchItems(c *gin.Context) error {
+	filter, err := parseItemFilter(c)
+	if err != nil {
+		return err
+	}
 
-	// Validate sortOrder to prevent SQL injection
-	if sortOrder != "ASC" && sortOrder != "DESC" {
-		sortOrder = "ASC" // Default to ASC if invalid
+	facets, bounds, err := parseFacets(c)
+	if err != nil {
+		return err
 	}
 
-	// Validate sortBy to ensure it's a valid column
-	validSortBy := map[string]bool{
-		"id":    true,
-		"name":  true,
-		"price": true,
+	// Execute the query
+	items, total, err := h.DBService.SearchItems(c.Request.Context(), filter)
+	if err != nil {
+		return apperr.Internal("Failed to search items", err)
 	}
-	if !validSortBy[sortBy] {
-		sortBy = "price" // Default to "price" if invalid
+	if items == nil {
+		items = []models.ItemResponse{}
+	}
+	if query := models.ParseSearchQuery(filter.Search); len(query) > 0 {
+		for i := range items {
+			items[i].Highlights = query.Highlight(items[i], filter.Fuzzy)
+		}
+	}
+	if err := h.convertPrices(c, items); err != nil {
+		return apperr.Wrap(err, "Failed to convert prices")
 	}
 
-	// Build the SQL query dynamically
-	query := "SELECT id, name, price FROM items WHERE 1=1"
-	params := []interface{}{}
-
-	// Add full-text search conditions if a search query is provided
-	if searchQuery != "" {
-		query += " AND (positionCaseInsensitive(name, ?) > 0)"
-		params = append(params, searchQuery)
+	response := gin.H{
+		"items": items,
+		"page":  filter.Page,
+		"limit": filter.Limit,
+		"total": total,
+	}
+	if len(facets) > 0 {
+		counts, err := h.DBService.GetItemFacets(c.Request.Context(), filter, facets, bounds)
+		if err != nil {
+			return apperr.Internal("Failed to count facets", err)
+		}
+		response["facets"] = counts
 	}
 
-	// Add price filtering
-	query += " AND price BETWEEN ? AND ?"
-	params = append(params, minPrice, maxPrice)
+	c.JSON(http.StatusOK, response)
+	return nil
+}
 
-	// Add sorting
-	query += fmt.Sprintf(" ORDER BY %s %s", sortBy, sortOrder)
+// defaultPriceRanges are the price range facet bounds used when price_ranges is not set
+const defaultPriceRanges = "10,25,50,100,250,500,1000"
+
+// parseFacets reads the requested facets and the price range facet bounds
+func parseFacets(c *gin.Context) ([]string, []models.Money, error) {
+	var facets []string
+	for _, facet := range strings.Split(c.Query("facets"), ",") {
+		switch facet = strings.TrimSpace(facet); facet {
+		case "":
+		case models.FacetCategory, models.FacetTags, models.FacetPriceRange:
+			if !slices.Contains(facets, facet) {
+				facets = append(facets, facet)
+			}
+		default:
+			return nil, nil, invalidQuery("facets")
+		}
+	}
 
-	// Execute the query
-	rows, err := h.DBService.Query(query, params...)
+	bounds, err := parsePriceBounds(c.DefaultQuery("price_ranges", defaultPriceRanges))
 	if err != nil {
-		log.Printf("Error executing query: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
+		return nil, nil, invalidQuery("price_ranges")
 	}
-	defer rows.Close()
+	return facets, bounds, nil
+}
 
-	// Parse the result and return the items
-	var items []models.ItemResponse
-	for rows.Next() {
-		var item models.ItemResponse
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-			return
+// invalidQuery returns the error for an invalid query parameter
+func invalidQuery(name string) error {
+	return apperr.Invalid("invalid_query_parameter", "invalid "+name)
+}
+
+// parseItemFilter reads the search, filter, sorting and pagination query parameters
+func parseItemFilter(c *gin.Context) (models.ItemFilter, error) {
+	// Get search parameters from the query string
+	filter := models.ItemFilter{
+		Search:    c.DefaultQuery("search", ""),
+		SKU:       c.DefaultQuery("sku", ""),
+		SortBy:    c.DefaultQuery("sort_by", "price"),
+		SortOrder: strings.ToUpper(c.DefaultQuery("sort_order", "ASC")),
+	}
+	// Searches are sorted by relevance unless asked otherwise
+	if _, ok := c.GetQuery("sort_by"); !ok && filter.Search != "" {
+		filter.SortBy = "relevance"
+	}
+	if len(models.ParseSearchQuery(filter.Search).Terms()) > models.MaxSearchTerms {
+		return filter, apperr.Invalid("invalid_query_parameter", "search can have at most "+strconv.Itoa(models.MaxSearchTerms)+" terms")
+	}
+
+	var err error
+	if filter.Fuzzy, err = strconv.ParseBool(c.DefaultQuery("fuzzy", "false")); err != nil {
+		return filter, invalidQuery("fuzzy")
+	}
+	if filter.MinPrice, err = models.NewMoney(c.DefaultQuery("min_price", "0")); err != nil {
+		return filter, invalidQuery("min_price")
+	}
+	if filter.MaxPrice, err = models.NewMoney(c.DefaultQuery("max_price", "100000")); err != nil {
+		return filter, invalidQuery("max_price")
+	}
+	if filter.CategoryID, err = strconv.ParseUint(c.DefaultQuery("category_id", "0"), 10, 64); err != nil {
+		return filter, invalidQuery("category_id")
+	}
+	if filter.IncludeDescendants, err = strconv.ParseBool(c.DefaultQuery("include_descendants", "false")); err != nil {
+		return filter, invalidQuery("include_descendants")
+	}
+	if filter.Page, err = strconv.Atoi(c.DefaultQuery("page", "1")); err != nil || filter.Page < 1 {
+		return filter, invalidQuery("page")
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "10")); err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+		return filter, invalidQuery("limit")
+	}
+
+	for _, tag := range strings.Split(c.DefaultQuery("tags", ""), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
 		}
-		items = append(items, item)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"items": items})
+	return filter, nil
 }
 
 func (h *ItemHandler) PublishItemSearchResults(c *gin.Context) error {
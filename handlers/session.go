@@ -0,0 +1,37 @@
+// handlers/session.go
+package handlers
+
+import (
+	"go-clickhouse-example/config"
+	"go-clickhouse-example/middleware"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+	"go-clickhouse-example/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// issueToken starts a new session for the user and builds the response carrying the
+// access token. In cookie session mode the token is stored in an HttpOnly cookie
+// instead of the body and the CSRF token for the double-submit check is returned.
+func issueToken(c *gin.Context, sessions *services.SessionService, session config.SessionConfig, user *models.UserResponse, amr ...string) (models.LoginResponse, error) {
+	created, err := sessions.Create(c.Request.Context(), user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	token, err := utils.GenerateJWT(user, created.ID, amr...)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	if !session.CookieMode {
+		return models.LoginResponse{Token: token}, nil
+	}
+
+	csrfToken, err := middleware.SetSessionCookies(c, session, token)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	return models.LoginResponse{CSRFToken: csrfToken}, nil
+}
@@ -0,0 +1,105 @@
+// handlers/session_handler.go
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler handles session listing and sign-out requests
+type SessionHandler struct {
+	SessionService *services.SessionService
+}
+
+// NewSessionHandler creates a new SessionHandler instance
+func NewSessionHandler(sessionService *services.SessionService) *SessionHandler {
+	return &SessionHandler{SessionService: sessionService}
+}
+
+var errInvalidUserID = apperr.Invalid("invalid_user_id", "Invalid user ID")
+
+// parseUserID reads the user ID from the path
+func parseUserID(c *gin.Context) (uint64, error) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return 0, errInvalidUserID
+	}
+	return userID, nil
+}
+
+// @Security BearerAuth
+// ListMySessions godoc
+// @Summary List active sessions
+// @Description Lists the current user's active sessions with device, IP and activity times. The session making the request is marked as current
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} models.Session "Active sessions"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/sessions [get]
+func (h *SessionHandler) ListMySessions(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	sessions, err := h.SessionService.List(c.Request.Context(), userID, c.GetString("session_id"))
+	if err != nil {
+		return apperr.Internal("Failed to fetch sessions", err)
+	}
+
+	c.JSON(http.StatusOK, sessions)
+	return nil
+}
+
+// @Security BearerAuth
+// RevokeMySession godoc
+// @Summary Sign out a session
+// @Description Revokes one of the current user's sessions, signing out the device using it
+// @Tags sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]string "Session revoked"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 404 {object} apperr.Problem "Session not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /me/sessions/{id} [delete]
+func (h *SessionHandler) RevokeMySession(c *gin.Context) error {
+	userID := c.MustGet("user_id").(uint64)
+
+	if err := h.SessionService.Revoke(c.Request.Context(), userID, c.Param("id")); err != nil {
+		return apperr.Wrap(err, "Failed to revoke session")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	return nil
+}
+
+// @Security BearerAuth
+// RevokeUserSessions godoc
+// @Summary Sign out all sessions of a user
+// @Description Revokes every session of the given user, e.g. when the account is compromised. Admin only
+// @Tags sessions
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} map[string]string "Sessions revoked"
+// @Failure 400 {object} apperr.Problem "Invalid user ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /admin/users/{user_id}/sessions [delete]
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) error {
+	userID, err := parseUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.SessionService.RevokeAll(c.Request.Context(), userID); err != nil {
+		return apperr.Internal("Failed to revoke sessions", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked"})
+	return nil
+}
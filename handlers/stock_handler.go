@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StockHandler handles item stock requests
+type StockHandler struct {
+	StockService *services.StockService
+}
+
+// NewStockHandler creates a new StockHandler instance
+func NewStockHandler(stockService *services.StockService) *StockHandler {
+	return &StockHandler{StockService: stockService}
+}
+
+// @Security BearerAuth
+// RecordStockMovement godoc
+// @Summary Record a stock movement
+// @Description Appends a receipt, sale, return or adjustment to the item's stock ledger and publishes it to NATS. Receipts and returns must have a positive delta, sales a negative one. Movements that would make the stock negative are rejected. Admin only
+// @Tags stock
+// @Accept json
+// @Produce json
+// @Param id path string true "Item ID"
+// @Param movement body models.StockMovementRequest true "Stock movement"
+// @Success 201 {object} models.StockMovement "Recorded movement with the resulting balance"
+// @Failure 400 {object} apperr.Problem "Invalid input or item ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 409 {object} apperr.Problem "Not enough stock"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/{id}/stock [post]
+func (h *StockHandler) RecordStockMovement(c *gin.Context) error {
+	itemID, err := parseItemID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.StockMovementRequest
+	if err := bindJSON(c, &req); err != nil {
+		return err
+	}
+
+	movement, err := h.StockService.Record(c.Request.Context(), itemID, req, c.MustGet("user_id").(uint64))
+	if err != nil {
+		return apperr.Wrap(err, "Failed to record stock movement")
+	}
+	c.JSON(http.StatusCreated, movement)
+	return nil
+}
+
+// @Security BearerAuth
+// GetStockLevel godoc
+// @Summary Get an item's stock
+// @Description Returns the current stock of the item. Admin only
+// @Tags stock
+// @Produce json
+// @Param id path string true "Item ID"
+// @Success 200 {object} models.StockLevel "Current stock"
+// @Failure 400 {object} apperr.Problem "Invalid item ID"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/{id}/stock [get]
+func (h *StockHandler) GetStockLevel(c *gin.Context) error {
+	itemID, err := parseItemID(c)
+	if err != nil {
+		return err
+	}
+
+	level, err := h.StockService.Level(c.Request.Context(), itemID)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch stock")
+	}
+	c.JSON(http.StatusOK, level)
+	return nil
+}
+
+// @Security BearerAuth
+// GetStockHistory godoc
+// @Summary Get an item's stock history
+// @Description Returns the item's most recent stock movements, newest first, each with the balance right after it. Admin only
+// @Tags stock
+// @Produce json
+// @Param id path string true "Item ID"
+// @Param limit query int false "Maximum number of movements (default is 100)"
+// @Success 200 {array} models.StockMovement "Stock movements"
+// @Failure 400 {object} apperr.Problem "Invalid item ID or limit"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 500 {object} apperr.Problem "Internal server error"
+// @Router /items/{id}/stock/history [get]
+func (h *StockHandler) GetStockHistory(c *gin.Context) error {
+	itemID, err := parseItemID(c)
+	if err != nil {
+		return err
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		return invalidQuery("limit")
+	}
+
+	movements, err := h.StockService.History(c.Request.Context(), itemID, limit)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch stock history")
+	}
+	c.JSON(http.StatusOK, movements)
+	return nil
+}
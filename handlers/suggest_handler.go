@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SuggestHandler handles search box suggestion requests
+type SuggestHandler struct {
+	SuggestService *services.SuggestService
+}
+
+// NewSuggestHandler creates a new SuggestHandler instance
+func NewSuggestHandler(suggestService *services.SuggestService) *SuggestHandler {
+	return &SuggestHandler{SuggestService: suggestService}
+}
+
+// @Security BearerAuth
+// SuggestItems godoc
+// @Summary Suggest items for a search box
+// @Description Returns the items with a word of their name starting with the prefix, most sold first. Suggestions are served from memory and follow item changes through the NATS stream. Admin only
+// @Tags Items
+// @Produce json
+// @Param q query string true "Prefix typed so far"
+// @Param limit query int false "Number of suggestions (default 10, at most 20)"
+// @Success 200 {object} map[string][]models.Suggestion "Suggestions"
+// @Failure 400 {object} apperr.Problem "Invalid query parameter"
+// @Failure 401 {object} apperr.Problem "Unauthorized"
+// @Failure 403 {object} apperr.Problem "Forbidden"
+// @Router /items/suggest [get]
+func (h *SuggestHandler) SuggestItems(c *gin.Context) error {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > services.MaxSuggestions {
+		return invalidQuery("limit")
+	}
+
+	suggestions := h.SuggestService.Suggest(c.Query("q"), limit)
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	return nil
+}
@@ -1,11 +1,9 @@
 package handlers
 
 import (
+	"go-clickhouse-example/apperr"
 	"go-clickhouse-example/models"
-	"go-clickhouse-example/utils"
 	"net/http"
-	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,67 +18,63 @@ import (
 // @Param id path string true "Item ID"
 // @Param item body models.ItemRequest true "Updated item details"
 // @Success 200 {object} map[string]string "Item updated successfully"
-// @Failure 400 {object} map[string]string "Invalid input or item ID"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 400 {object} apperr.Problem "Invalid input or item ID"
+// @Failure 422 {object} apperr.Problem "Invalid fields"
+// @Failure 404 {object} apperr.Problem "Item not found"
+// @Failure 409 {object} apperr.Problem "SKU already in use"
+// @Failure 500 {object} apperr.Problem "Internal server error"
 // @Router /items/{id} [put]
-func (h *ItemHandler) UpdateItem(c *gin.Context) {
-	// Extract token from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-		return
-	}
+func (h *ItemHandler) UpdateItem(c *gin.Context) error {
+	// AuthMiddleware has already validated the token and stored the user's role
+	role := c.GetString("role")
 
-	// Ensure the token is prefixed with "Bearer "
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		return
+	// Check user role for access control (optional)
+	if role != "admin" {
+		return apperr.Forbidden(apperr.CodeForbidden, "You don't have permission to update this item")
 	}
 
-	// Now the tokenString is the actual JWT token
-	// Parse and validate the JWT token
-	user, err := utils.ParseJWT(tokenString)
+	// Get the item ID from the path
+	itemID, err := parseItemID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
+		return err
 	}
 
-	// Check user role for access control (optional)
-	if user.Role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to update this item"})
-		return
+	// Bind the updated item details from the request body
+	var itemRequest models.ItemRequest
+	if err := bindJSON(c, &itemRequest); err != nil {
+		return err
 	}
-
-	// Get the item ID from the path
-	id := c.Param("id")
-	itemID, err := strconv.ParseUint(id, 10, 64)
+	currency, err := h.validatePrice(&itemRequest)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
-		return
+		return err
 	}
 
-	// Bind the updated item details from the request body
-	var item models.ItemResponse
-	if err := c.ShouldBindJSON(&item); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-		return
+	// Retrieve the current item, its creation fields are kept
+	item, err := h.DBService.GetItemByID(c.Request.Context(), itemID)
+	if err != nil {
+		return apperr.Wrap(err, "Failed to fetch item")
 	}
 
+	item.Name = itemRequest.Name
+	item.Description = itemRequest.Description
+	item.SKU = itemRequest.SKU
+	item.CategoryID = itemRequest.CategoryID
+	item.Tags = itemRequest.Tags
+	item.Price = itemRequest.Price
+	item.Currency = currency
+	item.UpdatedBy = c.MustGet("user_id").(uint64)
+
 	// Update the item in the database
-	err = h.DBService.UpdateItem(itemID, item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
-		return
+	if err := h.DBService.UpdateItem(c.Request.Context(), itemID, &item); err != nil {
+		return apperr.Wrap(err, "Failed to update item")
 	}
 
 	// Publish the updated item to NATS
-	err = h.NATSService.PublishItem(item)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish item to NATS"})
-		return
+	if err := h.NATSService.PublishItem(c.Request.Context(), item); err != nil {
+		return apperr.Internal("Failed to publish item to NATS", err)
 	}
 
 	// Return success message
 	c.JSON(http.StatusOK, gin.H{"message": "Item updated successfully"})
+	return nil
 }
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidInput is returned for request bodies that are not valid JSON
+var errInvalidInput = apperr.Invalid(apperr.CodeInvalidInput, "Invalid input")
+
+// bindJSON binds the request body into obj and runs its binding rules. It returns a
+// 400 error for malformed JSON or a 422 error listing the invalid fields.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return nil
+	}
+
+	if fields := validation.FieldErrors(err); fields != nil {
+		return apperr.Validation(fields...)
+	}
+	return errInvalidInput
+}
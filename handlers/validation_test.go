@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := validation.Register(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestBindJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantFields []string
+	}{
+		{"valid", `{"name": "Widget", "price": "19.99"}`, 0, "", nil},
+		{"malformed JSON", `{"name": `, http.StatusBadRequest, apperr.CodeInvalidInput, nil},
+		{"wrong type", `{"name": 42}`, http.StatusBadRequest, apperr.CodeInvalidInput, nil},
+		{"invalid price", `{"name": "Widget", "price": "abc"}`, http.StatusBadRequest, apperr.CodeInvalidInput, nil},
+		{"empty body", ``, http.StatusBadRequest, apperr.CodeInvalidInput, nil},
+		{"missing field", `{"price": "1"}`, http.StatusUnprocessableEntity, apperr.CodeValidationFailed, []string{"name"}},
+		{"several fields", `{"price": "-1", "tags": ["a", ""], "currency": "EURO"}`,
+			http.StatusUnprocessableEntity, apperr.CodeValidationFailed, []string{"name", "tags[1]", "price", "currency"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			var req models.ItemRequest
+			err := bindJSON(c, &req)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("bindJSON(%s): %v", tt.body, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("bindJSON(%s) succeeded, want %d", tt.body, tt.wantStatus)
+			}
+
+			appErr := apperr.From(err)
+			if appErr.Status() != tt.wantStatus || appErr.Code != tt.wantCode {
+				t.Errorf("bindJSON(%s) = %d %s, want %d %s", tt.body, appErr.Status(), appErr.Code, tt.wantStatus, tt.wantCode)
+			}
+			var fields []string
+			for _, field := range appErr.Fields {
+				fields = append(fields, field.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("bindJSON(%s) fields = %v, want %v", tt.body, fields, tt.wantFields)
+			}
+		})
+	}
+}
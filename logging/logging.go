@@ -0,0 +1,152 @@
+// Package logging configures the structured JSON logs of the application. Each
+// package logs through its own logger, created with For, whose level can be set
+// separately. Log lines carry the request and user IDs found in the context and
+// secrets are redacted before being written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// output is the handler every logger writes through
+	output atomic.Pointer[slog.Handler]
+
+	mu sync.Mutex
+	// level applies to the packages without a level of their own
+	level slog.Level
+	// overrides holds the levels configured per package
+	overrides = map[string]slog.Level{}
+	// levels holds the level of each package a logger was created for
+	levels = map[string]*slog.LevelVar{}
+)
+
+func init() {
+	SetOutput(os.Stdout)
+	slog.SetDefault(For(""))
+}
+
+// SetOutput makes every logger write JSON lines to w
+func SetOutput(w io.Writer) {
+	var handler slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+		// Levels are checked by each package's logger
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redactAttr,
+	})
+	output.Store(&handler)
+}
+
+// Setup sets the default level and the levels of some packages, given as
+// "package=level" such as "services=debug". Levels are debug, info, warn or error.
+func Setup(defaultLevel string, packageLevels []string) error {
+	parsed, err := parseLevel(defaultLevel)
+	if err != nil {
+		return err
+	}
+	parsedOverrides := make(map[string]slog.Level, len(packageLevels))
+	for _, entry := range packageLevels {
+		pkg, value, ok := strings.Cut(entry, "=")
+		if !ok || pkg == "" {
+			return fmt.Errorf("invalid package log level %q, expected package=level", entry)
+		}
+		if parsedOverrides[pkg], err = parseLevel(value); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	level, overrides = parsed, parsedOverrides
+	for pkg, levelVar := range levels {
+		levelVar.Set(packageLevel(pkg))
+	}
+	return nil
+}
+
+func parseLevel(value string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", value)
+	}
+	return l, nil
+}
+
+// packageLevel returns the configured level of a package. The caller must hold mu.
+func packageLevel(pkg string) slog.Level {
+	if l, ok := overrides[pkg]; ok {
+		return l
+	}
+	return level
+}
+
+// For returns the logger of a package. Its lines have a "package" attribute and
+// are written if at or above the package's level. Loggers may be created before
+// Setup is called, e.g. in package variables.
+func For(pkg string) *slog.Logger {
+	mu.Lock()
+	levelVar, ok := levels[pkg]
+	if !ok {
+		levelVar = new(slog.LevelVar)
+		levelVar.Set(packageLevel(pkg))
+		levels[pkg] = levelVar
+	}
+	mu.Unlock()
+
+	return slog.New(&packageHandler{pkg: pkg, level: levelVar})
+}
+
+// Fatal logs an error and exits
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// packageHandler writes a package's records through the current output, adding
+// the package name and the IDs found in the record's context
+type packageHandler struct {
+	pkg   string
+	level *slog.LevelVar
+	// with replays the WithAttrs and WithGroup calls made on the logger
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h *packageHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *packageHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := *output.Load()
+	if attrs := contextAttrs(ctx); len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	if h.pkg != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("package", h.pkg)})
+	}
+	for _, with := range h.with {
+		handler = with(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.extend(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	return h.extend(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *packageHandler) extend(with func(slog.Handler) slog.Handler) slog.Handler {
+	return &packageHandler{
+		pkg:   h.pkg,
+		level: h.level,
+		with:  append(h.with[:len(h.with):len(h.with)], with),
+	}
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in log lines
+const Redacted = "[REDACTED]"
+
+// secretKeys are parts of attribute names whose values are always redacted
+var secretKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie",
+	"api_key", "apikey", "private_key", "credential", "totp", "recovery_code",
+}
+
+// secretPatterns find secrets within logged strings, such as error messages
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// JSON web tokens
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Redacted},
+	// Authorization header values
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + Redacted},
+	// Passwords in URLs such as DSNs
+	{regexp.MustCompile(`(://[^:/@\s]+):[^@\s]+@`), "$1:" + Redacted + "@"},
+}
+
+// redactAttr is the ReplaceAttr of the JSON handler. It redacts the values of
+// secret attributes and the secrets found in messages, strings and errors.
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	if isSecretKey(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, RedactString(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, RedactString(err.Error()))
+		}
+	}
+	return attr
+}
+
+// isSecretKey reports whether the key names a secret. Dashes match underscores, so
+// header names such as "X-Api-Key" are found as well.
+func isSecretKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString replaces the secrets found in s
+func RedactString(s string) string {
+	for _, secret := range secretPatterns {
+		s = secret.pattern.ReplaceAllString(s, secret.replacement)
+	}
+	return s
+}
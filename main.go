@@ -1,12 +1,15 @@
 package main
 
 import (
-	"log"
+	"context"
 	"net/http"
 
 	"go-clickhouse-example/config"
 	_ "go-clickhouse-example/docs"
+	"go-clickhouse-example/logging"
+	"go-clickhouse-example/middleware"
 	"go-clickhouse-example/routes"
+	"go-clickhouse-example/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/cors"
@@ -24,6 +27,23 @@ func main() {
 	// Load configuration (e.g., server port)
 	cfg := config.LoadConfig()
 
+	// Write JSON logs at the configured levels
+	logger := logging.For("main")
+	if err := logging.Setup(cfg.LogLevel, cfg.LogLevels); err != nil {
+		logging.Fatal(logger, "Invalid log configuration", "error", err)
+	}
+
+	// Export the traces of requests, queries and messages
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logging.Fatal(logger, "Failed to set up tracing", "error", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
 	// Create a new Gin router
 	router := routes.SetupRouter()
 
@@ -32,8 +52,8 @@ func main() {
 		AllowedOrigins:   []string{"http://localhost:3000"}, // Allow your frontend URL
 		AllowCredentials: true,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
-		ExposedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", cfg.Session.CSRFHeaderName, middleware.RequestIDHeader},
+		ExposedHeaders:   []string{"Content-Type", "Authorization", middleware.ImpersonatedByHeader, middleware.TraceIDHeader, middleware.RequestIDHeader},
 	}).Handler(router)
 
 	// Swagger setup (if you are using Swagger for API docs)
@@ -43,8 +63,8 @@ func main() {
 	})
 
 	// Start the server with CORS handler
-	log.Printf("Starting server on %s", cfg.ServerPort)
+	logger.Info("Starting server", "address", cfg.ServerPort)
 	if err := http.ListenAndServe(cfg.ServerPort, corsHandler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		logging.Fatal(logger, "Failed to start server", "error", err)
 	}
 }
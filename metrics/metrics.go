@@ -0,0 +1,100 @@
+// Package metrics holds the Prometheus metrics of the application and serves
+// them on /metrics. Metrics are registered on a dedicated registry along with the
+// Go runtime and process collectors.
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts handled requests by method, route template and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	// HTTPRequestDuration observes the time taken to handle requests
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	// HTTPRequestsInFlight is the number of requests being handled
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being handled.",
+	})
+
+	// ClickHouseQueryDuration observes ClickHouse queries by the DBService method
+	// making them. Queries returning rows are timed until the rows start streaming.
+	ClickHouseQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "clickhouse_query_duration_seconds",
+		Help:    "Time taken by ClickHouse queries, by operation.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+	// ClickHouseQueryErrors counts the ClickHouse queries that failed
+	ClickHouseQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clickhouse_query_errors_total",
+		Help: "ClickHouse queries that failed, by operation.",
+	}, []string{"operation"})
+
+	// NATSPublishDuration observes the time taken for JetStream to acknowledge
+	// published events
+	NATSPublishDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nats_publish_duration_seconds",
+		Help:    "Time taken to publish events to JetStream, by event.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"event"})
+	// NATSPublishFailures counts the events that could not be published
+	NATSPublishFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nats_publish_failures_total",
+		Help: "Events that could not be published to JetStream, by event.",
+	}, []string{"event"})
+	// NATSReconnects counts the reconnections to the NATS server
+	NATSReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nats_reconnects_total",
+		Help: "Reconnections to the NATS server.",
+	})
+	// NATSDisconnects counts the lost connections to the NATS server
+	NATSDisconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nats_disconnects_total",
+		Help: "Connections to the NATS server that were lost.",
+	})
+
+	// AuthFailures counts rejected logins and rejected tokens by error code, such
+	// as invalid_credentials or invalid_token
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_failures_total",
+		Help: "Failed authentications, by error code.",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration, HTTPRequestsInFlight,
+		ClickHouseQueryDuration, ClickHouseQueryErrors,
+		NATSPublishDuration, NATSPublishFailures, NATSReconnects, NATSDisconnects,
+		AuthFailures,
+	)
+}
+
+// RegisterDBStats exposes the connection pool statistics of a database
+func RegisterDBStats(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() gin.HandlerFunc {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+	return gin.WrapH(handler)
+}
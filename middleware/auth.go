@@ -1,43 +1,93 @@
 package middleware
 
 import (
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/config"
+	"go-clickhouse-example/logging"
+	"go-clickhouse-example/services"
 	"go-clickhouse-example/utils"
-	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware is used to protect routes that require authentication
-func AuthMiddleware() gin.HandlerFunc {
+var (
+	errTokenRequired    = apperr.Unauthorized("token_required", "Authorization token required")
+	errInvalidToken     = apperr.Unauthorized("invalid_token", "Invalid or expired token")
+	errNoSession        = apperr.Unauthorized("no_session", "Token has no session, please log in again")
+	errInvalidCSRFToken = apperr.Forbidden("invalid_csrf_token", "Invalid CSRF token")
+)
+
+// AuthMiddleware is used to protect routes that require authentication.
+// In cookie session mode the token may also come from the session cookie, in which
+// case state-changing requests must carry a valid CSRF token. The session the token
+// belongs to must not have been revoked.
+func AuthMiddleware(sessions *services.SessionService) gin.HandlerFunc {
+	session := config.LoadConfig().Session
+
 	return func(c *gin.Context) {
 		// Get token from the Authorization header
 		tokenString := c.GetHeader("Authorization")
+		fromCookie := false
+
+		// Fall back to the session cookie set by /login
+		if tokenString == "" && session.CookieMode {
+			if cookie, err := c.Cookie(session.CookieName); err == nil && cookie != "" {
+				tokenString = cookie
+				fromCookie = true
+			}
+		}
+
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
-			c.Abort()
+			rejectAuth(c, errTokenRequired)
 			return
 		}
 
 		// Remove the "Bearer " prefix if it exists
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-			c.Abort()
+		if !fromCookie {
+			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+			if tokenString == "" {
+				rejectAuth(c, errInvalidToken)
+				return
+			}
+		}
+
+		// Browsers attach cookies to cross-site requests, so require the double-submit token
+		if fromCookie && isWriteMethod(c.Request.Method) && !validCSRF(c, session) {
+			rejectAuth(c, errInvalidCSRFToken)
 			return
 		}
 
 		// Parse and validate the JWT token
-		user, err := utils.ParseJWT(tokenString)
+		claims, err := utils.ParseJWT(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token in middleware"})
-			c.Abort()
+			rejectAuth(c, errInvalidToken)
+			return
+		}
+
+		// Check that the session has not been signed out remotely
+		if claims.SessionID == "" {
+			rejectAuth(c, errNoSession)
+			return
+		}
+		if err := sessions.Validate(c.Request.Context(), claims.UserID, claims.SessionID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+			rejectAuth(c, apperr.Wrap(err, "Failed to validate session"))
 			return
 		}
 
 		// Set the user info in the context for use in other handlers
-		c.Set("user_id", user.ID)
-		c.Set("role", user.Role)
+		c.Set("user_id", claims.UserID)
+		c.Set("role", claims.Role)
+		c.Set("amr", claims.AMR)
+		c.Set("session_id", claims.SessionID)
+		c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), claims.UserID))
+
+		// Make impersonation visible to the client and to later middleware
+		if claims.IsImpersonated() {
+			c.Set("actor_id", claims.ActorID)
+			c.Header(ImpersonatedByHeader, strconv.FormatUint(claims.ActorID, 10))
+		}
 
 		// Continue to the next handler
 		c.Next()
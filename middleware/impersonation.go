@@ -0,0 +1,55 @@
+// middleware/impersonation.go
+package middleware
+
+import (
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonatedByHeader is set on every response to an impersonated request
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+var errImpersonationDenied = apperr.Forbidden("impersonation_denied", "This action is not allowed while impersonating a user")
+
+// DenyImpersonation blocks user-management routes (credentials, MFA, sessions,
+// further impersonation) for tokens issued through impersonation
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonated := c.Get("actor_id"); impersonated {
+			apperr.Write(c, errImpersonationDenied)
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuditImpersonation records every request made with an impersonation token, with both
+// the admin and the impersonated user. It must wrap the route handlers so that it can
+// read the identities set by AuthMiddleware once the request has been handled.
+func AuditImpersonation(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		actorID, impersonated := c.Get("actor_id")
+		if !impersonated {
+			return
+		}
+
+		audit.Record(c.Request.Context(), models.AuditEntry{
+			Timestamp: time.Now(),
+			ActorID:   actorID.(uint64),
+			SubjectID: c.GetUint64("user_id"),
+			Action:    "request",
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			SessionID: c.GetString("session_id"),
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// middleware/logger.go
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"go-clickhouse-example/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+var logger = logging.For("middleware")
+
+// Logger writes a log line for every request once it is handled. Server errors are
+// logged as errors and client errors as warnings. The query string is left out as
+// it may hold tokens.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(c.Request.Context(), level, "Request handled",
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
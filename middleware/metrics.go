@@ -0,0 +1,52 @@
+// middleware/metrics.go
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels the requests that matched no route, so that arbitrary
+// paths do not create new series
+const unmatchedRoute = "unmatched"
+
+// Metrics records the rate, errors and duration of requests per route template,
+// such as /items/:id
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RecordAuthFailure counts err in the authentication failures if it rejects the
+// caller's credentials, e.g. an invalid password, token or CSRF token, or refuses
+// further attempts
+func RecordAuthFailure(err error) {
+	appErr := apperr.From(err)
+	switch appErr.Kind {
+	case apperr.KindUnauthorized, apperr.KindForbidden, apperr.KindTooManyRequests:
+		metrics.AuthFailures.WithLabelValues(appErr.Code).Inc()
+	}
+}
+
+// rejectAuth writes an authentication error, counting it in the failures
+func rejectAuth(c *gin.Context, err error) {
+	RecordAuthFailure(err)
+	apperr.Write(c, err)
+}
@@ -4,11 +4,18 @@ package middleware
 import (
 	"net/http"
 
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/config"
+	"go-clickhouse-example/utils"
+
 	"github.com/gin-gonic/gin"
 )
 
-// RBACMiddleware is used to restrict access based on user roles
+// RBACMiddleware is used to restrict access based on user roles.
+// Roles listed in MFA_REQUIRED_ROLES must also have completed MFA to use write routes.
 func RBACMiddleware(roles ...string) gin.HandlerFunc {
+	mfaRequiredRoles := config.LoadConfig().MFARequiredRoles
+
 	return func(c *gin.Context) {
 		// Get user role from context
 		role := c.MustGet("role").(string)
@@ -16,13 +23,45 @@ func RBACMiddleware(roles ...string) gin.HandlerFunc {
 		// Check if the user's role is allowed to access this route
 		for _, allowedRole := range roles {
 			if role == allowedRole {
+				if isWriteMethod(c.Request.Method) && containsRole(mfaRequiredRoles, role) && !hasMFA(c) {
+					apperr.Write(c, errMFARequired)
+					return
+				}
 				c.Next()
 				return
 			}
 		}
 
 		// If the user's role is not allowed, return forbidden error
-		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this resource"})
-		c.Abort()
+		apperr.Write(c, errRoleForbidden)
+	}
+}
+
+var (
+	errMFARequired   = apperr.Forbidden("mfa_required", "Multi-factor authentication required")
+	errRoleForbidden = apperr.Forbidden(apperr.CodeForbidden, "You don't have permission to access this resource")
+)
+
+// hasMFA reports whether the token used for this request was issued after a second factor
+func hasMFA(c *gin.Context) bool {
+	amr, _ := c.Get("amr")
+	methods, _ := amr.([]string)
+	return utils.ContainsAMR(methods, utils.AMROTP)
+}
+
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
 	}
+	return false
 }
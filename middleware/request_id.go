@@ -0,0 +1,56 @@
+// middleware/request_id.go
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"go-clickhouse-example/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request, sent by the client or generated
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the gin context key holding the request ID
+	RequestIDKey = "request_id"
+	// maxRequestIDLength bounds the IDs accepted from clients
+	maxRequestIDLength = 128
+)
+
+// RequestID assigns each request an ID, reusing the client's X-Request-ID when it
+// is valid, and returns it in the response. Log lines written with the request's
+// context carry the ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			raw := make([]byte, 16)
+			if _, err := rand.Read(raw); err == nil {
+				requestID = hex.EncodeToString(raw)
+			}
+		}
+
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs made of letters, digits and "-_.:", such as UUIDs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.' || r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+// middleware/session.go
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-clickhouse-example/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetSessionCookies stores the access token in an HttpOnly cookie and issues a new
+// CSRF token in a cookie readable by the frontend. The CSRF token is returned so
+// that it can also be sent in the response body.
+func SetSessionCookies(c *gin.Context, session config.SessionConfig, token string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+	csrfToken := hex.EncodeToString(raw)
+
+	maxAge := int(session.CookieMaxAge.Seconds())
+	c.SetSameSite(sameSiteMode(session.CookieSameSite))
+	c.SetCookie(session.CookieName, token, maxAge, "/", session.CookieDomain, session.CookieSecure, true)
+	c.SetCookie(session.CSRFCookieName, csrfToken, maxAge, "/", session.CookieDomain, session.CookieSecure, false)
+	return csrfToken, nil
+}
+
+// ClearSessionCookies removes the session and CSRF cookies
+func ClearSessionCookies(c *gin.Context, session config.SessionConfig) {
+	c.SetSameSite(sameSiteMode(session.CookieSameSite))
+	c.SetCookie(session.CookieName, "", -1, "/", session.CookieDomain, session.CookieSecure, true)
+	c.SetCookie(session.CSRFCookieName, "", -1, "/", session.CookieDomain, session.CookieSecure, false)
+}
+
+// validCSRF implements the double-submit check: the CSRF header must match the CSRF cookie.
+// A cross-site page can make the browser send the cookies but cannot read them to set the header.
+func validCSRF(c *gin.Context, session config.SessionConfig) bool {
+	cookie, err := c.Cookie(session.CSRFCookieName)
+	if err != nil || cookie == "" {
+		return false
+	}
+	header := c.GetHeader(session.CSRFHeaderName)
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+func sameSiteMode(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
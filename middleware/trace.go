@@ -0,0 +1,76 @@
+// middleware/trace.go
+package middleware
+
+import (
+	"crypto/rand"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDHeader carries the trace ID of every response, so that clients can quote it
+const TraceIDHeader = "X-Trace-ID"
+
+var tracer = tracing.Tracer("middleware")
+
+// Trace starts a server span for each request, continuing the trace of a W3C
+// traceparent header when the caller sent one. The span is stored in the request
+// context so that the queries and messages of the request are traced below it.
+// When tracing is disabled the request still gets a trace ID of its own, which
+// is passed on to NATS messages. Problem details include the ID.
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		spanContext := span.SpanContext()
+		if !spanContext.IsValid() {
+			spanContext = randomSpanContext()
+			ctx = trace.ContextWithSpanContext(ctx, spanContext)
+		}
+		traceID := spanContext.TraceID().String()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(apperr.TraceIDKey, traceID)
+		c.Header(TraceIDHeader, traceID)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+			if err := c.Errors.Last(); err != nil {
+				span.RecordError(err.Err)
+			}
+		}
+	}
+}
+
+// randomSpanContext picks random trace and span IDs
+func randomSpanContext() trace.SpanContext {
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	_, _ = rand.Read(traceID[:])
+	_, _ = rand.Read(spanID[:])
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+}
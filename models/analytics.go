@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+// Groupings of item counts
+const (
+	ItemGroupCategory = "category"
+	ItemGroupTag      = "tag"
+	ItemGroupCurrency = "currency"
+)
+
+// PriceStats summarizes the prices of the items of one currency. Prices of
+// different currencies are never mixed.
+type PriceStats struct {
+	Currency  string          `json:"currency" example:"USD"`
+	Count     uint64          `json:"count" example:"42"`
+	Min       Money           `json:"min" swaggertype:"string" example:"1.5"`
+	Max       Money           `json:"max" swaggertype:"string" example:"999"`
+	Avg       Money           `json:"avg" swaggertype:"string" example:"120.4"`
+	Quantiles []PriceQuantile `json:"quantiles"`
+}
+
+// PriceQuantile is an approximate price quantile, e.g. level 0.9 is the price
+// below which 90% of the items are
+type PriceQuantile struct {
+	Level float64 `json:"level" example:"0.9"`
+	Price Money   `json:"price" swaggertype:"string" example:"350"`
+}
+
+// PriceBucket counts the items of one currency with a price in [From, To).
+// From is omitted for the bucket below the first bound, To for the one above the last.
+type PriceBucket struct {
+	Currency string `json:"currency" example:"USD"`
+	From     *Money `json:"from,omitempty" swaggertype:"string" example:"10"`
+	To       *Money `json:"to,omitempty" swaggertype:"string" example:"20"`
+	Count    uint64 `json:"count" example:"7"`
+}
+
+// ItemCount is the number of items in a group. Key is the category ID, tag or
+// currency, Name is the category's name when grouping by category.
+type ItemCount struct {
+	Key   string `json:"key" example:"3"`
+	Name  string `json:"name,omitempty" example:"Phones"`
+	Count uint64 `json:"count" example:"12"`
+}
+
+// Timeseries metrics. Change counts count item versions, avg_price averages the
+// prices items were created or updated with.
+const (
+	MetricItemsCreated  = "items_created"
+	MetricItemsUpdated  = "items_updated"
+	MetricItemsDeleted  = "items_deleted"
+	MetricItemsRestored = "items_restored"
+	MetricItemChanges   = "item_changes"
+	MetricAvgPrice      = "avg_price"
+)
+
+// Timeseries intervals, each backed by its own rollup table
+const (
+	IntervalMinute = "minute"
+	IntervalHour   = "hour"
+	IntervalDay    = "day"
+)
+
+// Timeseries holds one point per interval in [From, To), including empty intervals
+type Timeseries struct {
+	Metric   string            `json:"metric" example:"items_created"`
+	Interval string            `json:"interval" example:"hour"`
+	Currency string            `json:"currency,omitempty" example:"USD"`
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Points   []TimeseriesPoint `json:"points"`
+}
+
+// TimeseriesPoint is the value of a metric over the interval starting at Timestamp.
+// Averages are null for intervals without any change.
+type TimeseriesPoint struct {
+	Timestamp time.Time `json:"ts"`
+	Value     *float64  `json:"value" example:"4"`
+}
+
+// Search facets
+const (
+	FacetCategory   = "category"
+	FacetTags       = "tags"
+	FacetPriceRange = "price_range"
+)
+
+// ItemFacets holds the number of matching items per value of the requested facets.
+// Each facet's counts ignore the facet's own filter, so that they show what
+// changing it would match, except for tags, which combine with AND and so narrow
+// down the counts of further tags.
+type ItemFacets struct {
+	Category   []ItemCount   `json:"category,omitempty"`
+	Tags       []ItemCount   `json:"tags,omitempty"`
+	PriceRange []PriceBucket `json:"price_range,omitempty"`
+}
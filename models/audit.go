@@ -0,0 +1,25 @@
+// models/audit.go
+package models
+
+import "time"
+
+// AuditEntry records an action performed by ActorID on behalf of SubjectID.
+// For regular requests both IDs are the same user.
+type AuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	ActorID   uint64    `json:"actor_id" example:"1"`
+	SubjectID uint64    `json:"subject_id" example:"42"`
+	Action    string    `json:"action" example:"request"`
+	Method    string    `json:"method" example:"GET"`
+	Path      string    `json:"path" example:"/items/7"`
+	Status    int       `json:"status" example:"200"`
+	IP        string    `json:"ip" example:"203.0.113.7"`
+	SessionID string    `json:"session_id"`
+}
+
+// ImpersonationResponse is returned when an admin starts impersonating a user
+type ImpersonationResponse struct {
+	Token     string        `json:"token"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	User      *UserResponse `json:"user"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Bulk request modes
+const (
+	// BulkModeAtomic writes nothing unless every operation is valid
+	BulkModeAtomic = "atomic"
+	// BulkModeBestEffort writes the valid operations and reports the others
+	BulkModeBestEffort = "best_effort"
+)
+
+// Bulk operations
+const (
+	BulkOpCreate = "create"
+	BulkOpUpdate = "update"
+	BulkOpDelete = "delete"
+)
+
+// BulkItemOperation is one entry of a bulk request. Op defaults to create. Updates
+// and deletes need the item ID, creates and updates need the item fields.
+type BulkItemOperation struct {
+	Op   string       `json:"op" binding:"omitempty,oneof=create update delete" example:"create"`
+	ID   uint64       `json:"id" example:"0"`
+	Item *ItemRequest `json:"item"`
+}
+
+// BulkItemError describes why a bulk operation failed
+type BulkItemError struct {
+	Code    string       `json:"code" example:"duplicate_sku"`
+	Message string       `json:"message" example:"SKU is already used by another item"`
+	Fields  []FieldError `json:"errors,omitempty"`
+}
+
+// BulkItemResult is the outcome of one bulk operation, in request order
+type BulkItemResult struct {
+	Index int    `json:"index" example:"0"`
+	Op    string `json:"op" example:"create"`
+	ID    uint64 `json:"id,omitempty" example:"42"`
+	// Status is "created", "updated", "deleted" or "failed"
+	Status string         `json:"status" example:"created"`
+	Error  *BulkItemError `json:"error,omitempty"`
+}
+
+// BulkItemResponse reports the outcome of every operation of a bulk request
+type BulkItemResponse struct {
+	Mode      string           `json:"mode" example:"best_effort"`
+	Total     int              `json:"total" example:"2"`
+	Succeeded int              `json:"succeeded" example:"1"`
+	Failed    int              `json:"failed" example:"1"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// BulkItemEvent is published once per bulk request with the IDs of the changed items
+type BulkItemEvent struct {
+	Created   []uint64  `json:"created"`
+	Updated   []uint64  `json:"updated"`
+	Deleted   []uint64  `json:"deleted"`
+	ActorID   uint64    `json:"actor_id"`
+	Timestamp time.Time `json:"ts"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Category is a node of the item category tree. Path lists the IDs from the root
+// down to the category itself, e.g. "/1/4/9/", so a subtree is every category
+// whose path starts with the path of its root.
+type Category struct {
+	ID        uint64    `json:"id" example:"9"`
+	ParentID  uint64    `json:"parent_id" example:"4"`
+	Name      string    `json:"name" example:"Headphones"`
+	Path      string    `json:"path" example:"/1/4/9/"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// ItemCount is the number of items directly in the category
+	ItemCount uint64 `json:"item_count" example:"12"`
+	// TotalItemCount also includes the items of all descendant categories
+	TotalItemCount uint64 `json:"total_item_count" example:"40"`
+}
+
+// CategoryRequest creates or updates a category. A ParentID of 0 makes it a root category.
+type CategoryRequest struct {
+	Name     string `json:"name" binding:"required,max=100" example:"Headphones"`
+	ParentID uint64 `json:"parent_id" example:"4"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// Export formats
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatNDJSON  = "ndjson"
+	ExportFormatParquet = "parquet"
+	ExportFormatArrow   = "arrow"
+)
+
+// ExportContentTypes maps export formats to the media types they are served as
+var ExportContentTypes = map[string]string{
+	ExportFormatCSV:     "text/csv; charset=utf-8",
+	ExportFormatNDJSON:  "application/x-ndjson",
+	ExportFormatParquet: "application/vnd.apache.parquet",
+	ExportFormatArrow:   "application/vnd.apache.arrow.stream",
+}
@@ -0,0 +1,301 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FilterExpr is a parsed item filter expression such as
+//
+//	tag=clearance AND price<20 AND NOT (category=3 OR name~refurbished)
+//
+// Conditions compare a field with a value: tag, category, currency and sku
+// support = and !=, price supports = != < <= > >=, name supports = != and ~
+// (contains) and text supports ~, which matches the words of name and
+// description like a search query. Names and currencies compare case-insensitively
+// and prices are compared in each item's own currency. Conditions combine with
+// AND, OR, NOT and parentheses; AND binds tighter than OR. Values containing
+// spaces or operators are double-quoted.
+type FilterExpr struct {
+	root filterNode
+}
+
+// filterOps lists the operators each field supports
+var filterOps = map[string][]string{
+	"tag":      {"=", "!="},
+	"category": {"=", "!="},
+	"currency": {"=", "!="},
+	"sku":      {"=", "!="},
+	"price":    {"=", "!=", "<", "<=", ">", ">="},
+	"name":     {"=", "!=", "~"},
+	"text":     {"~"},
+}
+
+// ParseFilterExpr parses a filter expression
+func ParseFilterExpr(expr string) (*FilterExpr, error) {
+	tokens, err := lexFilterExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return &FilterExpr{root: root}, nil
+}
+
+// Match reports whether the item matches the expression
+func (e *FilterExpr) Match(item ItemResponse) bool {
+	return e.root.match(item)
+}
+
+type filterNode interface {
+	match(item ItemResponse) bool
+}
+
+type filterOr []filterNode
+
+func (n filterOr) match(item ItemResponse) bool {
+	for _, child := range n {
+		if child.match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+type filterAnd []filterNode
+
+func (n filterAnd) match(item ItemResponse) bool {
+	for _, child := range n {
+		if !child.match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+type filterNot struct{ child filterNode }
+
+func (n filterNot) match(item ItemResponse) bool {
+	return !n.child.match(item)
+}
+
+type filterCond struct {
+	field, op, value string
+	price            Money
+	id               uint64
+	terms            []string
+}
+
+func (n filterCond) match(item ItemResponse) bool {
+	switch n.field {
+	case "tag":
+		has := slices.ContainsFunc(item.Tags, func(tag string) bool { return strings.EqualFold(tag, n.value) })
+		return has == (n.op == "=")
+	case "category":
+		return (item.CategoryID == n.id) == (n.op == "=")
+	case "currency":
+		return strings.EqualFold(item.Currency, n.value) == (n.op == "=")
+	case "sku":
+		return (item.SKU == n.value) == (n.op == "=")
+	case "name":
+		if n.op == "~" {
+			return strings.Contains(strings.ToLower(item.Name), strings.ToLower(n.value))
+		}
+		return strings.EqualFold(item.Name, n.value) == (n.op == "=")
+	case "text":
+		text := strings.ToLower(item.Name + " " + item.Description)
+		for _, term := range n.terms {
+			if !strings.Contains(text, term) {
+				return false
+			}
+		}
+		return true
+	case "price":
+		c := item.Price.Cmp(n.price.Decimal)
+		switch n.op {
+		case "=":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		}
+	}
+	return false
+}
+
+type filterToken struct {
+	text string
+	// quoted values are never keywords, fields or operators
+	quoted bool
+}
+
+// lexFilterExpr splits an expression into words, quoted strings, operators and parentheses
+func lexFilterExpr(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '~':
+			tokens = append(tokens, filterToken{text: string(r)})
+			i++
+		case r == '!' || r == '<' || r == '>' || r == '=':
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' {
+				tokens = append(tokens, filterToken{text: string(runes[i : i+2])})
+				i += 2
+			} else if r == '!' {
+				return nil, fmt.Errorf("unexpected \"!\" at position %d", i+1)
+			} else {
+				tokens = append(tokens, filterToken{text: string(r)})
+				i++
+			}
+		case r == '"':
+			var value strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated quoted value")
+			}
+			tokens = append(tokens, filterToken{text: value.String(), quoted: true})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()~!<>="`, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// keyword consumes the next token if it is the given keyword
+func (p *filterParser) keyword(keyword string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	node, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	nodes := filterOr{node}
+	for p.keyword("OR") {
+		if node, err = p.and(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	node, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := filterAnd{node}
+	for p.keyword("AND") {
+		if node, err = p.unary(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	if p.keyword("NOT") {
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{node}, nil
+	}
+	if p.keyword("(") {
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return node, nil
+	}
+	return p.cond()
+}
+
+func (p *filterParser) cond() (filterNode, error) {
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("incomplete condition at the end of the expression")
+	}
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	ops, ok := filterOps[strings.ToLower(field.text)]
+	if field.quoted || !ok {
+		return nil, fmt.Errorf("unknown field %q", field.text)
+	}
+	if op.quoted || !slices.Contains(ops, op.text) {
+		return nil, fmt.Errorf("operator %q is not supported by %s", op.text, field.text)
+	}
+	p.pos += 3
+
+	node := filterCond{field: strings.ToLower(field.text), op: op.text, value: value.text}
+	switch node.field {
+	case "price":
+		price, err := NewMoney(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price %q", value.text)
+		}
+		node.price = price
+	case "category":
+		id, err := strconv.ParseUint(value.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid category ID %q", value.text)
+		}
+		node.id = id
+	case "text":
+		node.terms = SearchTerms(value.text)
+		if len(node.terms) == 0 {
+			return nil, fmt.Errorf("text must contain a word")
+		}
+	}
+	return node, nil
+}
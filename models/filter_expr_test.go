@@ -0,0 +1,131 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterExprMatch(t *testing.T) {
+	item := ItemResponse{
+		Name:        "Widget Pro",
+		Description: "A refurbished gadget",
+		SKU:         "W-1",
+		CategoryID:  3,
+		Tags:        []string{"Clearance", "OR"},
+		Price:       mustMoney(t, "19.99"),
+		Currency:    "USD",
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		// AND binds tighter than OR, NOT applies to the next condition only
+		{"and before or", "tag=clearance OR price>100 AND category=9", true},
+		{"parentheses override precedence", "(tag=clearance OR price>100) AND category=9", false},
+		{"not binds to one condition", "NOT tag=clearance OR category=3", true},
+		{"not of a group", "NOT (tag=clearance OR category=3)", false},
+		{"double not", "NOT NOT category=3", true},
+		{"keywords ignore case", "tag=clearance and not category=9", true},
+		{"nested groups", "((category=3) AND (price<20 OR tag=none))", true},
+
+		// quoting and escapes
+		{"quoted value with space", `name="Widget Pro"`, true},
+		{"quoted contains", `name~"get p"`, true},
+		{"quoted keyword is a value", `tag="OR"`, true},
+		{"quoted operator is a value", `sku!="="`, true},
+
+		// per field operators
+		{"tag ignores case", "tag=CLEARANCE", true},
+		{"tag not equal", "tag!=clearance", false},
+		{"category not equal", "category!=3", false},
+		{"currency ignores case", "currency=usd", true},
+		{"currency not equal", "currency!=EUR", true},
+		{"sku is case sensitive", "sku=w-1", false},
+		{"sku equal", "sku=W-1", true},
+		{"name equal ignores case", "name=\"widget pro\"", true},
+		{"name not equal", "name!=Widget", true},
+		{"name contains", "name~PRO", true},
+		{"text matches all words", `text~"REFURBISHED widget"`, true},
+		{"text misses a word", `text~"widget missing"`, false},
+		{"price equal ignores trailing zeros", "price=19.990", true},
+		{"price not equal", "price!=19.99", false},
+		{"price less", "price<19.99", false},
+		{"price less or equal", "price<=19.99", true},
+		{"price greater", "price>19.98", true},
+		{"price greater or equal", "price>=20", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseFilterExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilterExpr(%q): %v", tt.expr, err)
+			}
+			if got := expr.Match(item); got != tt.want {
+				t.Errorf("ParseFilterExpr(%q).Match() = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterExprEscapes(t *testing.T) {
+	tests := []struct {
+		expr string
+		sku  string
+	}{
+		{`sku="a\"b"`, `a"b`},
+		{`sku="a\\b"`, `a\b`},
+		{`sku="a\b"`, `ab`},
+		{`sku="a b"`, `a b`},
+		{`sku="(a)"`, `(a)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseFilterExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilterExpr(%q): %v", tt.expr, err)
+			}
+			if !expr.Match(ItemResponse{SKU: tt.sku}) {
+				t.Errorf("ParseFilterExpr(%q) does not match SKU %q", tt.expr, tt.sku)
+			}
+		})
+	}
+}
+
+func TestParseFilterExprErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "incomplete condition"},
+		{"tag", "incomplete condition"},
+		{"tag=a AND", "incomplete condition"},
+		{"tag=a tag=b", `unexpected "tag"`},
+		{"tag=a)", `unexpected ")"`},
+		{"(tag=a", "missing closing parenthesis"},
+		{"color=red", `unknown field "color"`},
+		{`"tag"=a`, `unknown field "tag"`},
+		{`tag "=" a`, `operator "=" is not supported`},
+		{"tag<a", `operator "<" is not supported by tag`},
+		{"text=a", `operator "=" is not supported by text`},
+		{"category~3", `operator "~" is not supported by category`},
+		{"price~1", `operator "~" is not supported by price`},
+		{"name!x", `unexpected "!" at position 5`},
+		{`name="abc`, "unterminated quoted value"},
+		{"price>abc", `invalid price "abc"`},
+		{"category=-1", `invalid category ID "-1"`},
+		{`text~"!?"`, "text must contain a word"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseFilterExpr(tt.expr)
+			if err == nil {
+				t.Fatalf("ParseFilterExpr(%q) succeeded, want error containing %q", tt.expr, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseFilterExpr(%q) error = %q, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
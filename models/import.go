@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Import statuses
+const (
+	ImportStatusQueued    = "queued"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// Import formats
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// ImportFields lists the item fields that can be mapped to source columns
+var ImportFields = []string{"name", "description", "sku", "category_id", "tags", "price", "currency"}
+
+// Import is an asynchronous item import. Rows whose SKU belongs to an existing item
+// update it, the other rows create items.
+type Import struct {
+	ID       string `json:"id" example:"9f86d081884c7d659a2feaa0c55ad015"`
+	Filename string `json:"filename" example:"supplier-2026-01-15.csv"`
+	Format   string `json:"format" example:"csv"`
+	// Mapping maps item fields to source columns, unmapped fields use columns of the same name
+	Mapping map[string]string `json:"mapping"`
+	Status  string            `json:"status" example:"running"`
+	// Progress is the share of the file processed so far, from 0 to 1
+	Progress       float64 `json:"progress" example:"0.42"`
+	SizeBytes      uint64  `json:"size_bytes" example:"1048576"`
+	ProcessedBytes uint64  `json:"processed_bytes" example:"440401"`
+	ProcessedRows  uint64  `json:"processed_rows" example:"4200"`
+	CreatedItems   uint64  `json:"created_items" example:"4000"`
+	UpdatedItems   uint64  `json:"updated_items" example:"150"`
+	FailedRows     uint64  `json:"failed_rows" example:"50"`
+	// Error is set when the import as a whole failed
+	Error      string     `json:"error,omitempty"`
+	CreatedBy  uint64     `json:"created_by" example:"1"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// InstanceID identifies the instance running the import
+	InstanceID string `json:"-"`
+}
+
+// ImportError is a problem found in one row of an import. Row numbers start at 1
+// with the first data row; Column is the source column, empty for the whole row.
+type ImportError struct {
+	Row     uint64 `json:"row" example:"17"`
+	Column  string `json:"column" example:"Unit Price"`
+	Code    string `json:"code" example:"invalid"`
+	Message string `json:"message" example:"price is not a valid amount"`
+}
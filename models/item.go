@@ -1,12 +1,54 @@
 package models
 
+import "time"
+
 type ItemRequest struct {
-	Name  string  `json:"name" example:"Sample Item"`
-	Price float64 `json:"price" example:"19.99"`
+	Name        string   `json:"name" binding:"required,max=200" example:"Sample Item"`
+	Description string   `json:"description" binding:"max=5000" example:"A sample item for the catalogue"`
+	SKU         string   `json:"sku" binding:"max=64" example:"SMP-0001"`
+	CategoryID  uint64   `json:"category_id" example:"3"`
+	Tags        []string `json:"tags" binding:"max=50,dive,required,max=50" example:"sample,clearance"`
+	// Price must fit in Decimal(18, 4)
+	Price Money `json:"price" binding:"gte=0,lt=100000000000000" swaggertype:"string" example:"19.99"`
+	// Currency is an ISO 4217 code, the configured default currency is used when empty
+	Currency string `json:"currency" binding:"omitempty,len=3" example:"USD"`
 }
 
 type ItemResponse struct {
-	ID    uint64  `json:"id" example:"1"`
-	Name  string  `json:"name" example:"Sample Item"`
-	Price float64 `json:"price" example:"19.99"`
+	ID          uint64    `json:"id" example:"1"`
+	Name        string    `json:"name" example:"Sample Item"`
+	Description string    `json:"description" example:"A sample item for the catalogue"`
+	SKU         string    `json:"sku" example:"SMP-0001"`
+	CategoryID  uint64    `json:"category_id" example:"3"`
+	Tags        []string  `json:"tags" example:"sample,clearance"`
+	Price       Money     `json:"price" swaggertype:"string" example:"19.99"`
+	Currency    string    `json:"currency" example:"USD"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CreatedBy   uint64    `json:"created_by" example:"1"`
+	UpdatedBy   uint64    `json:"updated_by" example:"1"`
+	// DeletedAt and DeletedBy are only set for items in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy uint64     `json:"deleted_by,omitempty" example:"1"`
+	// Score and Highlights are only set for items found by a search query
+	Score      float64         `json:"score,omitempty" example:"5.4"`
+	Highlights *ItemHighlights `json:"highlights,omitempty"`
+}
+
+// ItemFilter holds the search, filter, sorting and pagination options for listing items
+type ItemFilter struct {
+	// Search is parsed with ParseSearchQuery, Fuzzy makes its terms typo tolerant
+	Search     string
+	Fuzzy      bool
+	MinPrice   Money
+	MaxPrice   Money
+	CategoryID uint64
+	// IncludeDescendants extends the category filter to the category's whole subtree
+	IncludeDescendants bool
+	Tags               []string
+	SKU                string
+	SortBy             string
+	SortOrder          string
+	Page               int
+	Limit              int
 }
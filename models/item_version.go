@@ -0,0 +1,67 @@
+package models
+
+import (
+	"reflect"
+	"time"
+)
+
+// Item version changes
+const (
+	ItemChangeCreated  = "created"
+	ItemChangeUpdated  = "updated"
+	ItemChangeDeleted  = "deleted"
+	ItemChangeRestored = "restored"
+)
+
+// ItemVersion is a snapshot of an item, recorded every time the item changes.
+// A "deleted" version holds the item as it was when it was deleted.
+type ItemVersion struct {
+	ItemResponse
+	Version    uint32    `json:"version" example:"2"`
+	Change     string    `json:"change" example:"updated"`
+	RecordedAt time.Time `json:"recorded_at"`
+	RecordedBy uint64    `json:"recorded_by" example:"1"`
+}
+
+// FieldChange is a field whose value differs between two item versions
+type FieldChange struct {
+	Field string      `json:"field" example:"price"`
+	From  interface{} `json:"from" swaggertype:"string" example:"19.99"`
+	To    interface{} `json:"to" swaggertype:"string" example:"24.99"`
+}
+
+// ItemDiff lists the changes made to an item between two versions
+type ItemDiff struct {
+	ItemID  uint64        `json:"item_id" example:"1"`
+	From    uint32        `json:"from" example:"1"`
+	To      uint32        `json:"to" example:"2"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// DiffItems returns the editable fields that differ between two snapshots of an item
+func DiffItems(from, to ItemResponse) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+	add("name", from.Name, to.Name)
+	add("description", from.Description, to.Description)
+	add("sku", from.SKU, to.SKU)
+	add("category_id", from.CategoryID, to.CategoryID)
+	add("tags", nonNilTags(from.Tags), nonNilTags(to.Tags))
+	// Prices are compared by value, 19.9 and 19.90 are the same price
+	if !from.Price.Equal(to.Price.Decimal) {
+		changes = append(changes, FieldChange{Field: "price", From: from.Price, To: to.Price})
+	}
+	add("currency", from.Currency, to.Currency)
+	return changes
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
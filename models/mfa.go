@@ -0,0 +1,35 @@
+// models/mfa.go
+package models
+
+// LoginResponse is returned by /login. When MFA is enabled for the account only
+// MFAToken is set and must be exchanged for an access token at /login/mfa.
+// In cookie session mode Token is replaced by the session cookie and CSRFToken is set.
+type LoginResponse struct {
+	Token       string `json:"token,omitempty"`
+	CSRFToken   string `json:"csrf_token,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// MFALoginRequest completes a two-step login with either a TOTP code or a recovery code
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required" example:"eyJhbGciOi..."`
+	Code         string `json:"code,omitempty" example:"123456"`
+	RecoveryCode string `json:"recovery_code,omitempty" example:"3f9a1-0c2b7"`
+}
+
+// TOTPCodeRequest carries a TOTP code from the user's authenticator app
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6" example:"123456"`
+}
+
+// TOTPEnrollResponse contains the secret to load into an authenticator app
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/go-clickhouse-example:alice?secret=JBSWY3DPEHPK3PXP"`
+}
+
+// RecoveryCodesResponse lists freshly generated recovery codes. They are only shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Money is an exact decimal amount. It is stored as Decimal(18,4) and marshalled
+// to JSON as a string so that clients do not round it through a float.
+type Money struct {
+	decimal.Decimal
+}
+
+// NewMoney parses an amount such as "19.99"
+func NewMoney(value string) (Money, error) {
+	d, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return Money{d}, nil
+}
+
+// MarshalJSON encodes the amount as a JSON string
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts both "19.99" and 19.99. Numbers are parsed from their
+// text, never through float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(bytes.TrimSpace(data), `"`)
+	d, err := decimal.NewFromString(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	m.Decimal = d
+	return nil
+}
+
+// Scan implements sql.Scanner for Decimal columns
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case decimal.Decimal:
+		m.Decimal = v
+		return nil
+	case *decimal.Decimal:
+		m.Decimal = *v
+		return nil
+	default:
+		return m.Decimal.Scan(value)
+	}
+}
+
+// Value implements driver.Valuer
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// currencyMinorUnits maps ISO 4217 currency codes to their number of decimal places
+var currencyMinorUnits = map[string]int32{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0, "CNY": 2,
+	"CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "GEL": 2, "HKD": 2, "HUF": 2, "IDR": 2,
+	"ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "MXN": 2,
+	"NOK": 2, "NZD": 2, "OMR": 3, "PLN": 2, "RON": 2, "SEK": 2, "SGD": 2, "TND": 3,
+	"TRY": 2, "UAH": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+// CurrencyMinorUnits returns the number of decimal places used by an ISO 4217 currency
+func CurrencyMinorUnits(currency string) (int32, bool) {
+	units, ok := currencyMinorUnits[currency]
+	return units, ok
+}
+
+// ValidateMoney checks that the currency is supported and that the amount has no
+// more decimal places than the currency allows, e.g. 10.5 JPY is rejected
+func ValidateMoney(amount Money, currency string) error {
+	units, ok := CurrencyMinorUnits(currency)
+	if !ok {
+		return fmt.Errorf("unsupported currency %q", currency)
+	}
+	if !amount.Round(units).Equal(amount.Decimal) {
+		return fmt.Errorf("%s amounts can have at most %d decimal places", currency, units)
+	}
+	return nil
+}
+
+// ExchangeRate converts amounts from Base to Quote: 1 Base = Rate Quote
+type ExchangeRate struct {
+	Base      string          `json:"base" binding:"required,len=3" example:"EUR"`
+	Quote     string          `json:"quote" binding:"required,len=3" example:"USD"`
+	Rate      decimal.Decimal `json:"rate" binding:"gt=0" swaggertype:"string" example:"1.0845"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	UpdatedBy uint64          `json:"updated_by" example:"1"`
+}
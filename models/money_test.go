@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustMoney(t *testing.T, value string) Money {
+	t.Helper()
+	m, err := NewMoney(value)
+	if err != nil {
+		t.Fatalf("NewMoney(%q): %v", value, err)
+	}
+	return m
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"19.99", `"19.99"`},
+		{"0", `"0"`},
+		{"-5.50", `"-5.5"`},
+		{"1e3", `"1000"`},
+		{"0.1000", `"0.1"`},
+		{"99999999999999.9999", `"99999999999999.9999"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := json.Marshal(mustMoney(t, tt.value))
+			if err != nil {
+				t.Fatalf("json.Marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal(%s) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{`"19.99"`, "19.99", false},
+		{`19.99`, "19.99", false},
+		{` "19.99" `, "19.99", false},
+		{`0.1`, "0.1", false},
+		// numbers are parsed exactly, not rounded through float64
+		{`0.30000000000000000001`, "0.30000000000000000001", false},
+		{`12345678901234567.8901`, "12345678901234567.8901", false},
+		{`-3`, "-3", false},
+		{`"abc"`, "", true},
+		{`""`, "", true},
+		{`true`, "", true},
+		{`{}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var m Money
+			err := m.UnmarshalJSON([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalJSON(%s) = %s, want error", tt.data, m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalJSON(%s): %v", tt.data, err)
+			}
+			if !m.Equal(mustMoney(t, tt.want).Decimal) {
+				t.Errorf("UnmarshalJSON(%s) = %s, want %s", tt.data, m, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	type priced struct {
+		Price Money `json:"price"`
+	}
+
+	var decoded priced
+	if err := json.Unmarshal([]byte(`{"price": 10.10}`), &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	encoded, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if want := `{"price":"10.1"}`; string(encoded) != want {
+		t.Errorf("round trip = %s, want %s", encoded, want)
+	}
+}
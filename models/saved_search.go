@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// SavedSearchRequest creates or replaces a saved search
+type SavedSearchRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"Cheap clearance"`
+	// Expression is a filter expression, see FilterExpr
+	Expression string `json:"expression" binding:"required,max=500" example:"tag=clearance AND price<20"`
+	// WebhookURL optionally receives matches as POST requests, on top of NATS
+	WebhookURL string `json:"webhook_url" binding:"omitempty,url,max=500" example:"https://example.com/hooks/items"`
+}
+
+// SavedSearch is a user's filter expression, new matching items are delivered to
+// the user's NATS subject and to the webhook if there is one
+type SavedSearch struct {
+	ID         string    `json:"id" example:"5d41402abc4b2a76b9719d911017c592"`
+	UserID     uint64    `json:"user_id" example:"1"`
+	Name       string    `json:"name" example:"Cheap clearance"`
+	Expression string    `json:"expression" example:"tag=clearance AND price<20"`
+	WebhookURL string    `json:"webhook_url,omitempty" example:"https://example.com/hooks/items"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SavedSearchMatch is delivered once per saved search for each item that starts
+// matching it, either when created or when changed
+type SavedSearchMatch struct {
+	SearchID   string       `json:"search_id" example:"5d41402abc4b2a76b9719d911017c592"`
+	SearchName string       `json:"search_name" example:"Cheap clearance"`
+	UserID     uint64       `json:"user_id" example:"1"`
+	Item       ItemResponse `json:"item"`
+	MatchedAt  time.Time    `json:"matched_at"`
+}
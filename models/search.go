@@ -0,0 +1,204 @@
+package models
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxSearchTerms bounds the number of terms of a search query
+const MaxSearchTerms = 16
+
+// SearchQuery is a parsed search query: items match if they match every term of
+// any group. Terms are lowercase runs of letters and digits.
+type SearchQuery [][]string
+
+// ParseSearchQuery parses a search such as "red shoes OR sandals". Words are ANDed,
+// OR (or |) separates alternatives. Punctuation splits words into several terms,
+// so "wi-fi" requires both "wi" and "fi".
+func ParseSearchQuery(search string) SearchQuery {
+	var query SearchQuery
+	var group []string
+	for _, word := range strings.Fields(search) {
+		switch word {
+		case "OR", "|":
+			if len(group) > 0 {
+				query = append(query, group)
+			}
+			group = nil
+		case "AND", "&":
+		default:
+			group = append(group, SearchTerms(word)...)
+		}
+	}
+	if len(group) > 0 {
+		query = append(query, group)
+	}
+	return query
+}
+
+// SearchTerms splits text into lowercase runs of letters and digits
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Terms returns every term of the query
+func (q SearchQuery) Terms() []string {
+	var terms []string
+	for _, group := range q {
+		terms = append(terms, group...)
+	}
+	return terms
+}
+
+// MaxTypos returns how many edits a word may be away from a term to match it with
+// typo tolerance. Short terms must match exactly.
+func MaxTypos(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ItemHighlights holds the fragments of an item matching a search, HTML-escaped
+// and with matched words wrapped in <em> tags
+type ItemHighlights struct {
+	Name        string `json:"name,omitempty" example:"Red <em>running</em> shoes"`
+	Description string `json:"description,omitempty" example:"…lightweight <em>running</em> shoe with…"`
+}
+
+// highlightFragmentRunes is the length of description fragments
+const highlightFragmentRunes = 160
+
+// Highlight returns the highlighted name and description fragment of the item, or
+// nil if neither contains a word matching the query
+func (q SearchQuery) Highlight(item ItemResponse, fuzzy bool) *ItemHighlights {
+	terms := q.Terms()
+	name, nameMatched := highlight([]rune(item.Name), terms, fuzzy, 0)
+	description, descriptionMatched := highlight([]rune(item.Description), terms, fuzzy, highlightFragmentRunes)
+	if !nameMatched && !descriptionMatched {
+		return nil
+	}
+
+	highlights := &ItemHighlights{}
+	if nameMatched {
+		highlights.Name = name
+	}
+	if descriptionMatched {
+		highlights.Description = description
+	}
+	return highlights
+}
+
+// highlight wraps the words of text matching one of the terms in <em> tags. If
+// maxRunes is set, only a fragment of about that length around the first match
+// is returned.
+func highlight(text []rune, terms []string, fuzzy bool, maxRunes int) (string, bool) {
+	type span struct{ start, end int }
+	var matches []span
+	for start := 0; start < len(text); {
+		if !isWordRune(text[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(text) && isWordRune(text[end]) {
+			end++
+		}
+		if matchesTerm(strings.ToLower(string(text[start:end])), terms, fuzzy) {
+			matches = append(matches, span{start, end})
+		}
+		start = end
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	from, to := 0, len(text)
+	if maxRunes > 0 && len(text) > maxRunes {
+		from = matches[0].start - maxRunes/4
+		if from < 0 {
+			from = 0
+		}
+		to = from + maxRunes
+		if to > len(text) {
+			to, from = len(text), len(text)-maxRunes
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(text[pos:m.start])))
+		b.WriteString("<em>" + html.EscapeString(string(text[m.start:m.end])) + "</em>")
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(string(text[pos:to])))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// matchesTerm reports whether a lowercase word contains one of the terms, or with
+// fuzzy set is within MaxTypos edits of one
+func matchesTerm(word string, terms []string, fuzzy bool) bool {
+	for _, term := range terms {
+		if strings.Contains(word, term) {
+			return true
+		}
+		if fuzzy {
+			if typos := MaxTypos(term); typos > 0 && levenshtein(word, term) <= typos {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// levenshtein returns the edit distance between a and b, counted in bytes like
+// ClickHouse's levenshteinDistance
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Suggestion is an item whose name matches a prefix typed into a search box
+type Suggestion struct {
+	ID   uint64 `json:"id" example:"1"`
+	Name string `json:"name" example:"Red running shoes"`
+	// Popularity is the number of units sold, net of returns
+	Popularity int64 `json:"popularity" example:"120"`
+}
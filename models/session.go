@@ -0,0 +1,20 @@
+// models/session.go
+package models
+
+import "time"
+
+// Session is a login session. Every access token carries the ID of its session
+// in the "sid" claim so that the session can be revoked before the token expires.
+type Session struct {
+	ID         string    `json:"id" example:"9f86d081884c7d659a2feaa0c55ad015"`
+	UserID     uint64    `json:"user_id" example:"1"`
+	Device     string    `json:"device" example:"Chrome on macOS"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Revoked    bool      `json:"-"`
+	// Current is set when listing sessions to mark the one making the request
+	Current bool `json:"current"`
+}
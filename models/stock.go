@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Stock movement reasons
+const (
+	StockReasonReceipt    = "receipt"
+	StockReasonSale       = "sale"
+	StockReasonReturn     = "return"
+	StockReasonAdjustment = "adjustment"
+)
+
+// StockMovementRequest records a change of an item's stock. Receipts and returns
+// must add stock, sales must remove it, adjustments may do either.
+type StockMovementRequest struct {
+	Delta     int64  `json:"delta" binding:"required" example:"25"`
+	Reason    string `json:"reason" binding:"required,oneof=receipt sale return adjustment" example:"receipt"`
+	Reference string `json:"reference" binding:"max=200" example:"PO-2024-0042"`
+}
+
+// StockMovement is an entry of the append-only stock ledger
+type StockMovement struct {
+	ItemID    uint64    `json:"item_id" example:"1"`
+	Delta     int64     `json:"delta" example:"25"`
+	Reason    string    `json:"reason" example:"receipt"`
+	Reference string    `json:"reference" example:"PO-2024-0042"`
+	ActorID   uint64    `json:"actor_id" example:"1"`
+	Timestamp time.Time `json:"ts"`
+	// Balance is the item's stock right after the movement
+	Balance int64 `json:"balance" example:"125"`
+}
+
+// StockLevel is the current stock of an item
+type StockLevel struct {
+	ItemID   uint64 `json:"item_id" example:"1"`
+	Quantity int64  `json:"quantity" example:"125"`
+}
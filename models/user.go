@@ -5,21 +5,52 @@ package models
 type User struct {
 	ID       uint64 `json:"id"`
 	Username string `json:"username"`
+	Email    string `json:"email"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
 }
 
 // UserRequest is used for user registration (without password hashing)
 type UserRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Username string `json:"username" binding:"required,min=3,max=32,username" example:"alice"`
+	Email    string `json:"email" binding:"omitempty,email,max=254" example:"alice@example.com"`
+	// Password is limited to 72 bytes, the most bcrypt uses
+	Password string `json:"password" binding:"required,min=8,max=72" example:"correct-horse"`
+	Role     string `json:"role" binding:"max=32" example:"user"`
+}
+
+// LoginRequest carries the credentials for /login. Unlike UserRequest it does not
+// apply the registration rules, so accounts created before them can still log in.
+type LoginRequest struct {
+	Username string `json:"username" binding:"required" example:"alice"`
+	Password string `json:"password" binding:"required" example:"correct-horse"`
 }
 
 // UserResponse is used for the response when fetching user data
 type UserResponse struct {
-	ID       uint64 `json:"id"`
-	Username string `json:"username"`
-	Password string `json:"-"`
-	Role     string `json:"role"`
+	ID            uint64 `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Password      string `json:"-"`
+	Role          string `json:"role"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
+	TOTPSecret    string `json:"-"`
+	TOTPLastStep  int64  `json:"-"`
+}
+
+// ForgotPasswordRequest starts the password reset flow
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"alice@example.com"`
+}
+
+// ResetPasswordRequest sets a new password using a token from the reset email
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"eyJhbGciOi..."`
+	Password string `json:"password" binding:"required,min=8,max=72" example:"new-secret"`
+}
+
+// VerifyEmailRequest confirms an email address using a token from the verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" example:"eyJhbGciOi..."`
 }
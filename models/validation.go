@@ -0,0 +1,8 @@
+package models
+
+// FieldError describes why one field of a request failed validation
+type FieldError struct {
+	Field   string `json:"field" example:"name"`
+	Code    string `json:"code" example:"required"`
+	Message string `json:"message" example:"name is required"`
+}
@@ -0,0 +1,6 @@
+package routes
+
+import "go-clickhouse-example/logging"
+
+// logger writes the package's logs, at the level configured for "routes"
+var logger = logging.For("routes")
@@ -1,10 +1,17 @@
 package routes
 
 import (
+	"fmt"
+	"strings"
+
+	"go-clickhouse-example/apperr"
 	"go-clickhouse-example/config"
 	"go-clickhouse-example/handlers"
+	"go-clickhouse-example/logging"
+	"go-clickhouse-example/metrics"
 	"go-clickhouse-example/middleware" // Import the middleware
 	"go-clickhouse-example/services"
+	"go-clickhouse-example/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,31 +19,169 @@ import (
 func SetupRouter() *gin.Engine {
 	cfg := config.LoadConfig()
 
+	// Install the custom rules used in the models' binding tags
+	if err := validation.Register(); err != nil {
+		logging.Fatal(logger, "Failed to register validators", "error", err)
+	}
+
 	// Initialize services
-	dbService := services.NewDBService(cfg.ClickHouse)
+	dbService := services.NewDBService(cfg.ClickHouse, cfg.ClickHouseNative)
 	dbService.CreateTable()
+	services.NewTrashPurger(dbService, cfg.ItemTrashRetention, cfg.ItemTrashPurgeInterval).Start()
 	natsService := services.NewNATSService(cfg.NATSURL, cfg.StreamName, cfg.SubjectName)
 
 	// Initialize handlers
-	itemHandler := handlers.NewItemHandler(dbService, natsService)
+	currencyService := services.NewCurrencyService(dbService, cfg.DefaultCurrency)
+	currencyHandler := handlers.NewCurrencyHandler(currencyService)
+	bulkItemService := services.NewBulkItemService(dbService, natsService)
+	itemHandler := handlers.NewItemHandler(dbService, natsService, currencyService, bulkItemService)
+	suggestService := services.NewSuggestService(dbService, natsService)
+	if err := suggestService.Start(); err != nil {
+		logging.Fatal(logger, "Failed to start suggest service", "error", err)
+	}
+	suggestHandler := handlers.NewSuggestHandler(suggestService)
+	savedSearchService := services.NewSavedSearchService(dbService, natsService)
+	if err := savedSearchService.Start(); err != nil {
+		logging.Fatal(logger, "Failed to start saved search service", "error", err)
+	}
+	savedSearchHandler := handlers.NewSavedSearchHandler(savedSearchService)
+	categoryService := services.NewCategoryService(dbService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+	importService, err := services.NewImportService(dbService, natsService, currencyService, bulkItemService, cfg.ImportDir, cfg.ImportWorkers)
+	if err != nil {
+		logging.Fatal(logger, "Failed to start import service", "error", err)
+	}
+	importHandler := handlers.NewImportHandler(importService, cfg.ImportMaxBytes)
+	stockService := services.NewStockService(dbService, natsService)
+	stockHandler := handlers.NewStockHandler(stockService)
+	analyticsService := services.NewAnalyticsService(dbService, cfg.AnalyticsQueryTimeout, cfg.AnalyticsCacheTTL)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
+	mailer, err := services.NewMailer(cfg)
+	if err != nil {
+		logging.Fatal(logger, "Failed to create mailer", "error", err)
+	}
+	sessionService := services.NewSessionService(dbService, cfg.Session.CacheTTL)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	accountService := services.NewAccountService(dbService, sessionService, mailer, cfg.FrontendURL, cfg.PasswordResetTTL, cfg.EmailVerificationTTL)
+	accountHandler := handlers.NewAccountHandler(accountService)
 	authService := services.NewAuthService(dbService)
-	authHandler := handlers.NewAuthHandler(authService)
+	authHandler := handlers.NewAuthHandler(authService, accountService, sessionService, cfg.Session)
+	mfaService := services.NewMFAService(dbService, cfg.MFAIssuer)
+	mfaHandler := handlers.NewMFAHandler(mfaService, sessionService, cfg.Session)
+
+	auditService := services.NewAuditService(dbService)
+	impersonationService := services.NewImpersonationService(dbService, sessionService, auditService, cfg.ImpersonationTTL)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService, auditService)
+
+	// AuthMiddleware checks every token's session against the session cache
+	authMiddleware := middleware.AuthMiddleware(sessionService)
+	// User-management routes cannot be used with an impersonation token
+	denyImpersonation := middleware.DenyImpersonation()
+
+	// Handlers return errors, which are written as problem details
+	handle := apperr.Handler
+
+	// Gin's debug output goes through the structured logs too
+	gin.DebugPrintFunc = func(format string, values ...interface{}) {
+		logger.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		logger.Debug("Route registered", "method", method, "path", path, "handler", handler)
+	}
 
 	// Initialize the router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.Trace(), middleware.Logger(), middleware.Metrics(), gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		apperr.Write(c, fmt.Errorf("panic: %v", recovered))
+	}))
+	router.NoRoute(handle(func(c *gin.Context) error {
+		return apperr.NotFound("route_not_found", "No route matches "+c.Request.Method+" "+c.Request.URL.Path)
+	}))
+
+	// Audit every request made while impersonating a user
+	router.Use(middleware.AuditImpersonation(auditService))
+
+	// Prometheus metrics
+	router.GET("/metrics", metrics.Handler())
 
 	// Public routes for user registration and login
-	router.POST("/register", authHandler.RegisterUser)
-	router.POST("/login", authHandler.LoginUser)
+	router.POST("/register", handle(authHandler.RegisterUser))
+	router.POST("/login", handle(authHandler.LoginUser))
+	router.POST("/login/mfa", handle(mfaHandler.LoginMFA))
+	router.POST("/logout", authMiddleware, handle(authHandler.LogoutUser))
+
+	// Account recovery and email verification
+	router.POST("/password/forgot", handle(accountHandler.ForgotPassword))
+	router.POST("/password/reset", handle(accountHandler.ResetPassword))
+	router.POST("/verify-email", handle(accountHandler.VerifyEmail))
+	router.POST("/verify-email/resend", authMiddleware, denyImpersonation, handle(accountHandler.ResendVerificationEmail))
+
+	// MFA management for the authenticated user
+	router.POST("/mfa/totp/enroll", authMiddleware, denyImpersonation, handle(mfaHandler.EnrollTOTP))
+	router.POST("/mfa/totp/activate", authMiddleware, denyImpersonation, handle(mfaHandler.ActivateTOTP))
+	router.POST("/mfa/totp/disable", authMiddleware, denyImpersonation, handle(mfaHandler.DisableTOTP))
+	router.POST("/mfa/recovery-codes", authMiddleware, denyImpersonation, handle(mfaHandler.RegenerateRecoveryCodes))
+
+	// Session management
+	router.GET("/me/sessions", authMiddleware, handle(sessionHandler.ListMySessions))
+	router.DELETE("/me/sessions/:id", authMiddleware, denyImpersonation, handle(sessionHandler.RevokeMySession))
+	router.DELETE("/admin/users/:user_id/sessions", authMiddleware, denyImpersonation, middleware.RBACMiddleware("admin"), handle(sessionHandler.RevokeUserSessions))
+
+	// Saved searches, notified of new matching items
+	router.GET("/me/saved-searches", authMiddleware, handle(savedSearchHandler.ListMySavedSearches))
+	router.POST("/me/saved-searches", authMiddleware, denyImpersonation, handle(savedSearchHandler.CreateSavedSearch))
+	router.GET("/me/saved-searches/:id", authMiddleware, handle(savedSearchHandler.GetSavedSearch))
+	router.PUT("/me/saved-searches/:id", authMiddleware, denyImpersonation, handle(savedSearchHandler.UpdateSavedSearch))
+	router.DELETE("/me/saved-searches/:id", authMiddleware, denyImpersonation, handle(savedSearchHandler.DeleteSavedSearch))
+
+	// Impersonation and audit log
+	router.POST("/admin/impersonate/:user_id", authMiddleware, denyImpersonation, middleware.RBACMiddleware("admin"), handle(impersonationHandler.StartImpersonation))
+	router.GET("/admin/audit", authMiddleware, denyImpersonation, middleware.RBACMiddleware("admin"), handle(impersonationHandler.ListAuditLog))
+
+	// Exchange rates used for price conversion
+	router.GET("/exchange-rates", authMiddleware, handle(currencyHandler.ListExchangeRates))
+	router.PUT("/admin/exchange-rates", authMiddleware, denyImpersonation, middleware.RBACMiddleware("admin"), handle(currencyHandler.SetExchangeRate))
+
+	// Item category tree
+	router.GET("/categories", authMiddleware, handle(categoryHandler.ListCategories))
+	router.GET("/categories/:id", authMiddleware, handle(categoryHandler.GetCategory))
+	router.POST("/categories", authMiddleware, middleware.RBACMiddleware("admin"), handle(categoryHandler.CreateCategory))
+	router.PUT("/categories/:id", authMiddleware, middleware.RBACMiddleware("admin"), handle(categoryHandler.UpdateCategory))
+	router.DELETE("/categories/:id", authMiddleware, middleware.RBACMiddleware("admin"), handle(categoryHandler.DeleteCategory))
 
 	// Protected routes (Require authentication and authorization)
 	// Apply AuthMiddleware to secure the routes and RBACMiddleware for role-based access control
-	router.POST("/items", middleware.AuthMiddleware(), middleware.RBACMiddleware("admin"), itemHandler.CreateItem)
-	router.GET("/items", middleware.AuthMiddleware(), itemHandler.GetItems)
+	router.POST("/items", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.CreateItem))
+	router.GET("/items", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.GetItems))
+	router.GET("/items/search", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.SearchItems))
+	router.GET("/items/suggest", authMiddleware, middleware.RBACMiddleware("admin"), handle(suggestHandler.SuggestItems))
+	router.GET("/items/export", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.ExportItems))
+	router.POST("/items/bulk", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.BulkItems))
+	router.GET("/items/trash", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.GetTrashedItems))
+
+	router.GET("/items/:id", authMiddleware, handle(itemHandler.GetItem))
+	router.PUT("/items/:id", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.UpdateItem))
+	router.DELETE("/items/:id", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.DeleteItem))
+	router.POST("/items/:id/restore", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.RestoreItem))
+	router.GET("/items/:id/history", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.GetItemHistory))
+	router.GET("/items/:id/history/diff", authMiddleware, middleware.RBACMiddleware("admin"), handle(itemHandler.GetItemDiff))
+
+	// Item imports
+	router.POST("/imports", authMiddleware, middleware.RBACMiddleware("admin"), handle(importHandler.CreateImport))
+	router.GET("/imports/:id", authMiddleware, middleware.RBACMiddleware("admin"), handle(importHandler.GetImport))
+	router.GET("/imports/:id/errors", authMiddleware, middleware.RBACMiddleware("admin"), handle(importHandler.GetImportErrors))
+
+	// Stock ledger
+	router.GET("/items/:id/stock", authMiddleware, middleware.RBACMiddleware("admin"), handle(stockHandler.GetStockLevel))
+	router.POST("/items/:id/stock", authMiddleware, middleware.RBACMiddleware("admin"), handle(stockHandler.RecordStockMovement))
+	router.GET("/items/:id/stock/history", authMiddleware, middleware.RBACMiddleware("admin"), handle(stockHandler.GetStockHistory))
 
-	router.GET("/items/:id", middleware.AuthMiddleware(), itemHandler.GetItem)
-	router.PUT("/items/:id", middleware.AuthMiddleware(), middleware.RBACMiddleware("admin"), itemHandler.UpdateItem)
-	router.DELETE("/items/:id", middleware.AuthMiddleware(), middleware.RBACMiddleware("admin"), itemHandler.DeleteItem)
+	// Item analytics, filtered like /items/search
+	router.GET("/analytics/items/price-stats", authMiddleware, middleware.RBACMiddleware("admin"), handle(analyticsHandler.GetPriceStats))
+	router.GET("/analytics/items/price-histogram", authMiddleware, middleware.RBACMiddleware("admin"), handle(analyticsHandler.GetPriceHistogram))
+	router.GET("/analytics/items/counts", authMiddleware, middleware.RBACMiddleware("admin"), handle(analyticsHandler.GetItemCounts))
+	router.GET("/analytics/items/top", authMiddleware, middleware.RBACMiddleware("admin"), handle(analyticsHandler.GetTopItems))
+	router.GET("/analytics/timeseries", authMiddleware, middleware.RBACMiddleware("admin"), handle(analyticsHandler.GetTimeseries))
 
 	return router
 }
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/utils"
+)
+
+var (
+	ErrInvalidToken  = apperr.Invalid("invalid_token", "invalid or expired token")
+	ErrTokenUsed     = apperr.Invalid("token_used", "token has already been used")
+	ErrNoEmail       = apperr.Invalid("no_email", "user has no email address")
+	ErrEmailVerified = apperr.Invalid("email_already_verified", "email is already verified")
+)
+
+// AccountService handles password reset and email verification
+type AccountService struct {
+	DBService            *DBService
+	SessionService       *SessionService
+	Mailer               Mailer
+	FrontendURL          string
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+
+	// tokens serializes the uses of each single-use token within this instance
+	tokens keyedMutex
+}
+
+// NewAccountService creates a new AccountService instance
+func NewAccountService(dbService *DBService, sessionService *SessionService, mailer Mailer, frontendURL string, passwordResetTTL, emailVerificationTTL time.Duration) *AccountService {
+	return &AccountService{
+		DBService:            dbService,
+		SessionService:       sessionService,
+		Mailer:               mailer,
+		FrontendURL:          frontendURL,
+		PasswordResetTTL:     passwordResetTTL,
+		EmailVerificationTTL: emailVerificationTTL,
+	}
+}
+
+// SendVerificationEmail emails the user a link to confirm their address
+func (s *AccountService) SendVerificationEmail(ctx context.Context, userID uint64) error {
+	user, err := s.DBService.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+	if user.EmailVerified {
+		return ErrEmailVerified
+	}
+
+	token, err := utils.GenerateActionToken(utils.TokenTypeEmailVerification, &user, s.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, s.link("/verify-email", token), s.EmailVerificationTTL),
+	})
+}
+
+// VerifyEmail marks the email address the token was issued for as verified
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := s.consumeToken(ctx, utils.TokenTypeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	return s.DBService.SetEmailVerified(ctx, claims.UserID, claims.Email)
+}
+
+// ForgotPassword emails a reset link in the background if the address belongs to a
+// user. Nothing is reported, and the lookup and the mail are not waited for, so that
+// neither the response nor its timing tell whether an account exists.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := s.sendPasswordReset(ctx, email); err != nil {
+			logger.ErrorContext(ctx, "Failed to send password reset email", "error", err)
+		}
+	}()
+}
+
+// sendPasswordReset emails a reset link to the user with the address, if any
+func (s *AccountService) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.DBService.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	token, err := utils.GenerateActionToken(utils.TokenTypePasswordReset, &user, s.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not request this, you can ignore this email.\n",
+			user.Username, s.link("/password/reset", token), s.PasswordResetTTL),
+	})
+}
+
+// ResetPassword sets a new password using a password reset token and ends all
+// sessions of the user, which may have been opened with the old password
+func (s *AccountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	claims, err := s.consumeToken(ctx, utils.TokenTypePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	// The token is bound to the email it was sent to and to the password it resets,
+	// so that the other links sent before are invalid once the password changed
+	user, err := s.DBService.GetUserByID(ctx, claims.UserID)
+	if err != nil || !claims.IssuedFor(&user) {
+		return ErrInvalidToken
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.DBService.SetUserPassword(ctx, user.ID, hashedPassword); err != nil {
+		return err
+	}
+	return s.SessionService.RevokeAll(ctx, user.ID)
+}
+
+// consumeToken validates a single-use token and marks it as used. Concurrent uses of
+// a token are serialized, so that only one of them succeeds.
+func (s *AccountService) consumeToken(ctx context.Context, tokenType, token string) (*utils.ActionClaims, error) {
+	claims, err := utils.ParseActionToken(tokenType, token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	unlock := s.tokens.Lock(claims.ID)
+	fresh, err := s.DBService.ConsumeToken(ctx, claims.ID, claims.ExpiresAt)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrTokenUsed
+	}
+	return claims, nil
+}
+
+// link builds a frontend URL carrying the token as a query parameter
+func (s *AccountService) link(path, token string) string {
+	return s.FrontendURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
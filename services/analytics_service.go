@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+// analyticsCacheSize bounds the number of cached analytics results
+const analyticsCacheSize = 1000
+
+var ErrAnalyticsTimeout = apperr.Timeout("analytics_timeout", "analytics query took too long, narrow down the filter")
+
+// AnalyticsService computes aggregate statistics over the items matching a search
+// filter and timeseries of item changes. Each query is bounded by QueryTimeout and its result is cached for
+// CacheTTL, so results may lag behind item changes by up to CacheTTL.
+type AnalyticsService struct {
+	DBService    *DBService
+	QueryTimeout time.Duration
+	CacheTTL     time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedAnalytics
+}
+
+type cachedAnalytics struct {
+	result    interface{}
+	expiresAt time.Time
+}
+
+// NewAnalyticsService creates a new AnalyticsService instance
+func NewAnalyticsService(dbService *DBService, queryTimeout, cacheTTL time.Duration) *AnalyticsService {
+	return &AnalyticsService{
+		DBService:    dbService,
+		QueryTimeout: queryTimeout,
+		CacheTTL:     cacheTTL,
+		cache:        make(map[string]cachedAnalytics),
+	}
+}
+
+// PriceStats returns the price statistics of the matching items per currency, with
+// the approximate price quantiles at the given levels
+func (s *AnalyticsService) PriceStats(ctx context.Context, filter models.ItemFilter, levels []float64) ([]models.PriceStats, error) {
+	result, err := s.cached("price_stats", []interface{}{analyticsFilter(filter), levels}, func() (interface{}, error) {
+		ctx, cancel := analyticsContext(ctx, s.QueryTimeout)
+		defer cancel()
+		stats, err := s.DBService.GetPriceStats(ctx, filter, levels)
+		return stats, s.queryError(ctx.Err(), err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]models.PriceStats), nil
+}
+
+// PriceHistogram counts the matching items per currency and price bucket. Buckets
+// are delimited either by the ascending bounds or, if there are none, have the given width.
+func (s *AnalyticsService) PriceHistogram(ctx context.Context, filter models.ItemFilter, bounds []models.Money, width models.Money) ([]models.PriceBucket, error) {
+	key := []interface{}{analyticsFilter(filter), bounds, width}
+	result, err := s.cached("price_histogram", key, func() (interface{}, error) {
+		ctx, cancel := analyticsContext(ctx, s.QueryTimeout)
+		defer cancel()
+		var buckets []models.PriceBucket
+		var err error
+		if len(bounds) > 0 {
+			buckets, err = s.DBService.GetPriceHistogramBounds(ctx, filter, bounds)
+		} else {
+			buckets, err = s.DBService.GetPriceHistogramWidth(ctx, filter, width)
+		}
+		return buckets, s.queryError(ctx.Err(), err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]models.PriceBucket), nil
+}
+
+// Counts counts the matching items grouped by category, tag or currency, largest
+// groups first. limit keeps only the top groups, 0 returns all of them.
+func (s *AnalyticsService) Counts(ctx context.Context, filter models.ItemFilter, groupBy string, limit int) ([]models.ItemCount, error) {
+	key := []interface{}{analyticsFilter(filter), groupBy, limit}
+	result, err := s.cached("counts", key, func() (interface{}, error) {
+		ctx, cancel := analyticsContext(ctx, s.QueryTimeout)
+		defer cancel()
+		counts, err := s.DBService.GetItemCounts(ctx, filter, groupBy, limit)
+		return counts, s.queryError(ctx.Err(), err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]models.ItemCount), nil
+}
+
+// TopByPrice returns the limit most expensive matching items of each currency, or
+// the cheapest ones if ascending is set
+func (s *AnalyticsService) TopByPrice(ctx context.Context, filter models.ItemFilter, limit int, ascending bool) ([]models.ItemResponse, error) {
+	key := []interface{}{analyticsFilter(filter), limit, ascending}
+	result, err := s.cached("top_by_price", key, func() (interface{}, error) {
+		ctx, cancel := analyticsContext(ctx, s.QueryTimeout)
+		defer cancel()
+		items, err := s.DBService.GetTopItemsByPrice(ctx, filter, limit, ascending)
+		return items, s.queryError(ctx.Err(), err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]models.ItemResponse), nil
+}
+
+// Timeseries returns the metric per interval over [from, to). from and to are
+// aligned on the interval, from rounded down and to rounded up.
+func (s *AnalyticsService) Timeseries(ctx context.Context, metric, interval, currency string, from, to time.Time) (*models.Timeseries, error) {
+	step, ok := TimeseriesStep(interval)
+	if !ok {
+		return nil, fmt.Errorf("unknown timeseries interval %q", interval)
+	}
+	from = from.UTC().Truncate(step)
+	if aligned := to.UTC().Truncate(step); aligned.Before(to) {
+		to = aligned.Add(step)
+	} else {
+		to = aligned
+	}
+
+	key := []interface{}{metric, interval, currency, from, to}
+	result, err := s.cached("timeseries", key, func() (interface{}, error) {
+		ctx, cancel := analyticsContext(ctx, s.QueryTimeout)
+		defer cancel()
+		points, err := s.DBService.GetTimeseries(ctx, metric, interval, currency, from, to)
+		return points, s.queryError(ctx.Err(), err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.Timeseries{
+		Metric:   metric,
+		Interval: interval,
+		Currency: currency,
+		From:     from,
+		To:       to,
+		Points:   result.([]models.TimeseriesPoint),
+	}, nil
+}
+
+// analyticsFilter clears the sorting and pagination options, which analytics
+// ignore, so that they do not split the cache
+func analyticsFilter(filter models.ItemFilter) models.ItemFilter {
+	filter.SortBy, filter.SortOrder = "", ""
+	filter.Page, filter.Limit = 0, 0
+	return filter
+}
+
+// queryError turns errors of queries that ran out of time into ErrAnalyticsTimeout
+func (s *AnalyticsService) queryError(ctxErr, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr != nil || isQueryTimeoutError(err) {
+		return ErrAnalyticsTimeout
+	}
+	return err
+}
+
+// cached returns the cached result of the named query for the given arguments,
+// running it on a miss. Errors are not cached.
+func (s *AnalyticsService) cached(name string, args interface{}, run func() (interface{}, error)) (interface{}, error) {
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build cache key: %w", err)
+	}
+	key := name + ":" + string(encoded)
+
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.result, nil
+	}
+
+	result, err := run()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= analyticsCacheSize {
+		s.evict(now)
+	}
+	s.cache[key] = cachedAnalytics{result: result, expiresAt: now.Add(s.CacheTTL)}
+	return result, nil
+}
+
+// evict drops expired results, and every result if the cache is still full.
+// The caller must hold mu.
+func (s *AnalyticsService) evict(now time.Time) {
+	for key, entry := range s.cache {
+		if !now.Before(entry.expiresAt) {
+			delete(s.cache, key)
+		}
+	}
+	if len(s.cache) >= analyticsCacheSize {
+		s.cache = make(map[string]cachedAnalytics)
+	}
+}
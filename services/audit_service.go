@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+
+	"go-clickhouse-example/models"
+)
+
+// AuditService writes and reads the audit log
+type AuditService struct {
+	DBService *DBService
+}
+
+// NewAuditService creates a new AuditService instance
+func NewAuditService(dbService *DBService) *AuditService {
+	return &AuditService{DBService: dbService}
+}
+
+// Record writes the entry in the background so that auditing does not delay responses.
+// The write outlives the request, so it must not be cancelled along with it.
+func (s *AuditService) Record(ctx context.Context, entry models.AuditEntry) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := s.DBService.SaveAuditEntry(ctx, entry); err != nil {
+			logger.ErrorContext(ctx, "Failed to write audit entry", "action", entry.Action, "error", err)
+		}
+	}()
+}
+
+// List returns recent audit entries, optionally filtered by actor and subject
+func (s *AuditService) List(ctx context.Context, actorID, subjectID uint64, limit int) ([]models.AuditEntry, error) {
+	return s.DBService.GetAuditEntries(ctx, actorID, subjectID, limit)
+}
@@ -1,12 +1,22 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"go-clickhouse-example/apperr"
 	"go-clickhouse-example/models"
 	"go-clickhouse-example/utils"
 )
 
+var (
+	// ErrEmailTaken is returned when registering with an email that belongs to another user
+	ErrEmailTaken = apperr.Conflict("email_taken", "email is already registered")
+	// ErrInvalidCredentials is returned for both unknown usernames and wrong passwords
+	ErrInvalidCredentials = apperr.Unauthorized("invalid_credentials", "invalid username or password")
+)
+
 // AuthService handles authentication-related operations
 type AuthService struct {
 	DBService *DBService
@@ -18,7 +28,18 @@ func NewAuthService(dbService *DBService) *AuthService {
 }
 
 // RegisterUser handles user registration and saves user to the database
-func (s *AuthService) RegisterUser(user *models.User) (*models.UserResponse, error) {
+func (s *AuthService) RegisterUser(ctx context.Context, user *models.User) (*models.UserResponse, error) {
+	// Emails identify the account for password resets, so they must be unique
+	if user.Email != "" {
+		_, err := s.DBService.GetUserByEmail(ctx, user.Email)
+		if err == nil {
+			return nil, ErrEmailTaken
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to check email: %w", err)
+		}
+	}
+
 	// Hash the password before saving to the database
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -27,7 +48,7 @@ func (s *AuthService) RegisterUser(user *models.User) (*models.UserResponse, err
 	user.Password = hashedPassword
 
 	// Save user to the database
-	err = s.DBService.SaveUser(user)
+	err = s.DBService.SaveUser(ctx, user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save user: %w", err)
 	}
@@ -36,21 +57,25 @@ func (s *AuthService) RegisterUser(user *models.User) (*models.UserResponse, err
 	return &models.UserResponse{
 		ID:       user.ID, // This will be automatically set after insertion
 		Username: user.Username,
+		Email:    user.Email,
 		Role:     user.Role,
 	}, nil
 }
 
 // LoginUser handles user login by checking the password
-func (s *AuthService) LoginUser(userRequest models.UserRequest) (*models.UserResponse, error) {
+func (s *AuthService) LoginUser(ctx context.Context, userRequest models.UserRequest) (*models.UserResponse, error) {
 	// Get the user from the database by username
-	user, err := s.DBService.GetUserByUsername(userRequest.Username)
+	user, err := s.DBService.GetUserByUsername(ctx, userRequest.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
 	}
 
 	// Check if the entered password matches the hashed password in the database
 	if !utils.CheckPasswordHash(userRequest.Password, user.Password) {
-		return nil, errors.New("invalid password")
+		return nil, ErrInvalidCredentials
 	}
 
 	// Return the user object (you may also want to return a JWT token here)
@@ -58,21 +83,25 @@ func (s *AuthService) LoginUser(userRequest models.UserRequest) (*models.UserRes
 }
 
 // AuthenticateUser authenticates a user and returns a JWT token
-func (s *AuthService) AuthenticateUser(username, password string) (*models.UserResponse, error) {
-	user, err := s.DBService.GetUserByUsername(username)
+func (s *AuthService) AuthenticateUser(ctx context.Context, username, password string) (*models.UserResponse, error) {
+	user, err := s.DBService.GetUserByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
 	}
 
-	fmt.Println("Entered password:", password)
-	fmt.Println("Stored hashed password:", user.Password)
 	if !utils.CheckPasswordHash(password, user.Password) {
-		fmt.Println("Password mismatch!")
+		return nil, ErrInvalidCredentials
 	}
 
 	return &models.UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		MFAEnabled:    user.MFAEnabled,
 	}, nil
 }
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+var (
+	ErrDuplicateBulkTarget = apperr.Conflict("duplicate_bulk_target", "the item is the target of another operation in this request")
+	// errBulkCategoryNotFound locates ErrItemCategoryNotFound in the operation's item
+	errBulkCategoryNotFound = apperr.Validation(models.FieldError{
+		Field: "item.category_id", Code: "not_found", Message: "category not found",
+	})
+)
+
+// BulkItemEntry is one operation of a bulk request. Item holds the editable fields of
+// creates and updates. Err is set when the operation was already found invalid.
+type BulkItemEntry struct {
+	Op   string
+	ID   uint64
+	Item models.ItemResponse
+	Err  error
+
+	// current is the stored item targeted by an update or delete
+	current models.ItemResponse
+}
+
+// BulkItemStore is the storage used by BulkItemService, implemented by DBService
+type BulkItemStore interface {
+	GetItemsByIDs(ctx context.Context, ids []uint64) (map[uint64]models.ItemResponse, error)
+	GetSKUOwners(ctx context.Context, skus []string) (map[string][]uint64, error)
+	GetExistingCategoryIDs(ctx context.Context, ids []uint64) (map[uint64]bool, error)
+	WriteItems(ctx context.Context, creates, updates, deletes []models.ItemResponse, actorID uint64) error
+}
+
+// BulkItemPublisher publishes the event of a bulk request, implemented by NATSService
+type BulkItemPublisher interface {
+	PublishBulkItems(ctx context.Context, event models.BulkItemEvent) error
+}
+
+// BulkItemService applies bulk item requests. The items, SKUs and categories of a
+// request are checked with one lookup each and the valid operations are written
+// together, so a database failure writes none of them.
+type BulkItemService struct {
+	Store     BulkItemStore
+	Publisher BulkItemPublisher
+}
+
+// NewBulkItemService creates a new BulkItemService instance
+func NewBulkItemService(dbService *DBService, natsService *NATSService) *BulkItemService {
+	return &BulkItemService{Store: dbService, Publisher: natsService}
+}
+
+// Apply checks and writes the operations and publishes one event for the whole request.
+// In atomic mode nothing is written unless every operation is valid, otherwise a
+// validation error locating the invalid operations is returned. In best-effort mode the valid operations are written.
+// If writing fails, atomic mode returns the error and best-effort mode marks every valid operation as failed.
+func (s *BulkItemService) Apply(ctx context.Context, entries []BulkItemEntry, mode string, actorID uint64) (*models.BulkItemResponse, error) {
+	if err := s.check(ctx, entries); err != nil {
+		return nil, err
+	}
+
+	if mode == models.BulkModeAtomic {
+		var fields []models.FieldError
+		for i, entry := range entries {
+			if entry.Err != nil {
+				fields = append(fields, bulkFieldErrors(i, entry.Err)...)
+			}
+		}
+		if len(fields) > 0 {
+			return nil, apperr.Validation(fields...).WithMessage("No items were written because some operations are invalid")
+		}
+	}
+
+	var valid []int
+	var creates, updates, deletes []models.ItemResponse
+	for i, entry := range entries {
+		if entry.Err != nil {
+			continue
+		}
+		valid = append(valid, i)
+		switch entry.Op {
+		case models.BulkOpCreate:
+			creates = append(creates, entry.Item)
+		case models.BulkOpUpdate:
+			item := entry.current
+			item.Name = entry.Item.Name
+			item.Description = entry.Item.Description
+			item.SKU = entry.Item.SKU
+			item.CategoryID = entry.Item.CategoryID
+			item.Tags = entry.Item.Tags
+			item.Price = entry.Item.Price
+			item.Currency = entry.Item.Currency
+			updates = append(updates, item)
+		case models.BulkOpDelete:
+			deletes = append(deletes, entry.current)
+		}
+	}
+
+	if err := s.Store.WriteItems(ctx, creates, updates, deletes, actorID); err != nil {
+		if mode == models.BulkModeAtomic {
+			return nil, err
+		}
+		for _, i := range valid {
+			entries[i].Err = err
+		}
+	} else {
+		created := 0
+		for _, i := range valid {
+			if entries[i].Op == models.BulkOpCreate {
+				entries[i].Item = creates[created]
+				entries[i].ID = creates[created].ID
+				created++
+			}
+		}
+	}
+
+	response := &models.BulkItemResponse{Mode: mode, Total: len(entries), Results: make([]models.BulkItemResult, len(entries))}
+	event := models.BulkItemEvent{
+		Created: []uint64{}, Updated: []uint64{}, Deleted: []uint64{},
+		ActorID: actorID, Timestamp: time.Now().UTC(),
+	}
+	for i, entry := range entries {
+		result := models.BulkItemResult{Index: i, Op: entry.Op, ID: entry.ID}
+		switch {
+		case entry.Err != nil:
+			result.Status = "failed"
+			result.Error = bulkError(ctx, entry.Err)
+			response.Failed++
+		case entry.Op == models.BulkOpCreate:
+			result.Status = "created"
+			event.Created = append(event.Created, entry.ID)
+		case entry.Op == models.BulkOpUpdate:
+			result.Status = "updated"
+			event.Updated = append(event.Updated, entry.ID)
+		case entry.Op == models.BulkOpDelete:
+			result.Status = "deleted"
+			event.Deleted = append(event.Deleted, entry.ID)
+		}
+		response.Results[i] = result
+	}
+	response.Succeeded = response.Total - response.Failed
+
+	// The items are written at this point, so a failed publish must not fail the request
+	if response.Succeeded > 0 {
+		if err := s.Publisher.PublishBulkItems(ctx, event); err != nil {
+			logger.ErrorContext(ctx, "Failed to publish bulk item event", "error", err)
+		}
+	}
+	return response, nil
+}
+
+// check sets Err on the operations that target missing items, target the same item
+// as an earlier operation, use a SKU that is already taken or use a missing category
+func (s *BulkItemService) check(ctx context.Context, entries []BulkItemEntry) error {
+	targets := map[uint64]bool{}
+	var ids []uint64
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Err != nil || entry.Op == models.BulkOpCreate {
+			continue
+		}
+		if targets[entry.ID] {
+			entry.Err = ErrDuplicateBulkTarget
+			continue
+		}
+		targets[entry.ID] = true
+		ids = append(ids, entry.ID)
+	}
+
+	existing, err := s.Store.GetItemsByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	skus := map[string]bool{}
+	var skuList []string
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Err != nil {
+			continue
+		}
+		if entry.Op != models.BulkOpCreate {
+			current, ok := existing[entry.ID]
+			if !ok {
+				entry.Err = ErrItemNotFound
+				continue
+			}
+			entry.current = current
+		}
+		if entry.Op == models.BulkOpDelete || entry.Item.SKU == "" {
+			continue
+		}
+		if skus[entry.Item.SKU] {
+			entry.Err = ErrDuplicateSKU
+			continue
+		}
+		skus[entry.Item.SKU] = true
+		skuList = append(skuList, entry.Item.SKU)
+	}
+
+	owners, err := s.Store.GetSKUOwners(ctx, skuList)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Err != nil || entry.Op == models.BulkOpDelete {
+			continue
+		}
+		for _, owner := range owners[entry.Item.SKU] {
+			if owner != entry.ID {
+				entry.Err = ErrDuplicateSKU
+				break
+			}
+		}
+	}
+
+	var categoryIDs []uint64
+	for _, entry := range entries {
+		if entry.Err == nil && entry.Op != models.BulkOpDelete && entry.Item.CategoryID != 0 {
+			categoryIDs = append(categoryIDs, entry.Item.CategoryID)
+		}
+	}
+	categories, err := s.Store.GetExistingCategoryIDs(ctx, categoryIDs)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Err == nil && entry.Op != models.BulkOpDelete && entry.Item.CategoryID != 0 && !categories[entry.Item.CategoryID] {
+			entry.Err = errBulkCategoryNotFound
+		}
+	}
+	return nil
+}
+
+// bulkError describes a failed operation. Internal errors are logged and not shown.
+func bulkError(ctx context.Context, err error) *models.BulkItemError {
+	appErr := apperr.From(err)
+	if appErr.Kind == apperr.KindInternal {
+		logger.ErrorContext(ctx, "Bulk item operation failed", "error", err)
+	}
+	return &models.BulkItemError{Code: appErr.Code, Message: appErr.Message, Fields: appErr.Fields}
+}
+
+// bulkFieldErrors locates the error of the operation at index i, e.g. "[3].item.price"
+func bulkFieldErrors(i int, err error) []models.FieldError {
+	appErr := apperr.From(err)
+	prefix := fmt.Sprintf("[%d]", i)
+	if len(appErr.Fields) == 0 {
+		return []models.FieldError{{Field: prefix, Code: appErr.Code, Message: appErr.Message}}
+	}
+	fields := make([]models.FieldError, len(appErr.Fields))
+	for n, field := range appErr.Fields {
+		fields[n] = models.FieldError{Field: prefix + "." + field.Field, Code: field.Code, Message: field.Message}
+	}
+	return fields
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+// memBulkItemStore is an in-memory BulkItemStore that counts its calls
+type memBulkItemStore struct {
+	items      map[uint64]models.ItemResponse
+	categories map[uint64]bool
+	nextID     uint64
+	writeErr   error
+
+	lookups map[string]int
+	writes  int
+}
+
+func newMemBulkItemStore() *memBulkItemStore {
+	return &memBulkItemStore{
+		items: map[uint64]models.ItemResponse{
+			1: {ID: 1, Name: "one", SKU: "SKU-1"},
+			2: {ID: 2, Name: "two", SKU: "SKU-2"},
+			3: {ID: 3, Name: "three"},
+		},
+		categories: map[uint64]bool{7: true},
+		nextID:     100,
+		lookups:    map[string]int{},
+	}
+}
+
+func (m *memBulkItemStore) GetItemsByIDs(ctx context.Context, ids []uint64) (map[uint64]models.ItemResponse, error) {
+	m.lookups["items"]++
+	found := map[uint64]models.ItemResponse{}
+	for _, id := range ids {
+		if item, ok := m.items[id]; ok {
+			found[id] = item
+		}
+	}
+	return found, nil
+}
+
+func (m *memBulkItemStore) GetSKUOwners(ctx context.Context, skus []string) (map[string][]uint64, error) {
+	m.lookups["skus"]++
+	owners := map[string][]uint64{}
+	for _, sku := range skus {
+		for id, item := range m.items {
+			if item.SKU == sku {
+				owners[sku] = append(owners[sku], id)
+			}
+		}
+	}
+	return owners, nil
+}
+
+func (m *memBulkItemStore) GetExistingCategoryIDs(ctx context.Context, ids []uint64) (map[uint64]bool, error) {
+	m.lookups["categories"]++
+	found := map[uint64]bool{}
+	for _, id := range ids {
+		if m.categories[id] {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+func (m *memBulkItemStore) WriteItems(ctx context.Context, creates, updates, deletes []models.ItemResponse, actorID uint64) error {
+	m.writes++
+	if m.writeErr != nil {
+		return m.writeErr
+	}
+	for i := range creates {
+		creates[i].ID = m.nextID
+		m.nextID++
+		m.items[creates[i].ID] = creates[i]
+	}
+	for _, item := range updates {
+		m.items[item.ID] = item
+	}
+	for _, item := range deletes {
+		delete(m.items, item.ID)
+	}
+	return nil
+}
+
+// memBulkItemPublisher records the published events
+type memBulkItemPublisher struct {
+	events []models.BulkItemEvent
+}
+
+func (p *memBulkItemPublisher) PublishBulkItems(ctx context.Context, event models.BulkItemEvent) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestBulkItemServiceApply(t *testing.T) {
+	validOps := []BulkItemEntry{
+		{Op: models.BulkOpCreate, Item: models.ItemResponse{Name: "new", SKU: "SKU-9", CategoryID: 7}},
+		{Op: models.BulkOpUpdate, ID: 1, Item: models.ItemResponse{Name: "renamed", SKU: "SKU-1"}},
+		{Op: models.BulkOpDelete, ID: 2},
+	}
+	mixedOps := []BulkItemEntry{
+		{Op: models.BulkOpCreate, Item: models.ItemResponse{Name: "new"}},
+		{Op: models.BulkOpUpdate, ID: 42, Item: models.ItemResponse{Name: "missing"}},
+		{Op: models.BulkOpUpdate, ID: 3, Item: models.ItemResponse{Name: "taken", SKU: "SKU-2"}},
+		{Op: models.BulkOpCreate, Item: models.ItemResponse{Name: "bad category", CategoryID: 8}},
+		{Op: models.BulkOpDelete, ID: 1},
+		{Op: models.BulkOpUpdate, ID: 1, Item: models.ItemResponse{Name: "deleted too"}},
+	}
+	writeErr := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		mode     string
+		entries  []BulkItemEntry
+		writeErr error
+
+		wantErr      string
+		wantStatuses []string
+		wantNames    map[uint64]string
+		wantWrites   int
+	}{
+		{
+			name: "atomic writes every operation", mode: models.BulkModeAtomic, entries: validOps,
+			wantStatuses: []string{"created", "updated", "deleted"},
+			wantNames:    map[uint64]string{1: "renamed", 3: "three", 100: "new"},
+			wantWrites:   1,
+		},
+		{
+			name: "atomic writes nothing when an operation is invalid", mode: models.BulkModeAtomic, entries: mixedOps,
+			wantErr:    "validation_failed",
+			wantNames:  map[uint64]string{1: "one", 2: "two", 3: "three"},
+			wantWrites: 0,
+		},
+		{
+			name: "atomic returns a failed write", mode: models.BulkModeAtomic, entries: validOps, writeErr: writeErr,
+			wantErr:    "internal_error",
+			wantNames:  map[uint64]string{1: "one", 2: "two", 3: "three"},
+			wantWrites: 1,
+		},
+		{
+			name: "best effort writes the valid operations", mode: models.BulkModeBestEffort, entries: mixedOps,
+			wantStatuses: []string{"created", "item_not_found", "duplicate_sku", "validation_failed", "deleted", "duplicate_bulk_target"},
+			wantNames:    map[uint64]string{2: "two", 3: "three", 100: "new"},
+			wantWrites:   1,
+		},
+		{
+			name: "best effort fails the valid operations when the write fails", mode: models.BulkModeBestEffort, entries: mixedOps, writeErr: writeErr,
+			wantStatuses: []string{"internal_error", "item_not_found", "duplicate_sku", "validation_failed", "internal_error", "duplicate_bulk_target"},
+			wantNames:    map[uint64]string{1: "one", 2: "two", 3: "three"},
+			wantWrites:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemBulkItemStore()
+			store.writeErr = tt.writeErr
+			publisher := &memBulkItemPublisher{}
+			service := &BulkItemService{Store: store, Publisher: publisher}
+			entries := append([]BulkItemEntry(nil), tt.entries...)
+
+			response, err := service.Apply(context.Background(), entries, tt.mode, 5)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("Apply() succeeded, want %s", tt.wantErr)
+				}
+				if code := apperr.From(err).Code; code != tt.wantErr {
+					t.Errorf("Apply() error code = %s, want %s", code, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Apply(): %v", err)
+				}
+				statuses := make([]string, len(response.Results))
+				for i, result := range response.Results {
+					statuses[i] = result.Status
+					if result.Error != nil {
+						statuses[i] = result.Error.Code
+					}
+				}
+				if !reflect.DeepEqual(statuses, tt.wantStatuses) {
+					t.Errorf("Apply() statuses = %v, want %v", statuses, tt.wantStatuses)
+				}
+			}
+
+			names := map[uint64]string{}
+			for id, item := range store.items {
+				names[id] = item.Name
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("stored items = %v, want %v", names, tt.wantNames)
+			}
+			if store.writes != tt.wantWrites {
+				t.Errorf("WriteItems called %d times, want %d", store.writes, tt.wantWrites)
+			}
+			for _, lookup := range []string{"items", "skus", "categories"} {
+				if store.lookups[lookup] != 1 {
+					t.Errorf("%s looked up %d times, want once", lookup, store.lookups[lookup])
+				}
+			}
+			wantEvents := 0
+			if response != nil && response.Succeeded > 0 {
+				wantEvents = 1
+			}
+			if len(publisher.events) != wantEvents {
+				t.Errorf("published %d events, want %d", len(publisher.events), wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+var (
+	ErrCategoryNotFound = apperr.NotFound("category_not_found", "category not found")
+	ErrCategoryNotEmpty = apperr.Conflict("category_not_empty", "category still has subcategories or items")
+	ErrParentNotFound   = apperr.Validation(models.FieldError{
+		Field: "parent_id", Code: "not_found", Message: "parent category not found",
+	})
+	ErrCategoryCycle = apperr.Validation(models.FieldError{
+		Field: "parent_id", Code: "category_cycle", Message: "a category cannot be moved under itself or one of its descendants",
+	})
+)
+
+// CategoryStore is the storage used by CategoryService, implemented by DBService
+type CategoryStore interface {
+	SaveCategory(ctx context.Context, category *models.Category, parentPath string) error
+	GetCategory(ctx context.Context, id uint64) (models.Category, error)
+	GetCategories(ctx context.Context) ([]models.Category, error)
+	FillCategoryItemCounts(ctx context.Context, categories []models.Category, pathPrefix string) error
+	UpdateCategory(ctx context.Context, category *models.Category, newPath string) error
+	DeleteCategory(ctx context.Context, id uint64) error
+	CountChildCategories(ctx context.Context, id uint64) (uint64, error)
+	CountCategoryItems(ctx context.Context, id uint64) (uint64, error)
+}
+
+// CategoryService manages the item category tree
+type CategoryService struct {
+	Store CategoryStore
+}
+
+// NewCategoryService creates a new CategoryService instance
+func NewCategoryService(dbService *DBService) *CategoryService {
+	return &CategoryService{Store: dbService}
+}
+
+// Create adds a category under request.ParentID, or at the root when it is 0
+func (s *CategoryService) Create(ctx context.Context, request models.CategoryRequest) (*models.Category, error) {
+	parentPath, err := s.parentPath(ctx, request.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	category := models.Category{Name: request.Name, ParentID: request.ParentID}
+	if err := s.Store.SaveCategory(ctx, &category, parentPath); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Get returns a category with its item counts
+func (s *CategoryService) Get(ctx context.Context, id uint64) (*models.Category, error) {
+	category, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []models.Category{category}
+	if err := s.Store.FillCategoryItemCounts(ctx, categories, category.Path); err != nil {
+		return nil, err
+	}
+	return &categories[0], nil
+}
+
+// List returns all categories with their item counts
+func (s *CategoryService) List(ctx context.Context) ([]models.Category, error) {
+	return s.Store.GetCategories(ctx)
+}
+
+// Update renames a category and moves it, with its subtree, under request.ParentID.
+// Moving a category under itself or one of its descendants is rejected.
+func (s *CategoryService) Update(ctx context.Context, id uint64, request models.CategoryRequest) (*models.Category, error) {
+	category, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	newPath := category.Path
+	if request.ParentID != category.ParentID {
+		parentPath, err := s.parentPath(ctx, request.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		// The new parent is in the subtree when its path starts with the category's path
+		if strings.HasPrefix(parentPath, category.Path) {
+			return nil, ErrCategoryCycle
+		}
+		newPath = categoryPath(parentPath, id)
+	}
+
+	category.Name = request.Name
+	category.ParentID = request.ParentID
+	if err := s.Store.UpdateCategory(ctx, &category, newPath); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Delete removes a category that has no subcategories and no items
+func (s *CategoryService) Delete(ctx context.Context, id uint64) error {
+	if _, err := s.get(ctx, id); err != nil {
+		return err
+	}
+
+	children, err := s.Store.CountChildCategories(ctx, id)
+	if err != nil {
+		return err
+	}
+	items, err := s.Store.CountCategoryItems(ctx, id)
+	if err != nil {
+		return err
+	}
+	if children > 0 || items > 0 {
+		return ErrCategoryNotEmpty
+	}
+	return s.Store.DeleteCategory(ctx, id)
+}
+
+func (s *CategoryService) get(ctx context.Context, id uint64) (models.Category, error) {
+	category, err := s.Store.GetCategory(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Category{}, ErrCategoryNotFound
+	}
+	if err != nil {
+		return models.Category{}, fmt.Errorf("failed to fetch category: %w", err)
+	}
+	return category, nil
+}
+
+// parentPath returns the path of the parent category, empty for root categories
+func (s *CategoryService) parentPath(ctx context.Context, parentID uint64) (string, error) {
+	if parentID == 0 {
+		return "", nil
+	}
+	parent, err := s.Store.GetCategory(ctx, parentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrParentNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch parent category: %w", err)
+	}
+	return parent.Path, nil
+}
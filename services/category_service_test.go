@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go-clickhouse-example/models"
+)
+
+// memCategoryStore is an in-memory CategoryStore holding the tree
+//
+//	/1/ -> /1/2/ -> /1/2/3/
+//	/4/
+//	/12/
+type memCategoryStore struct {
+	CategoryStore
+
+	categories map[uint64]models.Category
+	// movedTo is the path passed to the last UpdateCategory
+	movedTo string
+}
+
+func newMemCategoryStore() *memCategoryStore {
+	return &memCategoryStore{categories: map[uint64]models.Category{
+		1:  {ID: 1, Name: "one", Path: "/1/"},
+		2:  {ID: 2, ParentID: 1, Name: "two", Path: "/1/2/"},
+		3:  {ID: 3, ParentID: 2, Name: "three", Path: "/1/2/3/"},
+		4:  {ID: 4, Name: "four", Path: "/4/"},
+		12: {ID: 12, Name: "twelve", Path: "/12/"},
+	}}
+}
+
+func (m *memCategoryStore) GetCategory(ctx context.Context, id uint64) (models.Category, error) {
+	category, ok := m.categories[id]
+	if !ok {
+		return models.Category{}, sql.ErrNoRows
+	}
+	return category, nil
+}
+
+func (m *memCategoryStore) UpdateCategory(ctx context.Context, category *models.Category, newPath string) error {
+	m.movedTo = newPath
+	category.Path = newPath
+	return nil
+}
+
+func TestCategoryServiceUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       uint64
+		parentID uint64
+		wantErr  error
+		wantPath string
+	}{
+		{"under itself", 1, 1, ErrCategoryCycle, ""},
+		{"under its child", 1, 2, ErrCategoryCycle, ""},
+		{"under its grandchild", 1, 3, ErrCategoryCycle, ""},
+		{"child under itself", 2, 2, ErrCategoryCycle, ""},
+		{"child under its child", 2, 3, ErrCategoryCycle, ""},
+		{"under a category whose path starts with the same digits", 1, 12, nil, "/12/1/"},
+		{"under another root", 2, 4, nil, "/4/2/"},
+		{"under an ancestor", 3, 1, nil, "/1/3/"},
+		{"to the root", 2, 0, nil, "/2/"},
+		{"same parent", 3, 2, nil, "/1/2/3/"},
+		{"missing parent", 2, 99, ErrParentNotFound, ""},
+		{"missing category", 99, 1, ErrCategoryNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemCategoryStore()
+			service := &CategoryService{Store: store}
+
+			category, err := service.Update(context.Background(), tt.id, models.CategoryRequest{Name: "renamed", ParentID: tt.parentID})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Update(%d, parent %d) error = %v, want %v", tt.id, tt.parentID, err, tt.wantErr)
+				}
+				if store.movedTo != "" {
+					t.Errorf("Update(%d, parent %d) moved the category to %s", tt.id, tt.parentID, store.movedTo)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Update(%d, parent %d): %v", tt.id, tt.parentID, err)
+			}
+			if category.Path != tt.wantPath || category.ParentID != tt.parentID || category.Name != "renamed" {
+				t.Errorf("Update(%d, parent %d) = %s under %d named %q, want %s under %d named \"renamed\"",
+					tt.id, tt.parentID, category.Path, category.ParentID, category.Name, tt.wantPath, tt.parentID)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// clickhouseHTTP sends queries straight to ClickHouse's HTTP interface, for results
+// that ClickHouse formats itself and that are streamed to clients unchanged
+type clickhouseHTTP struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+}
+
+// newClickHouseHTTP reads the address and credentials of an HTTP DSN
+func newClickHouseHTTP(dsn string) (*clickhouseHTTP, error) {
+	options, err := clickhouse.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if len(options.Addr) == 0 {
+		return nil, fmt.Errorf("no ClickHouse address in %q", dsn)
+	}
+
+	scheme := "http"
+	if options.TLS != nil {
+		scheme = "https"
+	}
+	endpoint := url.URL{Scheme: scheme, Host: options.Addr[0], Path: "/" + strings.TrimPrefix(options.HttpUrlPath, "/")}
+	if options.Auth.Database != "" {
+		endpoint.RawQuery = url.Values{"database": {options.Auth.Database}}.Encode()
+	}
+
+	headers := map[string]string{}
+	for key, value := range options.HttpHeaders {
+		headers[key] = value
+	}
+	if options.Auth.Username != "" {
+		headers["X-ClickHouse-User"] = options.Auth.Username
+		headers["X-ClickHouse-Key"] = options.Auth.Password
+	}
+	return &clickhouseHTTP{client: &http.Client{}, endpoint: endpoint.String(), headers: headers}, nil
+}
+
+// stream runs the query and returns the response body, which the caller must close.
+// The ? placeholders are sent as typed query parameters rather than spliced into the SQL.
+func (ch *clickhouseHTTP) stream(ctx context.Context, query string, params ...interface{}) (io.ReadCloser, error) {
+	query, values, err := serverParams(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.endpoint, strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	if request.URL.RawQuery != "" {
+		request.URL.RawQuery += "&"
+	}
+	request.URL.RawQuery += values.Encode()
+	for key, value := range ch.headers {
+		request.Header.Set(key, value)
+	}
+
+	ctx, done := startQuery(ctx, dbOperation(), query)
+	response, err := ch.client.Do(request.WithContext(ctx))
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		err := fmt.Errorf("clickhouse returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+		done(err)
+		return nil, err
+	}
+	done(nil)
+	return response.Body, nil
+}
+
+// serverParams replaces each ? of the query with a typed {pN:Type} parameter and
+// returns the matching param_pN values
+func serverParams(query string, params []interface{}) (string, url.Values, error) {
+	values := url.Values{}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		if n >= len(params) {
+			return "", nil, fmt.Errorf("missing query parameter %d", n)
+		}
+		typ, value, err := serverParam(params[n])
+		if err != nil {
+			return "", nil, err
+		}
+		name := "p" + strconv.Itoa(n)
+		fmt.Fprintf(&b, "{%s:%s}", name, typ)
+		values.Set("param_"+name, value)
+		n++
+	}
+	if n != len(params) {
+		return "", nil, fmt.Errorf("query has %d placeholders for %d parameters", n, len(params))
+	}
+	return b.String(), values, nil
+}
+
+// serverParam returns the ClickHouse type and the text of a parameter value.
+// Values are read in ClickHouse's escaped format, so backslashes, tabs and newlines
+// are escaped.
+func serverParam(param interface{}) (string, string, error) {
+	if valuer, ok := param.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return "", "", err
+		}
+		param = value
+	}
+
+	switch v := param.(type) {
+	case string:
+		return "String", escapeParam(v), nil
+	case uint64:
+		return "UInt64", strconv.FormatUint(v, 10), nil
+	case int:
+		return "Int64", strconv.Itoa(v), nil
+	case int64:
+		return "Int64", strconv.FormatInt(v, 10), nil
+	case bool:
+		return "Bool", strconv.FormatBool(v), nil
+	case time.Time:
+		return "DateTime64(3, 'UTC')", v.UTC().Format("2006-01-02 15:04:05.000"), nil
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+		}
+		return "Array(String)", escapeParam("[" + strings.Join(quoted, ",") + "]"), nil
+	case []uint64:
+		numbers := make([]string, len(v))
+		for i, id := range v {
+			numbers[i] = strconv.FormatUint(id, 10)
+		}
+		return "Array(UInt64)", "[" + strings.Join(numbers, ",") + "]", nil
+	}
+	return "", "", fmt.Errorf("unsupported query parameter type %T", param)
+}
+
+func escapeParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerParam(t *testing.T) {
+	tests := []struct {
+		name      string
+		param     interface{}
+		wantType  string
+		wantValue string
+	}{
+		{"string", "Widget", "String", "Widget"},
+		{"quotes are kept", "O'Brien \"Pro\"", "String", "O'Brien \"Pro\""},
+		{"escaped characters", "a\tb\nc\\d", "String", `a\tb\nc\\d`},
+		{"placeholder in a value", "a ? b", "String", "a ? b"},
+		{"uint64", uint64(42), "UInt64", "42"},
+		{"int", -3, "Int64", "-3"},
+		{"int64", int64(9007199254740993), "Int64", "9007199254740993"},
+		{"bool", true, "Bool", "true"},
+		{"time in UTC", time.Date(2024, 1, 2, 3, 4, 5, 6e6, time.FixedZone("CET", 3600)),
+			"DateTime64(3, 'UTC')", "2024-01-02 02:04:05.006"},
+		{"valuer", mustMoney(t, "19.990"), "String", "19.99"},
+		{"strings", []string{"a", "b c"}, "Array(String)", "['a','b c']"},
+		{"strings with quotes and backslashes", []string{"a'b", `c\d`, "e\tf"}, "Array(String)", `['a\\'b','c\\\\d','e\tf']`},
+		{"no strings", []string{}, "Array(String)", "[]"},
+		{"uint64s", []uint64{1, 2, 3}, "Array(UInt64)", "[1,2,3]"},
+		{"no uint64s", []uint64{}, "Array(UInt64)", "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ, value, err := serverParam(tt.param)
+			if err != nil {
+				t.Fatalf("serverParam(%#v): %v", tt.param, err)
+			}
+			if typ != tt.wantType || value != tt.wantValue {
+				t.Errorf("serverParam(%#v) = %s %q, want %s %q", tt.param, typ, value, tt.wantType, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestServerParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		params     []interface{}
+		wantQuery  string
+		wantValues url.Values
+		wantErr    string
+	}{
+		{
+			name:       "placeholders are numbered",
+			query:      "SELECT * FROM items WHERE sku = ? AND id > ? AND has(?, id)",
+			params:     []interface{}{"W-1", uint64(7), []uint64{8, 9}},
+			wantQuery:  "SELECT * FROM items WHERE sku = {p0:String} AND id > {p1:UInt64} AND has({p2:Array(UInt64)}, id)",
+			wantValues: url.Values{"param_p0": {"W-1"}, "param_p1": {"7"}, "param_p2": {"[8,9]"}},
+		},
+		{
+			name:       "no placeholders",
+			query:      "SELECT 1",
+			wantQuery:  "SELECT 1",
+			wantValues: url.Values{},
+		},
+		{
+			name:       "values are not interpolated",
+			query:      "SELECT ?",
+			params:     []interface{}{"'; DROP TABLE items; --"},
+			wantQuery:  "SELECT {p0:String}",
+			wantValues: url.Values{"param_p0": {"'; DROP TABLE items; --"}},
+		},
+		{name: "missing parameter", query: "SELECT ?, ?", params: []interface{}{"a"}, wantErr: "missing query parameter 1"},
+		{name: "extra parameter", query: "SELECT ?", params: []interface{}{"a", "b"}, wantErr: "query has 1 placeholders for 2 parameters"},
+		{name: "unsupported type", query: "SELECT ?", params: []interface{}{1.5}, wantErr: "unsupported query parameter type float64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, values, err := serverParams(tt.query, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("serverParams(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("serverParams(%q): %v", tt.query, err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("serverParams(%q) query = %q, want %q", tt.query, query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("serverParams(%q) values = %v, want %v", tt.query, values, tt.wantValues)
+			}
+		})
+	}
+}
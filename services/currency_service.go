@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrUnsupportedCurrency = apperr.Invalid("unsupported_currency", "unsupported currency")
+	ErrInvalidRate         = apperr.Invalid("invalid_rate", "exchange rate must be positive")
+	ErrNoExchangeRate      = apperr.Invalid("no_exchange_rate", "no exchange rate for currency pair")
+)
+
+// CurrencyService validates item prices and converts them between currencies
+// using the exchange rates maintained by admins
+type CurrencyService struct {
+	DBService       *DBService
+	DefaultCurrency string
+}
+
+// NewCurrencyService creates a new CurrencyService instance
+func NewCurrencyService(dbService *DBService, defaultCurrency string) *CurrencyService {
+	return &CurrencyService{DBService: dbService, DefaultCurrency: strings.ToUpper(defaultCurrency)}
+}
+
+// NormalizeCurrency upper-cases the currency code, returning the default currency when empty
+func (s *CurrencyService) NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = s.DefaultCurrency
+	}
+	if _, ok := models.CurrencyMinorUnits(currency); !ok {
+		return "", ErrUnsupportedCurrency.WithMessage(fmt.Sprintf("unsupported currency %q", currency))
+	}
+	return currency, nil
+}
+
+// ValidatePrice checks the price against the minor units of its currency and returns
+// the normalized currency code
+func (s *CurrencyService) ValidatePrice(price models.Money, currency string) (string, error) {
+	currency, err := s.NormalizeCurrency(currency)
+	if err != nil {
+		return "", err
+	}
+	if err := models.ValidateMoney(price, currency); err != nil {
+		return "", err
+	}
+	return currency, nil
+}
+
+// SetRate stores the exchange rate from rate.Base to rate.Quote
+func (s *CurrencyService) SetRate(ctx context.Context, rate *models.ExchangeRate, userID uint64) error {
+	var err error
+	if rate.Base, err = s.NormalizeCurrency(rate.Base); err != nil {
+		return err
+	}
+	if rate.Quote, err = s.NormalizeCurrency(rate.Quote); err != nil {
+		return err
+	}
+	if rate.Base == rate.Quote || !rate.Rate.IsPositive() {
+		return ErrInvalidRate
+	}
+
+	rate.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	rate.UpdatedBy = userID
+	return s.DBService.SaveExchangeRate(ctx, *rate)
+}
+
+// ListRates returns the current exchange rates
+func (s *CurrencyService) ListRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	return s.DBService.GetExchangeRates(ctx)
+}
+
+// ConvertItems converts the prices of items into currency in place. The rates are
+// read once, an item whose currency cannot be converted fails the whole call.
+func (s *CurrencyService) ConvertItems(ctx context.Context, items []models.ItemResponse, currency string) error {
+	currency, err := s.NormalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+
+	rates, err := s.ListRates(ctx)
+	if err != nil {
+		return err
+	}
+	table := make(map[[2]string]decimal.Decimal, len(rates))
+	for _, rate := range rates {
+		table[[2]string{rate.Base, rate.Quote}] = rate.Rate
+	}
+
+	units, _ := models.CurrencyMinorUnits(currency)
+	for i := range items {
+		rate, ok := s.lookupRate(table, items[i].Currency, currency)
+		if !ok {
+			return ErrNoExchangeRate.WithMessage(fmt.Sprintf("no exchange rate for %s/%s", items[i].Currency, currency))
+		}
+		items[i].Price = models.Money{Decimal: items[i].Price.Mul(rate).Round(units)}
+		items[i].Currency = currency
+	}
+	return nil
+}
+
+// lookupRate finds the rate from one currency to another, directly, through the
+// inverse pair, or through the default currency
+func (s *CurrencyService) lookupRate(table map[[2]string]decimal.Decimal, from, to string) (decimal.Decimal, bool) {
+	direct := func(from, to string) (decimal.Decimal, bool) {
+		if from == to {
+			return decimal.NewFromInt(1), true
+		}
+		if rate, ok := table[[2]string{from, to}]; ok {
+			return rate, true
+		}
+		if rate, ok := table[[2]string{to, from}]; ok && rate.IsPositive() {
+			return decimal.NewFromInt(1).DivRound(rate, 12), true
+		}
+		return decimal.Decimal{}, false
+	}
+
+	if rate, ok := direct(from, to); ok {
+		return rate, true
+	}
+	toDefault, ok1 := direct(from, s.DefaultCurrency)
+	fromDefault, ok2 := direct(s.DefaultCurrency, to)
+	if !ok1 || !ok2 {
+		return decimal.Decimal{}, false
+	}
+	return toDefault.Mul(fromDefault), true
+}
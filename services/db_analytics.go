@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-clickhouse-example/models"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/shopspring/decimal"
+)
+
+// analyticsContext bounds an analytics query both on the client and on the server.
+// max_execution_time makes ClickHouse stop the query instead of finishing it after
+// the client gave up.
+func analyticsContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	seconds := int(math.Ceil(timeout.Seconds()))
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"max_execution_time": seconds,
+	}))
+	return context.WithTimeout(ctx, timeout)
+}
+
+// isQueryTimeoutError reports whether ClickHouse stopped a query because of max_execution_time
+func isQueryTimeoutError(err error) bool {
+	return strings.Contains(err.Error(), "TIMEOUT_EXCEEDED")
+}
+
+// GetPriceStats returns the price statistics of the items matching the filter, one
+// entry per currency. Quantile levels are formatted into the query since parametric
+// aggregate functions cannot take bound parameters, callers must validate them.
+func (db *DBService) GetPriceStats(ctx context.Context, filter models.ItemFilter, levels []float64) ([]models.PriceStats, error) {
+	literals := make([]string, len(levels))
+	for i, level := range levels {
+		literals[i] = strconv.FormatFloat(level, 'f', -1, 64)
+	}
+
+	where, params := itemFilterClause(filter)
+	query := fmt.Sprintf(`
+	SELECT currency, count(), toDecimal64(min(price), 4), toDecimal64(max(price), 4), toDecimal64(avg(price), 4),
+		arrayMap(q -> toString(toDecimal64(q, 4)), quantilesTDigest(%s)(price))
+	FROM items %s
+	GROUP BY currency
+	ORDER BY currency
+	`, strings.Join(literals, ", "), where)
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch price statistics: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []models.PriceStats{}
+	for rows.Next() {
+		var s models.PriceStats
+		var quantiles []string
+		if err := rows.Scan(&s.Currency, &s.Count, &s.Min, &s.Max, &s.Avg, &quantiles); err != nil {
+			return nil, fmt.Errorf("failed to scan price statistics: %w", err)
+		}
+		for i, quantile := range quantiles {
+			price, err := models.NewMoney(quantile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse price quantile: %w", err)
+			}
+			s.Quantiles = append(s.Quantiles, models.PriceQuantile{Level: levels[i], Price: price})
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching price statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// GetPriceHistogramBounds counts the items matching the filter in the buckets delimited
+// by the ascending bounds, per currency. Bucket i holds the prices in
+// [bounds[i-1], bounds[i]), the first and last buckets are open-ended. Empty
+// buckets are omitted.
+func (db *DBService) GetPriceHistogramBounds(ctx context.Context, filter models.ItemFilter, bounds []models.Money) ([]models.PriceBucket, error) {
+	values := make([]string, len(bounds))
+	for i, bound := range bounds {
+		values[i] = bound.String()
+	}
+
+	where, params := itemFilterClause(filter)
+	query := `
+	SELECT currency, arrayCount(b -> price >= b, arrayMap(x -> toDecimal64(x, 4), ?)) AS bucket, count()
+	FROM items ` + where + `
+	GROUP BY currency, bucket
+	ORDER BY currency, bucket
+	`
+	params = append([]interface{}{values}, params...)
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch price histogram: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []models.PriceBucket{}
+	for rows.Next() {
+		var bucket models.PriceBucket
+		var index uint64
+		if err := rows.Scan(&bucket.Currency, &index, &bucket.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan price histogram: %w", err)
+		}
+		if index > 0 {
+			bucket.From = &bounds[index-1]
+		}
+		if index < uint64(len(bounds)) {
+			bucket.To = &bounds[index]
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching price histogram: %w", err)
+	}
+	return buckets, nil
+}
+
+// GetPriceHistogramWidth counts the items matching the filter in buckets of equal
+// width starting at zero, per currency. Empty buckets are omitted.
+func (db *DBService) GetPriceHistogramWidth(ctx context.Context, filter models.ItemFilter, width models.Money) ([]models.PriceBucket, error) {
+	// Prices are bucketed in units of the column's scale so that bucket edges are exact
+	scale := decimal.New(1, 4)
+	scaledWidth := width.Mul(scale).IntPart()
+
+	where, params := itemFilterClause(filter)
+	query := `
+	SELECT currency, intDiv(toInt64(price * 10000), ?) AS bucket, count()
+	FROM items ` + where + `
+	GROUP BY currency, bucket
+	ORDER BY currency, bucket
+	`
+	params = append([]interface{}{scaledWidth}, params...)
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch price histogram: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []models.PriceBucket{}
+	for rows.Next() {
+		var bucket models.PriceBucket
+		var index int64
+		if err := rows.Scan(&bucket.Currency, &index, &bucket.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan price histogram: %w", err)
+		}
+		from := models.Money{Decimal: width.Mul(decimal.NewFromInt(index))}
+		to := models.Money{Decimal: from.Add(width.Decimal)}
+		bucket.From, bucket.To = &from, &to
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching price histogram: %w", err)
+	}
+	return buckets, nil
+}
+
+// itemCountQueries group the items matching a filter, the filter's WHERE clause is
+// substituted for %s. Groups are ordered by decreasing count.
+var itemCountQueries = map[string]string{
+	models.ItemGroupCategory: `
+	SELECT toString(g.category_id), c.name, g.count
+	FROM (SELECT category_id, count() AS count FROM items %s GROUP BY category_id) AS g
+	LEFT JOIN categories AS c ON c.id = g.category_id
+	ORDER BY g.count DESC, g.category_id`,
+	models.ItemGroupTag: `
+	SELECT arrayJoin(tags) AS tag, '', count() AS count
+	FROM items %s
+	GROUP BY tag
+	ORDER BY count DESC, tag`,
+	models.ItemGroupCurrency: `
+	SELECT toString(currency), '', count() AS count
+	FROM items %s
+	GROUP BY currency
+	ORDER BY count DESC, currency`,
+}
+
+// GetItemCounts counts the items matching the filter grouped by category, tag or
+// currency. limit keeps only the largest groups, 0 returns all of them.
+func (db *DBService) GetItemCounts(ctx context.Context, filter models.ItemFilter, groupBy string, limit int) ([]models.ItemCount, error) {
+	groupQuery, ok := itemCountQueries[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown item grouping %q", groupBy)
+	}
+	where, params := itemFilterClause(filter)
+	query := fmt.Sprintf(groupQuery, where)
+	if limit > 0 {
+		query += " LIMIT ?"
+		params = append(params, limit)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count items: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.ItemCount{}
+	for rows.Next() {
+		var count models.ItemCount
+		if err := rows.Scan(&count.Key, &count.Name, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan item count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while counting items: %w", err)
+	}
+	return counts, nil
+}
+
+// GetTopItemsByPrice returns the limit most expensive items matching the filter of
+// each currency, or the cheapest ones if ascending is set
+func (db *DBService) GetTopItemsByPrice(ctx context.Context, filter models.ItemFilter, limit int, ascending bool) ([]models.ItemResponse, error) {
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+	where, params := itemFilterClause(filter)
+	query := fmt.Sprintf("SELECT %s FROM items %s ORDER BY currency, price %s, id LIMIT ? BY currency", itemColumns, where, order)
+	params = append(params, limit)
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch top items: %w", err)
+	}
+	defer rows.Close()
+
+	items, err := scanItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []models.ItemResponse{}
+	}
+	return items, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go-clickhouse-example/models"
+)
+
+// SaveAuditEntry appends an entry to the audit log
+func (db *DBService) SaveAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	query := `INSERT INTO audit_log (ts, actor_id, subject_id, action, method, path, status, ip, session_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.conn.ExecContext(ctx, query, entry.Timestamp, entry.ActorID, entry.SubjectID, entry.Action,
+		entry.Method, entry.Path, uint16(entry.Status), entry.IP, entry.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to save audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEntries returns the most recent audit entries, optionally filtered by actor and subject
+func (db *DBService) GetAuditEntries(ctx context.Context, actorID, subjectID uint64, limit int) ([]models.AuditEntry, error) {
+	query := "SELECT ts, actor_id, subject_id, action, method, path, status, ip, session_id FROM audit_log WHERE 1=1"
+	params := []interface{}{}
+
+	if actorID != 0 {
+		query += " AND actor_id = ?"
+		params = append(params, actorID)
+	}
+	if subjectID != 0 {
+		query += " AND subject_id = ?"
+		params = append(params, subjectID)
+	}
+	query += " ORDER BY ts DESC LIMIT ?"
+	params = append(params, limit)
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var status uint16
+		err := rows.Scan(&entry.Timestamp, &entry.ActorID, &entry.SubjectID, &entry.Action,
+			&entry.Method, &entry.Path, &status, &entry.IP, &entry.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.Status = int(status)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching audit entries: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+const categoryColumns = `id, parent_id, name, path, created_at, updated_at`
+
+func scanCategory(row rowScanner) (models.Category, error) {
+	var category models.Category
+	err := row.Scan(&category.ID, &category.ParentID, &category.Name, &category.Path,
+		&category.CreatedAt, &category.UpdatedAt)
+	return category, err
+}
+
+// categoryClause returns the condition selecting items of a category, or of its
+// whole subtree. The subtree is resolved inside ClickHouse: since a path lists all
+// ancestors, the subtree is every category whose path contains "/<id>/".
+func categoryClause(categoryID uint64, includeDescendants bool) (string, []interface{}) {
+	if !includeDescendants {
+		return "category_id = ?", []interface{}{categoryID}
+	}
+	return "category_id IN (SELECT id FROM categories WHERE position(path, ?) > 0)",
+		[]interface{}{fmt.Sprintf("/%d/", categoryID)}
+}
+
+// SaveCategory inserts a new category, assigning its ID, path and timestamps.
+// parentPath is the path of the parent category, empty for root categories.
+func (db *DBService) SaveCategory(ctx context.Context, category *models.Category, parentPath string) error {
+	var nextID uint64
+	err := db.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(last_id), 0) + 1 FROM category_sequence").Scan(&nextID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch next category ID: %w", err)
+	}
+	if _, err := db.conn.ExecContext(ctx, "INSERT INTO category_sequence (last_id) VALUES (?)", nextID); err != nil {
+		return fmt.Errorf("failed to update category sequence: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	category.ID = nextID
+	category.Path = categoryPath(parentPath, nextID)
+	category.CreatedAt = now
+	category.UpdatedAt = now
+
+	query := `INSERT INTO categories (` + categoryColumns + `) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = db.conn.ExecContext(ctx, query, category.ID, category.ParentID, category.Name, category.Path,
+		category.CreatedAt, category.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert category: %w", err)
+	}
+	return nil
+}
+
+// categoryPath appends the category ID to its parent's path
+func categoryPath(parentPath string, id uint64) string {
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	return fmt.Sprintf("%s%d/", parentPath, id)
+}
+
+// GetCategory returns the category, or sql.ErrNoRows
+func (db *DBService) GetCategory(ctx context.Context, id uint64) (models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = ?`
+	return scanCategory(db.conn.QueryRowContext(ctx, query, id))
+}
+
+// GetExistingCategoryIDs returns which of the given category IDs exist
+func (db *DBService) GetExistingCategoryIDs(ctx context.Context, ids []uint64) (map[uint64]bool, error) {
+	existing := make(map[uint64]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT id FROM categories WHERE has(?, id)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan category ID: %w", err)
+		}
+		existing[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while checking categories: %w", err)
+	}
+	return existing, nil
+}
+
+// UpdateCategory renames the category and moves it under a new parent. When the
+// path changes, the paths of all its descendants are rewritten as well.
+func (db *DBService) UpdateCategory(ctx context.Context, category *models.Category, newPath string) error {
+	category.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	query := `ALTER TABLE categories UPDATE name = ?, parent_id = ?, updated_at = ? WHERE id = ?`
+	_, err := db.conn.ExecContext(mutationContext(ctx), query, category.Name, category.ParentID, category.UpdatedAt, category.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update category: %w", err)
+	}
+
+	if newPath != category.Path {
+		// Replace the old path prefix of the category and its subtree
+		query := `ALTER TABLE categories UPDATE path = concat(?, substring(path, ?)) WHERE startsWith(path, ?)`
+		_, err := db.conn.ExecContext(mutationContext(ctx), query, newPath, len(category.Path)+1, category.Path)
+		if err != nil {
+			return fmt.Errorf("failed to move category: %w", err)
+		}
+		category.Path = newPath
+	}
+	return nil
+}
+
+// DeleteCategory removes a category
+func (db *DBService) DeleteCategory(ctx context.Context, id uint64) error {
+	_, err := db.conn.ExecContext(mutationContext(ctx), `ALTER TABLE categories DELETE WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+	return nil
+}
+
+// CountChildCategories returns the number of direct children of the category
+func (db *DBService) CountChildCategories(ctx context.Context, id uint64) (uint64, error) {
+	var count uint64
+	if err := db.conn.QueryRowContext(ctx, `SELECT count() FROM categories WHERE parent_id = ?`, id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count child categories: %w", err)
+	}
+	return count, nil
+}
+
+// CountCategoryItems returns the number of items directly in the category, not counting the trash
+func (db *DBService) CountCategoryItems(ctx context.Context, id uint64) (uint64, error) {
+	var count uint64
+	if err := db.conn.QueryRowContext(ctx, `SELECT count() FROM items WHERE category_id = ? AND deleted_at IS NULL`, id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count category items: %w", err)
+	}
+	return count, nil
+}
+
+// GetCategories returns all categories ordered so that each subtree is contiguous,
+// with their direct and subtree item counts
+func (db *DBService) GetCategories(ctx context.Context) ([]models.Category, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY path`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching categories: %w", err)
+	}
+
+	if err := db.FillCategoryItemCounts(ctx, categories, ""); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// FillCategoryItemCounts sets the item counts of the categories. Every item is
+// counted once for each category on its category's path, so the subtree totals
+// come out of a single aggregation. Only items under pathPrefix are counted,
+// an empty prefix counts all items.
+func (db *DBService) FillCategoryItemCounts(ctx context.Context, categories []models.Category, pathPrefix string) error {
+	query := `
+	SELECT toUInt64(ancestor) AS id,
+		sumIf(cnt, category_id = toUInt64(ancestor)) AS direct_count,
+		sum(cnt) AS total_count
+	FROM (
+		SELECT ic.category_id AS category_id, ic.cnt AS cnt, c.path AS path
+		FROM (SELECT category_id, count() AS cnt FROM items WHERE deleted_at IS NULL GROUP BY category_id) AS ic
+		INNER JOIN categories AS c ON c.id = ic.category_id
+		WHERE startsWith(c.path, ?)
+	)
+	ARRAY JOIN arrayFilter(x -> x != '', splitByChar('/', path)) AS ancestor
+	GROUP BY id
+	`
+	rows, err := db.conn.QueryContext(ctx, query, pathPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to count category items: %w", err)
+	}
+	defer rows.Close()
+
+	index := make(map[uint64]int, len(categories))
+	for i, category := range categories {
+		index[category.ID] = i
+	}
+	for rows.Next() {
+		var id, direct, total uint64
+		if err := rows.Scan(&id, &direct, &total); err != nil {
+			return fmt.Errorf("failed to scan category item counts: %w", err)
+		}
+		if i, ok := index[id]; ok {
+			categories[i].ItemCount = direct
+			categories[i].TotalItemCount = total
+		}
+	}
+	return rows.Err()
+}
+
+// GetItemsByCategory returns the items of a category, or of its whole subtree
+func (db *DBService) GetItemsByCategory(ctx context.Context, categoryID uint64, includeDescendants bool) ([]models.ItemResponse, error) {
+	where, params := categoryClause(categoryID, includeDescendants)
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+itemColumns+` FROM items WHERE deleted_at IS NULL AND `+where+` ORDER BY id`, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch items: %w", err)
+	}
+	defer rows.Close()
+
+	return scanItems(rows)
+}
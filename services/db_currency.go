@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go-clickhouse-example/models"
+)
+
+// SaveExchangeRate stores the rate of a currency pair, replacing the previous one
+func (db *DBService) SaveExchangeRate(ctx context.Context, rate models.ExchangeRate) error {
+	query := `INSERT INTO exchange_rates (base, quote, rate, updated_at, updated_by) VALUES (?, ?, toDecimal64(?, 8), ?, ?)`
+	_, err := db.conn.ExecContext(ctx, query, rate.Base, rate.Quote, rate.Rate.String(), rate.UpdatedAt, rate.UpdatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to save exchange rate: %w", err)
+	}
+	return nil
+}
+
+// GetExchangeRates returns the latest rate of every currency pair
+func (db *DBService) GetExchangeRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT base, quote, rate, updated_at, updated_by FROM exchange_rates FINAL ORDER BY base, quote`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		var amount models.Money
+		if err := rows.Scan(&rate.Base, &rate.Quote, &amount, &rate.UpdatedAt, &rate.UpdatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %w", err)
+		}
+		rate.Rate = amount.Decimal
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching exchange rates: %w", err)
+	}
+	return rates, nil
+}
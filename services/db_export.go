@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go-clickhouse-example/models"
+)
+
+// exportFormats maps export formats to the ClickHouse output formats producing them
+var exportFormats = map[string]string{
+	models.ExportFormatCSV:     "CSVWithNames",
+	models.ExportFormatNDJSON:  "JSONEachRow",
+	models.ExportFormatParquet: "Parquet",
+	models.ExportFormatArrow:   "ArrowStream",
+}
+
+// ExportItems streams every item matching the filter to w in the given format, as
+// produced by ClickHouse. Pagination options of the filter are ignored.
+func (db *DBService) ExportItems(ctx context.Context, filter models.ItemFilter, format string, w io.Writer) error {
+	outputFormat, ok := exportFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	where, params := itemFilterClause(filter)
+	orderBy, orderParams := itemOrderBy(filter)
+	query := fmt.Sprintf("SELECT %s FROM items %s ORDER BY %s FORMAT %s", itemColumns, where, orderBy, outputFormat)
+	params = append(params, orderParams...)
+	body, err := db.http.stream(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("failed to export items: %w", err)
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(w, body); err != nil {
+		return fmt.Errorf("failed to stream items: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+const importColumns = `id, filename, format, mapping, status, size_bytes, processed_bytes, processed_rows,
+	created_items, updated_items, failed_rows, error, created_by, created_at, updated_at, finished_at, instance_id`
+
+func scanImport(row rowScanner) (models.Import, error) {
+	var imp models.Import
+	var mapping string
+	err := row.Scan(&imp.ID, &imp.Filename, &imp.Format, &mapping, &imp.Status, &imp.SizeBytes, &imp.ProcessedBytes,
+		&imp.ProcessedRows, &imp.CreatedItems, &imp.UpdatedItems, &imp.FailedRows, &imp.Error, &imp.CreatedBy,
+		&imp.CreatedAt, &imp.UpdatedAt, &imp.FinishedAt, &imp.InstanceID)
+	if err != nil {
+		return models.Import{}, err
+	}
+	if err := json.Unmarshal([]byte(mapping), &imp.Mapping); err != nil {
+		return models.Import{}, fmt.Errorf("invalid import mapping: %w", err)
+	}
+	if imp.SizeBytes > 0 {
+		imp.Progress = float64(imp.ProcessedBytes) / float64(imp.SizeBytes)
+	}
+	return imp, nil
+}
+
+// SaveImport stores the current state of an import, the latest state wins
+func (db *DBService) SaveImport(ctx context.Context, imp models.Import) error {
+	mapping, err := json.Marshal(imp.Mapping)
+	if err != nil {
+		return fmt.Errorf("failed to encode import mapping: %w", err)
+	}
+
+	query := `INSERT INTO imports (` + importColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.conn.ExecContext(ctx, query, imp.ID, imp.Filename, imp.Format, string(mapping), imp.Status, imp.SizeBytes,
+		imp.ProcessedBytes, imp.ProcessedRows, imp.CreatedItems, imp.UpdatedItems, imp.FailedRows, imp.Error,
+		imp.CreatedBy, imp.CreatedAt, imp.UpdatedAt, imp.FinishedAt, imp.InstanceID)
+	if err != nil {
+		return fmt.Errorf("failed to save import: %w", err)
+	}
+	return nil
+}
+
+// GetImport returns the latest state of an import, or sql.ErrNoRows
+func (db *DBService) GetImport(ctx context.Context, id string) (models.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM imports FINAL WHERE id = ?`
+	return scanImport(db.conn.QueryRowContext(ctx, query, id))
+}
+
+// SaveImportHeartbeat records that the instance running imports is alive
+func (db *DBService) SaveImportHeartbeat(ctx context.Context, instanceID string, at time.Time) error {
+	query := `INSERT INTO import_instances (instance_id, heartbeat_at) VALUES (?, ?)`
+	if _, err := db.conn.ExecContext(ctx, query, instanceID, at); err != nil {
+		return fmt.Errorf("failed to save import heartbeat: %w", err)
+	}
+	return nil
+}
+
+// GetStaleImports returns the imports that are queued or running on an instance
+// that has not sent a heartbeat since the given time
+func (db *DBService) GetStaleImports(ctx context.Context, since time.Time) ([]models.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM imports FINAL
+	WHERE status IN ('queued', 'running')
+		AND instance_id NOT IN (SELECT instance_id FROM import_instances WHERE heartbeat_at >= ?)`
+	rows, err := db.conn.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch imports: %w", err)
+	}
+	defer rows.Close()
+
+	var imports []models.Import
+	for rows.Next() {
+		imp, err := scanImport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import: %w", err)
+		}
+		imports = append(imports, imp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching imports: %w", err)
+	}
+	return imports, nil
+}
+
+// SaveImportErrors appends row errors of an import with a single native batch
+func (db *DBService) SaveImportErrors(ctx context.Context, importID string, importErrors []models.ImportError) error {
+	if len(importErrors) == 0 {
+		return nil
+	}
+
+	batch, err := db.native.PrepareBatch(ctx, `INSERT INTO import_errors (import_id, row, column, code, message)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare import error batch: %w", err)
+	}
+	for _, e := range importErrors {
+		if err := batch.Append(importID, e.Row, e.Column, e.Code, e.Message); err != nil {
+			return fmt.Errorf("failed to append import error to batch: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to save import errors: %w", err)
+	}
+	return nil
+}
+
+// GetImportErrors streams the row errors of an import in row order to fn
+func (db *DBService) GetImportErrors(ctx context.Context, importID string, fn func(models.ImportError) error) error {
+	query := `SELECT row, column, code, message FROM import_errors WHERE import_id = ? ORDER BY row, column`
+	rows, err := db.conn.QueryContext(ctx, query, importID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch import errors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.ImportError
+		if err := rows.Scan(&e.Row, &e.Column, &e.Code, &e.Message); err != nil {
+			return fmt.Errorf("failed to scan import error: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go-clickhouse-example/metrics"
+	"go-clickhouse-example/tracing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of ClickHouse queries and NATS messages
+var tracer = tracing.Tracer("services")
+
+// instrumentedDB times and traces the queries made through it. Each query is
+// labelled with the DBService method making it, such as GetItemByID, and gets a
+// span below the one of the context. Queries returning rows are timed until the
+// rows start streaming.
+type instrumentedDB struct {
+	*sql.DB
+}
+
+func (db instrumentedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	_, done := startQuery(context.Background(), dbOperation(), query)
+	result, err := db.DB.Exec(query, args...)
+	done(err)
+	return result, err
+}
+
+func (db instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := startQuery(ctx, dbOperation(), query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+func (db instrumentedDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	_, done := startQuery(context.Background(), dbOperation(), query)
+	rows, err := db.DB.Query(query, args...)
+	done(err)
+	return rows, err
+}
+
+func (db instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := startQuery(ctx, dbOperation(), query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (db instrumentedDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	_, done := startQuery(context.Background(), dbOperation(), query)
+	row := db.DB.QueryRow(query, args...)
+	done(row.Err())
+	return row
+}
+
+func (db instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := startQuery(ctx, dbOperation(), query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// instrumentedNative times and traces the batches sent through the native protocol
+type instrumentedNative struct {
+	driver.Conn
+}
+
+func (conn instrumentedNative) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	operation := dbOperation()
+	batch, err := conn.Conn.PrepareBatch(ctx, query, opts...)
+	if err != nil {
+		_, done := startQuery(ctx, operation, query)
+		done(err)
+		return nil, err
+	}
+	return &instrumentedBatch{Batch: batch, ctx: ctx, operation: operation, query: query}, nil
+}
+
+// instrumentedBatch times and traces the sending of a batch
+type instrumentedBatch struct {
+	driver.Batch
+	ctx       context.Context
+	operation string
+	query     string
+}
+
+func (batch *instrumentedBatch) Send() error {
+	_, done := startQuery(batch.ctx, batch.operation, batch.query)
+	err := batch.Batch.Send()
+	done(err)
+	return err
+}
+
+// startQuery starts timing a query and its span. The returned function records
+// the query's duration and whether it failed, and ends the span.
+func startQuery(ctx context.Context, operation, query string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemClickhouse, semconv.DBOperationName(operation), semconv.DBQueryText(query)))
+	return ctx, func(err error) {
+		metrics.ClickHouseQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.ClickHouseQueryErrors.WithLabelValues(operation).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "query failed")
+		}
+		span.End()
+	}
+}
+
+// operations caches the operation names of the call sites making queries
+var operations sync.Map
+
+// dbOperation returns the name of the function calling the instrumented method,
+// without package and receiver: "GetItemByID" for (*DBService).GetItemByID
+func dbOperation() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	if operation, ok := operations.Load(pc); ok {
+		return operation.(string)
+	}
+
+	operation := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name := fn.Name()
+		// go-clickhouse-example/services.(*DBService).CreateTable.func1
+		name = name[strings.LastIndex(name, "/")+1:]
+		_, name, _ = strings.Cut(name, ".")
+		name = strings.TrimPrefix(name, "(*DBService).")
+		operation, _, _ = strings.Cut(name, ".")
+	}
+	operations.Store(pc, operation)
+	return operation
+}
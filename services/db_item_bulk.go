@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+// WriteItems writes the creates, updates and deletes of a bulk request with one
+// native batch and one mutation. The batch inserts a new row for every item: the
+// created items, the updated items with their new fields and the deleted items with
+// their trash fields set. The mutation then drops the rows the updated and deleted
+// items had. If it fails, the inserted rows are dropped instead, so the items are
+// either all written or left as they were. Until the mutation is done, readers can
+// see both rows of an updated or deleted item.
+//
+// Creates get their IDs and timestamps assigned. Updates must hold the UpdatedAt
+// they were read with and deletes must be the items as read. SKUs and categories
+// are not checked.
+func (db *DBService) WriteItems(ctx context.Context, creates, updates, deletes []models.ItemResponse, actorID uint64) error {
+	if len(creates)+len(updates)+len(deletes) == 0 {
+		return nil
+	}
+
+	var firstID uint64
+	if len(creates) > 0 {
+		var err error
+		if firstID, err = db.reserveItemIDs(ctx, len(creates)); err != nil {
+			return err
+		}
+	}
+
+	// The new rows of updated items are told apart from their old ones by updated_at
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, item := range updates {
+		if !now.After(item.UpdatedAt) {
+			now = item.UpdatedAt.Add(time.Millisecond)
+		}
+	}
+
+	createdIDs := make([]uint64, len(creates))
+	updatedIDs := make([]uint64, len(updates))
+	deletedIDs := make([]uint64, len(deletes))
+	versions := make([]models.ItemVersion, 0, len(creates)+len(updates)+len(deletes))
+	rows := make([]models.ItemResponse, 0, cap(versions))
+	for i := range creates {
+		item := &creates[i]
+		item.ID = firstID + uint64(i)
+		item.CreatedAt, item.UpdatedAt = now, now
+		item.CreatedBy, item.UpdatedBy = actorID, actorID
+		createdIDs[i] = item.ID
+		rows = append(rows, *item)
+		versions = append(versions, models.ItemVersion{ItemResponse: *item, Change: models.ItemChangeCreated, RecordedAt: now, RecordedBy: actorID})
+	}
+	for i := range updates {
+		item := &updates[i]
+		item.UpdatedAt, item.UpdatedBy = now, actorID
+		updatedIDs[i] = item.ID
+		rows = append(rows, *item)
+		versions = append(versions, models.ItemVersion{ItemResponse: *item, Change: models.ItemChangeUpdated, RecordedAt: now, RecordedBy: actorID})
+	}
+	for i, item := range deletes {
+		deletedIDs[i] = item.ID
+		versions = append(versions, models.ItemVersion{ItemResponse: item, Change: models.ItemChangeDeleted, RecordedAt: now, RecordedBy: actorID})
+		item.DeletedAt, item.DeletedBy = &now, actorID
+		rows = append(rows, item)
+	}
+
+	batch, err := db.native.PrepareBatch(ctx, `INSERT INTO items (`+trashedItemColumns+`)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare item batch: %w", err)
+	}
+	for _, item := range rows {
+		tags := item.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		err := batch.Append(item.ID, item.Name, item.Description, item.SKU, item.CategoryID, tags,
+			item.Price.Decimal, item.Currency, item.CreatedAt, item.UpdatedAt, item.CreatedBy, item.UpdatedBy,
+			item.DeletedAt, item.DeletedBy)
+		if err != nil {
+			return fmt.Errorf("failed to append item to batch: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to write items: %w", err)
+	}
+
+	query := `DELETE FROM items WHERE (has(?, id) AND updated_at < ?) OR (has(?, id) AND deleted_at IS NULL)`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, updatedIDs, now, deletedIDs); err != nil {
+		query := `DELETE FROM items WHERE has(?, id) OR (has(?, id) AND updated_at = ?) OR (has(?, id) AND deleted_at = ?)`
+		if _, undoErr := db.conn.ExecContext(mutationContext(ctx), query, createdIDs, updatedIDs, now, deletedIDs, now); undoErr != nil {
+			logger.ErrorContext(ctx, "Failed to drop the rows of a failed bulk write", "error", undoErr)
+		}
+		return fmt.Errorf("failed to replace items: %w", err)
+	}
+
+	return db.insertItemVersions(ctx, versions)
+}
+
+// GetItemsByIDs returns the items with the given IDs that exist and are not in the trash
+func (db *DBService) GetItemsByIDs(ctx context.Context, ids []uint64) (map[uint64]models.ItemResponse, error) {
+	items := make(map[uint64]models.ItemResponse, len(ids))
+	if len(ids) == 0 {
+		return items, nil
+	}
+
+	query := `SELECT ` + itemColumns + ` FROM items WHERE has(?, id) AND deleted_at IS NULL`
+	rows, err := db.conn.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch items: %w", err)
+	}
+	defer rows.Close()
+
+	found, err := scanItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range found {
+		items[item.ID] = item
+	}
+	return items, nil
+}
+
+// GetSKUOwners returns the IDs of the items using each of the given SKUs, including
+// items in the trash
+func (db *DBService) GetSKUOwners(ctx context.Context, skus []string) (map[string][]uint64, error) {
+	owners := make(map[string][]uint64)
+	if len(skus) == 0 {
+		return owners, nil
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT sku, id FROM items WHERE has(?, sku)`, skus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check SKUs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sku string
+		var id uint64
+		if err := rows.Scan(&sku, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan SKU: %w", err)
+		}
+		owners[sku] = append(owners[sku], id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while checking SKUs: %w", err)
+	}
+	return owners, nil
+}
+
+// insertItemVersions appends the snapshots to the item history with a single native
+// batch. Their Version is ignored, versions are numbered when read.
+func (db *DBService) insertItemVersions(ctx context.Context, versions []models.ItemVersion) error {
+	batch, err := db.native.PrepareBatch(ctx, `INSERT INTO item_versions (`+itemVersionColumns+`)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare item version batch: %w", err)
+	}
+	for _, v := range versions {
+		seq, err := newVersionSeq()
+		if err != nil {
+			return err
+		}
+		tags := v.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		err = batch.Append(v.ID, v.Name, v.Description, v.SKU, v.CategoryID, tags,
+			v.Price.Decimal, v.Currency, v.CreatedAt, v.UpdatedAt, v.CreatedBy, v.UpdatedBy,
+			seq, v.Change, v.RecordedAt, v.RecordedBy)
+		if err != nil {
+			return fmt.Errorf("failed to append item version to batch: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to save item versions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-clickhouse-example/models"
+)
+
+// maxFacetValues bounds the number of values returned per facet, the most frequent win
+const maxFacetValues = 100
+
+// facetFilters lists, for each facet, the facets whose filters apply to its counts
+// on top of the filters shared by all facets. A facet's counts ignore its own
+// filter, except for tags, see models.ItemFacets.
+var facetFilters = map[string][]string{
+	models.FacetCategory:   {models.FacetPriceRange},
+	models.FacetPriceRange: {models.FacetCategory},
+	models.FacetTags:       {models.FacetCategory, models.FacetPriceRange},
+}
+
+// onlyItemConditions ANDs the conditions filtering on one of the given facets. It
+// returns "1" if there are none.
+func onlyItemConditions(conditions []itemCondition, facets ...string) (string, []interface{}) {
+	var clauses []string
+	params := []interface{}{}
+	for _, condition := range conditions {
+		if condition.facet != "" && slices.Contains(facets, condition.facet) {
+			clauses = append(clauses, condition.sql)
+			params = append(params, condition.params...)
+		}
+	}
+	if len(clauses) == 0 {
+		return "1", params
+	}
+	return strings.Join(clauses, " AND "), params
+}
+
+// GetItemFacets counts the items matching the filter per value of the requested
+// facets in a single pass over the items. The WHERE clause holds the conditions
+// shared by every facet and each facet's sumMapIf adds the ones only it applies.
+// Price ranges are delimited by the ascending bounds, per currency.
+func (db *DBService) GetItemFacets(ctx context.Context, filter models.ItemFilter, facets []string, bounds []models.Money) (*models.ItemFacets, error) {
+	conditions := itemFilterConditions(filter)
+
+	var aggregates []string
+	var params []interface{}
+	for _, facet := range facets {
+		condition, conditionParams := onlyItemConditions(conditions, facetFilters[facet]...)
+		switch facet {
+		case models.FacetCategory:
+			aggregates = append(aggregates, "sumMapIf([toString(category_id)], [toUInt64(1)], "+condition+")")
+		case models.FacetTags:
+			aggregates = append(aggregates, "sumMapIf(arrayDistinct(tags), arrayMap(t -> toUInt64(1), arrayDistinct(tags)), "+condition+")")
+		case models.FacetPriceRange:
+			values := make([]string, len(bounds))
+			for i, bound := range bounds {
+				values[i] = bound.String()
+			}
+			// Keys are "currency:bucket", bucket i holding the prices in [bounds[i-1], bounds[i])
+			aggregates = append(aggregates, "sumMapIf([concat(currency, ':', toString(arrayCount(b -> price >= b, arrayMap(x -> toDecimal64(x, 4), ?))))], [toUInt64(1)], "+condition+")")
+			params = append(params, values)
+		default:
+			return nil, fmt.Errorf("unknown facet %q", facet)
+		}
+		params = append(params, conditionParams...)
+	}
+	if len(aggregates) == 0 {
+		return &models.ItemFacets{}, nil
+	}
+
+	// sumMap returns a tuple of keys and counts, which are selected as two arrays
+	var columns []string
+	for i, aggregate := range aggregates {
+		columns = append(columns, fmt.Sprintf("%s AS f%d", aggregate, i))
+	}
+	var results []string
+	for i := range aggregates {
+		results = append(results, fmt.Sprintf("f%d.1, f%d.2", i, i))
+	}
+	where, whereParams := joinItemConditions(conditions, models.FacetCategory, models.FacetPriceRange)
+	query := fmt.Sprintf("SELECT %s FROM (SELECT %s FROM items WHERE %s)",
+		strings.Join(results, ", "), strings.Join(columns, ", "), where)
+	params = append(params, whereParams...)
+
+	keys := make([][]string, len(facets))
+	counts := make([][]uint64, len(facets))
+	dest := make([]interface{}, 0, 2*len(facets))
+	for i := range facets {
+		dest = append(dest, &keys[i], &counts[i])
+	}
+	if err := db.conn.QueryRowContext(ctx, query, params...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to count facets: %w", err)
+	}
+
+	result := &models.ItemFacets{}
+	for i, facet := range facets {
+		switch facet {
+		case models.FacetCategory:
+			values := facetCounts(keys[i], counts[i])
+			if err := db.nameCategoryFacets(ctx, values); err != nil {
+				return nil, err
+			}
+			result.Category = values
+		case models.FacetTags:
+			result.Tags = facetCounts(keys[i], counts[i])
+		case models.FacetPriceRange:
+			ranges, err := priceRangeFacets(keys[i], counts[i], bounds)
+			if err != nil {
+				return nil, err
+			}
+			result.PriceRange = ranges
+		}
+	}
+	return result, nil
+}
+
+// facetCounts pairs facet values with their counts, most frequent first
+func facetCounts(keys []string, counts []uint64) []models.ItemCount {
+	values := make([]models.ItemCount, len(keys))
+	for i, key := range keys {
+		values[i] = models.ItemCount{Key: key, Count: counts[i]}
+	}
+	slices.SortFunc(values, func(a, b models.ItemCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Key, b.Key))
+	})
+	if len(values) > maxFacetValues {
+		values = values[:maxFacetValues]
+	}
+	return values
+}
+
+// nameCategoryFacets sets the names of the categories of a category facet
+func (db *DBService) nameCategoryFacets(ctx context.Context, values []models.ItemCount) error {
+	if len(values) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.ParseUint(value.Key, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid category facet %q", value.Key)
+		}
+		ids = append(ids, id)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT toString(id), name FROM categories WHERE has(?, id)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to fetch category names: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return fmt.Errorf("failed to scan category name: %w", err)
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error occurred while fetching category names: %w", err)
+	}
+	for i := range values {
+		values[i].Name = names[values[i].Key]
+	}
+	return nil
+}
+
+// priceRangeFacets turns "currency:bucket" keys into price buckets, ordered by
+// currency and price
+func priceRangeFacets(keys []string, counts []uint64, bounds []models.Money) ([]models.PriceBucket, error) {
+	type indexedBucket struct {
+		index  int
+		bucket models.PriceBucket
+	}
+	indexed := make([]indexedBucket, 0, len(keys))
+	for i, key := range keys {
+		currency, value, _ := strings.Cut(key, ":")
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 || index > len(bounds) {
+			return nil, fmt.Errorf("invalid price range facet %q", key)
+		}
+		bucket := models.PriceBucket{Currency: currency, Count: counts[i]}
+		if index > 0 {
+			bucket.From = &bounds[index-1]
+		}
+		if index < len(bounds) {
+			bucket.To = &bounds[index]
+		}
+		indexed = append(indexed, indexedBucket{index: index, bucket: bucket})
+	}
+	slices.SortFunc(indexed, func(a, b indexedBucket) int {
+		return cmp.Or(cmp.Compare(a.bucket.Currency, b.bucket.Currency), cmp.Compare(a.index, b.index))
+	})
+
+	buckets := make([]models.PriceBucket, len(indexed))
+	for i, b := range indexed {
+		buckets[i] = b.bucket
+	}
+	return buckets, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+var ErrItemVersionNotFound = apperr.NotFound("item_version_not_found", "item version not found")
+
+// itemVersionColumns are the columns item versions are inserted with
+const itemVersionColumns = itemColumns + `, seq, change, recorded_at, recorded_by`
+
+// itemVersionsQuery selects the versions of the item given as parameter, numbered
+// from 1 in the order they were recorded
+const itemVersionsQuery = `
+	SELECT ` + itemColumns + `,
+		toUInt32(row_number() OVER (ORDER BY recorded_at, seq)) AS version_number,
+		change, recorded_at, recorded_by
+	FROM item_versions
+	WHERE id = ?`
+
+// backfillItemVersionsQuery records a first version for items saved before versions were kept
+const backfillItemVersionsQuery = `
+	INSERT INTO item_versions (` + itemVersionColumns + `)
+	SELECT ` + itemColumns + `, 0, 'created', updated_at, updated_by
+	FROM items
+	`
+
+func scanItemVersion(row rowScanner) (models.ItemVersion, error) {
+	var v models.ItemVersion
+	err := row.Scan(&v.ID, &v.Name, &v.Description, &v.SKU, &v.CategoryID, &v.Tags,
+		&v.Price, &v.Currency, &v.CreatedAt, &v.UpdatedAt, &v.CreatedBy, &v.UpdatedBy,
+		&v.Version, &v.Change, &v.RecordedAt, &v.RecordedBy)
+	if err != nil {
+		return models.ItemVersion{}, err
+	}
+	return v, nil
+}
+
+// saveItemVersion appends a snapshot of the item to its history
+func (db *DBService) saveItemVersion(ctx context.Context, item models.ItemResponse, change string, at time.Time, by uint64) error {
+	seq, err := newVersionSeq()
+	if err != nil {
+		return err
+	}
+	if item.Tags == nil {
+		item.Tags = []string{}
+	}
+
+	query := `INSERT INTO item_versions (` + itemVersionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.conn.ExecContext(ctx, query, item.ID, item.Name, item.Description, item.SKU, item.CategoryID, item.Tags,
+		item.Price, item.Currency, item.CreatedAt, item.UpdatedAt, item.CreatedBy, item.UpdatedBy,
+		seq, change, at, by)
+	if err != nil {
+		return fmt.Errorf("failed to save item version: %w", err)
+	}
+	return nil
+}
+
+// newVersionSeq returns a random tiebreaker between versions recorded at the same time
+func newVersionSeq() (uint64, error) {
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return 0, fmt.Errorf("failed to generate item version sequence: %w", err)
+	}
+	return binary.BigEndian.Uint64(raw[:]), nil
+}
+
+// GetItemVersions returns every recorded version of the item, newest first
+func (db *DBService) GetItemVersions(ctx context.Context, id uint64) ([]models.ItemVersion, error) {
+	query := itemVersionsQuery + ` ORDER BY version_number DESC`
+	rows, err := db.conn.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch item versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.ItemVersion{}
+	for rows.Next() {
+		version, err := scanItemVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching item versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetItemVersion returns one version of the item, or ErrItemVersionNotFound
+func (db *DBService) GetItemVersion(ctx context.Context, id uint64, version uint32) (models.ItemVersion, error) {
+	query := `SELECT * FROM (` + itemVersionsQuery + `) WHERE version_number = ?`
+	v, err := scanItemVersion(db.conn.QueryRowContext(ctx, query, id, version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ItemVersion{}, ErrItemVersionNotFound
+	}
+	if err != nil {
+		return models.ItemVersion{}, fmt.Errorf("failed to fetch item version: %w", err)
+	}
+	return v, nil
+}
+
+// GetItemsAsOf returns the items as they were at the given time, optionally only
+// those of a category or of its whole subtree
+func (db *DBService) GetItemsAsOf(ctx context.Context, asOf time.Time, categoryID uint64, includeDescendants bool) ([]models.ItemResponse, error) {
+	// The latest version of each item recorded up to asOf, unless the item was deleted by then
+	query := `
+	SELECT ` + itemColumns + ` FROM (
+		SELECT ` + itemColumns + `, change
+		FROM item_versions
+		WHERE recorded_at <= ?
+		ORDER BY id, recorded_at DESC, seq DESC
+		LIMIT 1 BY id
+	)
+	WHERE change != 'deleted'`
+	params := []interface{}{asOf}
+	if categoryID != 0 {
+		where, categoryParams := categoryClause(categoryID, includeDescendants)
+		query += ` AND ` + where
+		params = append(params, categoryParams...)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, query+` ORDER BY id`, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch items: %w", err)
+	}
+	defer rows.Close()
+
+	return scanItems(rows)
+}
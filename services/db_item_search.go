@@ -0,0 +1,51 @@
+package services
+
+import (
+	"strings"
+
+	"go-clickhouse-example/models"
+)
+
+// Search terms are matched against lowerUTF8(name), which has an ngram bloom filter
+// index, and against the tokens of lowerUTF8(description), which has a token bloom
+// filter index. Terms only hold letters and digits, so they need no LIKE escaping
+// and are always valid hasToken needles.
+
+// searchClause builds the condition matching items against a parsed search query.
+// With fuzzy set, terms of 4 letters or more also match name words a few typos
+// away. Typo tolerant matching cannot use the indexes.
+func searchClause(query models.SearchQuery, fuzzy bool) (string, []interface{}) {
+	var groups []string
+	var params []interface{}
+	for _, group := range query {
+		var terms []string
+		for _, term := range group {
+			clause := "lowerUTF8(name) LIKE ? OR hasToken(lowerUTF8(description), ?)"
+			params = append(params, "%"+term+"%", term)
+			if typos := models.MaxTypos(term); fuzzy && typos > 0 {
+				clause += " OR arrayExists(w -> levenshteinDistance(w, ?) <= ?, splitByNonAlpha(lowerUTF8(name)))"
+				params = append(params, term, typos)
+			}
+			terms = append(terms, "("+clause+")")
+		}
+		groups = append(groups, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(groups, " OR ") + ")", params
+}
+
+// searchScore builds the relevance of items for a search query. Each term scores 3
+// when it is a whole word of the name, 2 when it is part of the name and 1 when it
+// is a word of the description. The ngram distance between the name and the query,
+// which also rewards names close to a misspelled query, breaks ties.
+func searchScore(query models.SearchQuery) (string, []interface{}) {
+	terms := query.Terms()
+	var scores []string
+	var params []interface{}
+	for _, term := range terms {
+		scores = append(scores, "3 * has(splitByNonAlpha(lowerUTF8(name)), ?) + 2 * (lowerUTF8(name) LIKE ?) + hasToken(lowerUTF8(description), ?)")
+		params = append(params, term, "%"+term+"%", term)
+	}
+	scores = append(scores, "1 - ngramDistanceCaseInsensitiveUTF8(name, ?)")
+	params = append(params, strings.Join(terms, " "))
+	return "(" + strings.Join(scores, " + ") + ")", params
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+var ErrItemNotInTrash = apperr.NotFound("item_not_in_trash", "item is not in the trash")
+
+const trashedItemColumns = itemColumns + `, deleted_at, deleted_by`
+
+func scanTrashedItem(row rowScanner) (models.ItemResponse, error) {
+	var item models.ItemResponse
+	err := row.Scan(&item.ID, &item.Name, &item.Description, &item.SKU, &item.CategoryID, &item.Tags,
+		&item.Price, &item.Currency, &item.CreatedAt, &item.UpdatedAt, &item.CreatedBy, &item.UpdatedBy,
+		&item.DeletedAt, &item.DeletedBy)
+	if err != nil {
+		return models.ItemResponse{}, err
+	}
+	return item, nil
+}
+
+// GetTrashedItems returns the items in the trash, most recently deleted first
+func (db *DBService) GetTrashedItems(ctx context.Context) ([]models.ItemResponse, error) {
+	query := `SELECT ` + trashedItemColumns + ` FROM items WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id`
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch trashed items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.ItemResponse{}
+	for rows.Next() {
+		item, err := scanTrashedItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching trashed items: %w", err)
+	}
+	return items, nil
+}
+
+// RestoreItem takes the item out of the trash, or returns ErrItemNotInTrash
+func (db *DBService) RestoreItem(ctx context.Context, id uint64, restoredBy uint64) (models.ItemResponse, error) {
+	query := `SELECT ` + trashedItemColumns + ` FROM items WHERE id = ? AND deleted_at IS NOT NULL`
+	item, err := scanTrashedItem(db.conn.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ItemResponse{}, ErrItemNotInTrash
+	}
+	if err != nil {
+		return models.ItemResponse{}, fmt.Errorf("failed to fetch item: %w", err)
+	}
+
+	query = `ALTER TABLE items UPDATE deleted_at = NULL, deleted_by = 0 WHERE id = ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, id); err != nil {
+		return models.ItemResponse{}, fmt.Errorf("failed to restore item: %w", err)
+	}
+
+	item.DeletedAt = nil
+	item.DeletedBy = 0
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if err := db.saveItemVersion(ctx, item, models.ItemChangeRestored, now, restoredBy); err != nil {
+		return models.ItemResponse{}, err
+	}
+	return item, nil
+}
+
+// PurgeTrashedItems permanently removes items deleted before the given time.
+// Their history is kept.
+func (db *DBService) PurgeTrashedItems(ctx context.Context, deletedBefore time.Time) error {
+	query := `ALTER TABLE items DELETE WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, deletedBefore); err != nil {
+		return fmt.Errorf("failed to purge trashed items: %w", err)
+	}
+	return nil
+}
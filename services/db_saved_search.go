@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+const savedSearchColumns = `id, user_id, name, expression, webhook_url, created_at, updated_at`
+
+func scanSavedSearch(row rowScanner) (models.SavedSearch, error) {
+	var s models.SavedSearch
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &s.Expression, &s.WebhookURL, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return models.SavedSearch{}, err
+	}
+	return s, nil
+}
+
+// SaveSavedSearch stores the current state of a saved search, the latest state wins
+func (db *DBService) SaveSavedSearch(ctx context.Context, search models.SavedSearch) error {
+	query := `INSERT INTO saved_searches (` + savedSearchColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.conn.ExecContext(ctx, query, search.ID, search.UserID, search.Name, search.Expression, search.WebhookURL,
+		search.CreatedAt, search.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save saved search: %w", err)
+	}
+	return nil
+}
+
+// DeleteSavedSearch marks a saved search as deleted
+func (db *DBService) DeleteSavedSearch(ctx context.Context, search models.SavedSearch, at time.Time) error {
+	query := `INSERT INTO saved_searches (` + savedSearchColumns + `, deleted) VALUES (?, ?, ?, ?, ?, ?, ?, true)`
+	_, err := db.conn.ExecContext(ctx, query, search.ID, search.UserID, search.Name, search.Expression, search.WebhookURL,
+		search.CreatedAt, at)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	return nil
+}
+
+// GetSavedSearch returns one of the user's saved searches, or sql.ErrNoRows
+func (db *DBService) GetSavedSearch(ctx context.Context, userID uint64, id string) (models.SavedSearch, error) {
+	query := `SELECT ` + savedSearchColumns + ` FROM saved_searches FINAL WHERE user_id = ? AND id = ? AND NOT deleted`
+	return scanSavedSearch(db.conn.QueryRowContext(ctx, query, userID, id))
+}
+
+// GetSavedSearches returns the saved searches of a user, or of every user if userID is 0,
+// oldest first
+func (db *DBService) GetSavedSearches(ctx context.Context, userID uint64) ([]models.SavedSearch, error) {
+	query := `SELECT ` + savedSearchColumns + ` FROM saved_searches FINAL WHERE (? = 0 OR user_id = ?) AND NOT deleted ORDER BY created_at, id`
+	rows, err := db.conn.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	searches := []models.SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %w", err)
+		}
+		searches = append(searches, search)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching saved searches: %w", err)
+	}
+	return searches, nil
+}
+
+// RecordSavedSearchMatch records that an item matched a saved search and reports
+// whether it is the first time. The table keeps one row per search and item, so
+// recording a match again is harmless, but the first-time check is not atomic:
+// callers serialize calls for the same search and item.
+func (db *DBService) RecordSavedSearchMatch(ctx context.Context, searchID string, itemID uint64, at time.Time) (bool, error) {
+	var count uint64
+	query := `SELECT count() FROM saved_search_matches WHERE search_id = ? AND item_id = ?`
+	if err := db.conn.QueryRowContext(ctx, query, searchID, itemID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up saved search match: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	query = `INSERT INTO saved_search_matches (search_id, item_id, matched_at) VALUES (?, ?, ?)`
+	if _, err := db.conn.ExecContext(ctx, query, searchID, itemID, at); err != nil {
+		return false, fmt.Errorf("failed to record saved search match: %w", err)
+	}
+	return true, nil
+}
@@ -1,28 +1,55 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/metrics"
 	"go-clickhouse-example/models"
 
-	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
 type DBService struct {
-	conn *sql.DB
+	// conn and native time every query, see instrumentedDB
+	conn instrumentedDB
+	// native speaks ClickHouse's native protocol, it is only used for batch inserts
+	native driver.Conn
+	// http streams results formatted by ClickHouse, such as exports
+	http *clickhouseHTTP
 }
 
 func (db *DBService) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	return db.conn.Query(query, args...)
 }
 
-func NewDBService(clickhouseURL string) *DBService {
+func NewDBService(clickhouseURL, nativeURL string) *DBService {
 	conn, err := sql.Open("clickhouse", clickhouseURL)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to connect to ClickHouse: %v", err))
 	}
-	return &DBService{conn: conn}
+
+	options, err := clickhouse.ParseDSN(nativeURL)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid ClickHouse native URL: %v", err))
+	}
+	native, err := clickhouse.Open(options)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to connect to ClickHouse: %v", err))
+	}
+	httpConn, err := newClickHouseHTTP(clickhouseURL)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid ClickHouse URL: %v", err))
+	}
+	metrics.RegisterDBStats(conn, "clickhouse")
+	return &DBService{conn: instrumentedDB{conn}, native: instrumentedNative{native}, http: httpConn}
 }
 func (db *DBService) CreateTable() {
 	// Create items table
@@ -30,7 +57,21 @@ func (db *DBService) CreateTable() {
 	CREATE TABLE IF NOT EXISTS items (
 		id UInt64,
 		name String,
-		price Float64
+		description String DEFAULT '',
+		sku String DEFAULT '',
+		category_id UInt64 DEFAULT 0,
+		tags Array(String),
+		price Decimal(18, 4),
+		currency LowCardinality(String) DEFAULT 'USD',
+		created_at DateTime64(3) DEFAULT now64(3),
+		updated_at DateTime64(3) DEFAULT now64(3),
+		created_by UInt64 DEFAULT 0,
+		updated_by UInt64 DEFAULT 0,
+		deleted_at Nullable(DateTime64(3)),
+		deleted_by UInt64 DEFAULT 0,
+		INDEX idx_sku sku TYPE bloom_filter GRANULARITY 1,
+		INDEX idx_name_ngram lowerUTF8(name) TYPE ngrambf_v1(3, 1024, 3, 0) GRANULARITY 1,
+		INDEX idx_description_tokens lowerUTF8(description) TYPE tokenbf_v1(4096, 3, 0) GRANULARITY 1
 	) ENGINE = MergeTree()
 	ORDER BY id
 	`
@@ -38,6 +79,83 @@ func (db *DBService) CreateTable() {
 		panic(fmt.Sprintf("Failed to create items table: %v", err))
 	}
 
+	// Add columns to items tables created by earlier versions
+	itemMigrations := []string{
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS description String DEFAULT ''",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS sku String DEFAULT ''",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS category_id UInt64 DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS tags Array(String)",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS created_at DateTime64(3) DEFAULT now64(3)",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS updated_at DateTime64(3) DEFAULT now64(3)",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS created_by UInt64 DEFAULT 0",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS updated_by UInt64 DEFAULT 0",
+		"ALTER TABLE items ADD INDEX IF NOT EXISTS idx_sku sku TYPE bloom_filter GRANULARITY 1",
+		// Prices used to be stored without a currency, existing prices are taken as USD
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS currency LowCardinality(String) DEFAULT 'USD'",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS deleted_at Nullable(DateTime64(3))",
+		"ALTER TABLE items ADD COLUMN IF NOT EXISTS deleted_by UInt64 DEFAULT 0",
+		// Search indexes only cover parts written after they were added, until merges rebuild them
+		"ALTER TABLE items ADD INDEX IF NOT EXISTS idx_name_ngram lowerUTF8(name) TYPE ngrambf_v1(3, 1024, 3, 0) GRANULARITY 1",
+		"ALTER TABLE items ADD INDEX IF NOT EXISTS idx_description_tokens lowerUTF8(description) TYPE tokenbf_v1(4096, 3, 0) GRANULARITY 1",
+	}
+	for _, migration := range itemMigrations {
+		if _, err := db.conn.Exec(migration); err != nil {
+			panic(fmt.Sprintf("Failed to migrate items table: %v", err))
+		}
+	}
+	// Prices used to be stored as Float64. Modifying the column rewrites every part,
+	// so it is only done when the column still has another type.
+	var priceType string
+	priceTypeQuery := `SELECT type FROM system.columns WHERE database = currentDatabase() AND table = 'items' AND name = 'price'`
+	if err := db.conn.QueryRow(priceTypeQuery).Scan(&priceType); err != nil {
+		panic(fmt.Sprintf("Failed to look up items price type: %v", err))
+	}
+	if priceType != "Decimal(18, 4)" {
+		if _, err := db.conn.Exec("ALTER TABLE items MODIFY COLUMN price Decimal(18, 4)"); err != nil {
+			panic(fmt.Sprintf("Failed to migrate items price: %v", err))
+		}
+	}
+
+	// Create item history table, every change of an item appends a full snapshot.
+	// Version numbers are assigned when reading, by ordering the snapshots of an item
+	// on recorded_at and then on seq, a random tiebreaker, so that concurrent changes
+	// cannot get the same number.
+	itemVersionsTableQuery := `
+	CREATE TABLE IF NOT EXISTS item_versions (
+		id UInt64,
+		name String,
+		description String,
+		sku String,
+		category_id UInt64,
+		tags Array(String),
+		price Decimal(18, 4),
+		currency LowCardinality(String),
+		created_at DateTime64(3),
+		updated_at DateTime64(3),
+		created_by UInt64,
+		updated_by UInt64,
+		seq UInt64,
+		change LowCardinality(String),
+		recorded_at DateTime64(3),
+		recorded_by UInt64
+	) ENGINE = MergeTree()
+	ORDER BY (id, recorded_at, seq)
+	`
+	if _, err := db.conn.Exec(itemVersionsTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create item versions table: %v", err))
+	}
+	// Every change records a version once the table exists, so only an empty table
+	// needs the items saved before versions were kept
+	var versions uint64
+	if err := db.conn.QueryRow("SELECT count() FROM item_versions").Scan(&versions); err != nil {
+		panic(fmt.Sprintf("Failed to count item versions: %v", err))
+	}
+	if versions == 0 {
+		if _, err := db.conn.Exec(backfillItemVersionsQuery); err != nil {
+			panic(fmt.Sprintf("Failed to backfill item versions: %v", err))
+		}
+	}
+
 	// Create sequence table for items
 	sequenceTableQuery := `
 	CREATE TABLE IF NOT EXISTS item_sequence (
@@ -50,7 +168,7 @@ func (db *DBService) CreateTable() {
 
 	_, err := db.conn.Exec("INSERT INTO item_sequence (last_id) VALUES (0)")
 	if err != nil {
-		fmt.Println("Sequence table already initialized")
+		logger.Debug("Sequence table already initialized")
 	}
 
 	// Create users table
@@ -58,79 +176,482 @@ func (db *DBService) CreateTable() {
 CREATE TABLE  IF NOT EXISTS users (
     user_id UInt64 PRIMARY KEY,
     username String,
+    email String DEFAULT '',
+    email_verified Bool DEFAULT false,
     password String,
-    role String
+    role String,
+    totp_secret String DEFAULT '',
+    totp_last_step Int64 DEFAULT 0,
+    mfa_enabled Bool DEFAULT false
 ) ENGINE = MergeTree()
 ORDER BY user_id;
 	`
 	if _, err := db.conn.Exec(usersTableQuery); err != nil {
 		panic(fmt.Sprintf("Failed to create users table: %v", err))
 	}
+
+	// Add columns to users tables created by earlier versions
+	userMigrations := []string{
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret String DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled Bool DEFAULT false",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS email String DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified Bool DEFAULT false",
+		"ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step Int64 DEFAULT 0",
+	}
+	for _, migration := range userMigrations {
+		if _, err := db.conn.Exec(migration); err != nil {
+			panic(fmt.Sprintf("Failed to migrate users table: %v", err))
+		}
+	}
+
+	// Create sequence table for users
+	userSequenceTableQuery := `
+	CREATE TABLE IF NOT EXISTS user_sequence (
+		last_user_id UInt64
+	) ENGINE = TinyLog
+	`
+	if _, err := db.conn.Exec(userSequenceTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create user sequence table: %v", err))
+	}
+
+	// Create recovery codes table, codes are stored as SHA-256 hashes
+	recoveryCodesTableQuery := `
+	CREATE TABLE IF NOT EXISTS user_recovery_codes (
+		user_id UInt64,
+		code_hash String,
+		created_at DateTime DEFAULT now()
+	) ENGINE = MergeTree()
+	ORDER BY (user_id, code_hash)
+	`
+	if _, err := db.conn.Exec(recoveryCodesTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create recovery codes table: %v", err))
+	}
+
+	// Create table of used single-use token IDs, rows expire with the tokens
+	consumedTokensTableQuery := `
+	CREATE TABLE IF NOT EXISTS consumed_tokens (
+		jti String,
+		expires_at DateTime
+	) ENGINE = MergeTree()
+	ORDER BY jti
+	TTL expires_at
+	`
+	if _, err := db.conn.Exec(consumedTokensTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create consumed tokens table: %v", err))
+	}
+
+	// Create table of failed MFA login attempts, used to cap guesses per challenge
+	// and per user
+	mfaFailuresTableQuery := `
+	CREATE TABLE IF NOT EXISTS mfa_failures (
+		user_id UInt64,
+		challenge_id String,
+		ts DateTime
+	) ENGINE = MergeTree()
+	ORDER BY (user_id, ts)
+	TTL ts + INTERVAL 1 DAY
+	`
+	if _, err := db.conn.Exec(mfaFailuresTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create MFA failures table: %v", err))
+	}
+
+	// Create sessions table. Updates are appended as new rows and collapsed by version,
+	// which avoids a mutation for every last-seen update.
+	sessionsTableQuery := `
+	CREATE TABLE IF NOT EXISTS user_sessions (
+		session_id String,
+		user_id UInt64,
+		device String,
+		ip String,
+		user_agent String,
+		created_at DateTime,
+		last_seen_at DateTime,
+		expires_at DateTime,
+		revoked Bool DEFAULT false,
+		version UInt64
+	) ENGINE = ReplacingMergeTree(version)
+	ORDER BY (user_id, session_id)
+	TTL expires_at + INTERVAL 1 DAY
+	`
+	if _, err := db.conn.Exec(sessionsTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create sessions table: %v", err))
+	}
+
+	// Create session revocations table. Revocations are kept apart from the session
+	// rows so that a last-seen update written concurrently cannot undo them.
+	sessionRevocationsTableQuery := `
+	CREATE TABLE IF NOT EXISTS session_revocations (
+		user_id UInt64,
+		session_id String,
+		revoked_at DateTime,
+		expires_at DateTime
+	) ENGINE = MergeTree()
+	ORDER BY (user_id, session_id)
+	TTL expires_at + INTERVAL 1 DAY
+	`
+	if _, err := db.conn.Exec(sessionRevocationsTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create session revocations table: %v", err))
+	}
+
+	// Create audit log table
+	auditLogTableQuery := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		ts DateTime64(3),
+		actor_id UInt64,
+		subject_id UInt64,
+		action String,
+		method String,
+		path String,
+		status UInt16,
+		ip String,
+		session_id String
+	) ENGINE = MergeTree()
+	ORDER BY (subject_id, ts)
+	`
+	if _, err := db.conn.Exec(auditLogTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create audit log table: %v", err))
+	}
+
+	// Create categories table, see models.Category for the path format
+	categoriesTableQuery := `
+	CREATE TABLE IF NOT EXISTS categories (
+		id UInt64,
+		parent_id UInt64,
+		name String,
+		path String,
+		created_at DateTime64(3) DEFAULT now64(3),
+		updated_at DateTime64(3) DEFAULT now64(3)
+	) ENGINE = MergeTree()
+	ORDER BY id
+	`
+	if _, err := db.conn.Exec(categoriesTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create categories table: %v", err))
+	}
+	categorySequenceTableQuery := `
+	CREATE TABLE IF NOT EXISTS category_sequence (
+		last_id UInt64
+	) ENGINE = TinyLog
+	`
+	if _, err := db.conn.Exec(categorySequenceTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create category sequence table: %v", err))
+	}
+
+	// Create the stock ledger. stock_balances is kept up to date by the materialized
+	// view and holds one row per item once merged, so balances must still be summed.
+	stockTableQueries := []string{`
+	CREATE TABLE IF NOT EXISTS stock_movements (
+		item_id UInt64,
+		delta Int64,
+		reason LowCardinality(String),
+		reference String,
+		actor_id UInt64,
+		ts DateTime64(3)
+	) ENGINE = MergeTree()
+	ORDER BY (item_id, ts)
+	`, `
+	CREATE TABLE IF NOT EXISTS stock_balances (
+		item_id UInt64,
+		quantity Int64
+	) ENGINE = SummingMergeTree()
+	ORDER BY item_id
+	`, `
+	CREATE MATERIALIZED VIEW IF NOT EXISTS stock_balances_mv TO stock_balances AS
+	SELECT item_id, delta AS quantity FROM stock_movements
+	`}
+	for _, query := range stockTableQueries {
+		if _, err := db.conn.Exec(query); err != nil {
+			panic(fmt.Sprintf("Failed to create stock tables: %v", err))
+		}
+	}
+
+	// Create import tables. Import states are appended as new rows and collapsed by
+	// updated_at, like sessions.
+	importTableQueries := []string{`
+	CREATE TABLE IF NOT EXISTS imports (
+		id String,
+		filename String,
+		format LowCardinality(String),
+		mapping String,
+		status LowCardinality(String),
+		size_bytes UInt64,
+		processed_bytes UInt64,
+		processed_rows UInt64,
+		created_items UInt64,
+		updated_items UInt64,
+		failed_rows UInt64,
+		error String,
+		created_by UInt64,
+		created_at DateTime64(3),
+		updated_at DateTime64(3),
+		finished_at Nullable(DateTime64(3)),
+		instance_id String DEFAULT ''
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY id
+	`, `
+	CREATE TABLE IF NOT EXISTS import_instances (
+		instance_id String,
+		heartbeat_at DateTime64(3)
+	) ENGINE = ReplacingMergeTree(heartbeat_at)
+	ORDER BY instance_id
+	TTL toDateTime(heartbeat_at) + INTERVAL 1 DAY
+	`, `
+	CREATE TABLE IF NOT EXISTS import_errors (
+		import_id String,
+		row UInt64,
+		column String,
+		code LowCardinality(String),
+		message String
+	) ENGINE = MergeTree()
+	ORDER BY (import_id, row)
+	`}
+	for _, query := range importTableQueries {
+		if _, err := db.conn.Exec(query); err != nil {
+			panic(fmt.Sprintf("Failed to create import tables: %v", err))
+		}
+	}
+	importMigration := "ALTER TABLE imports ADD COLUMN IF NOT EXISTS instance_id String DEFAULT ''"
+	if _, err := db.conn.Exec(importMigration); err != nil {
+		panic(fmt.Sprintf("Failed to migrate imports table: %v", err))
+	}
+
+	// Create exchange rates table, the latest rate of each currency pair wins
+	exchangeRatesTableQuery := `
+	CREATE TABLE IF NOT EXISTS exchange_rates (
+		base LowCardinality(String),
+		quote LowCardinality(String),
+		rate Decimal(18, 8),
+		updated_at DateTime64(3),
+		updated_by UInt64
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY (base, quote)
+	`
+	if _, err := db.conn.Exec(exchangeRatesTableQuery); err != nil {
+		panic(fmt.Sprintf("Failed to create exchange rates table: %v", err))
+	}
+
+	// Create saved search tables. Saved searches are appended as new rows, deletions
+	// included, and collapsed by updated_at like imports. saved_search_matches
+	// records which items were already delivered for each saved search.
+	savedSearchTableQueries := []string{`
+	CREATE TABLE IF NOT EXISTS saved_searches (
+		id String,
+		user_id UInt64,
+		name String,
+		expression String,
+		webhook_url String,
+		created_at DateTime64(3),
+		updated_at DateTime64(3),
+		deleted Bool DEFAULT false
+	) ENGINE = ReplacingMergeTree(updated_at)
+	ORDER BY (user_id, id)
+	`, `
+	CREATE TABLE IF NOT EXISTS saved_search_matches (
+		search_id String,
+		item_id UInt64,
+		matched_at DateTime64(3)
+	) ENGINE = ReplacingMergeTree(matched_at)
+	ORDER BY (search_id, item_id)
+	`}
+	for _, query := range savedSearchTableQueries {
+		if _, err := db.conn.Exec(query); err != nil {
+			panic(fmt.Sprintf("Failed to create saved search tables: %v", err))
+		}
+	}
+
+	// Create the per minute, hour and day rollups of item changes
+	db.createItemChangeRollups()
 }
 
-func (db *DBService) SaveItem(item *models.ItemResponse) error {
-	var nextID uint64
-	err := db.conn.QueryRow("SELECT COALESCE(MAX(last_id), 0) + 1 AS next_id FROM item_sequence").Scan(&nextID)
+// mutationContext makes ALTER TABLE UPDATE/DELETE mutations wait until they are applied,
+// so that a read issued right after the write observes it
+func mutationContext(ctx context.Context) context.Context {
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"mutations_sync": 1,
+	}))
+}
+
+var (
+	// ErrDuplicateSKU is returned when an item's SKU is already used by another item
+	ErrDuplicateSKU = apperr.Conflict("duplicate_sku", "SKU is already used by another item")
+	ErrItemNotFound = apperr.NotFound("item_not_found", "item not found")
+	// ErrItemCategoryNotFound is returned when an item's category does not exist
+	ErrItemCategoryNotFound = apperr.Validation(models.FieldError{
+		Field: "category_id", Code: "not_found", Message: "category not found",
+	})
+)
+
+const itemColumns = `id, name, description, sku, category_id, tags, price, currency, created_at, updated_at, created_by, updated_by`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanItem(row rowScanner) (models.ItemResponse, error) {
+	var item models.ItemResponse
+	err := row.Scan(&item.ID, &item.Name, &item.Description, &item.SKU, &item.CategoryID, &item.Tags,
+		&item.Price, &item.Currency, &item.CreatedAt, &item.UpdatedAt, &item.CreatedBy, &item.UpdatedBy)
 	if err != nil {
-		return fmt.Errorf("failed to fetch next ID: %w", err)
+		return models.ItemResponse{}, err
+	}
+	return item, nil
+}
+
+// checkSKU returns ErrDuplicateSKU if another item than excludeID uses the SKU.
+// Items in the trash keep their SKU so that they can be restored.
+func (db *DBService) checkSKU(ctx context.Context, sku string, excludeID uint64) error {
+	if sku == "" {
+		return nil
 	}
 
-	_, err = db.conn.Exec("INSERT INTO item_sequence (last_id) VALUES (?)", nextID)
+	var count uint64
+	err := db.conn.QueryRowContext(ctx, `SELECT count() FROM items WHERE sku = ? AND id != ?`, sku, excludeID).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("failed to update sequence table: %w", err)
+		return fmt.Errorf("failed to check SKU: %w", err)
+	}
+	if count > 0 {
+		return ErrDuplicateSKU
+	}
+	return nil
+}
+
+// checkCategory returns ErrItemCategoryNotFound unless the category exists. Items
+// without a category have categoryID 0.
+func (db *DBService) checkCategory(ctx context.Context, categoryID uint64) error {
+	if categoryID == 0 {
+		return nil
 	}
 
-	query := `INSERT INTO items (id, name, price) VALUES (?, ?, ?)`
-	_, err = db.conn.Exec(query, nextID, item.Name, item.Price)
+	existing, err := db.GetExistingCategoryIDs(ctx, []uint64{categoryID})
 	if err != nil {
-		return fmt.Errorf("failed to insert item into database: %w", err)
+		return err
+	}
+	if !existing[categoryID] {
+		return ErrItemCategoryNotFound
+	}
+	return nil
+}
+
+// SaveItem inserts a new item, assigning its ID and creation timestamps
+func (db *DBService) SaveItem(ctx context.Context, item *models.ItemResponse) error {
+	if err := db.checkSKU(ctx, item.SKU, 0); err != nil {
+		return err
+	}
+	if err := db.checkCategory(ctx, item.CategoryID); err != nil {
+		return err
 	}
 
+	nextID, err := db.reserveItemIDs(ctx, 1)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
 	item.ID = nextID
-	return nil
+	item.CreatedAt = now
+	item.UpdatedAt = now
+	item.UpdatedBy = item.CreatedBy
+	if item.Tags == nil {
+		item.Tags = []string{}
+	}
+
+	query := `INSERT INTO items (` + itemColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.conn.ExecContext(ctx, query, item.ID, item.Name, item.Description, item.SKU, item.CategoryID, item.Tags,
+		item.Price, item.Currency, item.CreatedAt, item.UpdatedAt, item.CreatedBy, item.UpdatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to insert item into database: %w", err)
+	}
+
+	return db.saveItemVersion(ctx, *item, models.ItemChangeCreated, item.UpdatedAt, item.UpdatedBy)
 }
 
-func (db *DBService) GetItemByID(id uint64) (models.ItemResponse, error) {
-	query := `SELECT id, name, price FROM items WHERE id = ?`
-	row := db.conn.QueryRow(query, id)
+// reserveItemIDs reserves n consecutive item IDs and returns the first one
+func (db *DBService) reserveItemIDs(ctx context.Context, n int) (uint64, error) {
+	var nextID uint64
+	err := db.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(last_id), 0) + 1 AS next_id FROM item_sequence").Scan(&nextID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch next ID: %w", err)
+	}
 
-	var item models.ItemResponse
-	err := row.Scan(&item.ID, &item.Name, &item.Price)
+	_, err = db.conn.ExecContext(ctx, "INSERT INTO item_sequence (last_id) VALUES (?)", nextID+uint64(n)-1)
 	if err != nil {
-		return models.ItemResponse{}, err
+		return 0, fmt.Errorf("failed to update sequence table: %w", err)
 	}
+	return nextID, nil
+}
 
+// GetItemByID returns the item, or ErrItemNotFound if it does not exist or is in the trash
+func (db *DBService) GetItemByID(ctx context.Context, id uint64) (models.ItemResponse, error) {
+	query := `SELECT ` + itemColumns + ` FROM items WHERE id = ? AND deleted_at IS NULL`
+	item, err := scanItem(db.conn.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ItemResponse{}, ErrItemNotFound
+	}
+	if err != nil {
+		return models.ItemResponse{}, fmt.Errorf("failed to fetch item: %w", err)
+	}
 	return item, nil
 }
-func (db *DBService) UpdateItem(id uint64, item models.ItemResponse) error {
-	query := `ALTER TABLE items UPDATE name = ?, price = ? WHERE id = ?`
-	_, err := db.conn.Exec(query, item.Name, item.Price, id)
-	return err
+
+// UpdateItem overwrites the item's editable fields and sets its update timestamp.
+// The creation fields of item are ignored.
+func (db *DBService) UpdateItem(ctx context.Context, id uint64, item *models.ItemResponse) error {
+	if err := db.checkSKU(ctx, item.SKU, id); err != nil {
+		return err
+	}
+	if err := db.checkCategory(ctx, item.CategoryID); err != nil {
+		return err
+	}
+
+	item.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	if item.Tags == nil {
+		item.Tags = []string{}
+	}
+
+	query := `ALTER TABLE items UPDATE name = ?, description = ?, sku = ?, category_id = ?, tags = ?,
+		price = toDecimal64(?, 4), currency = ?, updated_at = ?, updated_by = ? WHERE id = ?`
+	_, err := db.conn.ExecContext(mutationContext(ctx), query, item.Name, item.Description, item.SKU, item.CategoryID,
+		item.Tags, item.Price, item.Currency, item.UpdatedAt, item.UpdatedBy, id)
+	if err != nil {
+		return err
+	}
+
+	item.ID = id
+	return db.saveItemVersion(ctx, *item, models.ItemChangeUpdated, item.UpdatedAt, item.UpdatedBy)
 }
 
-func (db *DBService) DeleteItem(id uint64) error {
-	query := `DELETE FROM items WHERE id = ?`
-	_, err := db.conn.Exec(query, id)
-	return err
+// DeleteItem moves the item to the trash, recording its last state in the item's history.
+// The item's DeletedAt and DeletedBy are set.
+func (db *DBService) DeleteItem(ctx context.Context, item *models.ItemResponse, deletedBy uint64) error {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	query := `ALTER TABLE items UPDATE deleted_at = ?, deleted_by = ? WHERE id = ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, now, deletedBy, item.ID); err != nil {
+		return err
+	}
+	if err := db.saveItemVersion(ctx, *item, models.ItemChangeDeleted, now, deletedBy); err != nil {
+		return err
+	}
+	item.DeletedAt, item.DeletedBy = &now, deletedBy
+	return nil
 }
 
-func (db *DBService) SaveUser(user *models.User) error {
+func (db *DBService) SaveUser(ctx context.Context, user *models.User) error {
 	// Fetch the next available user_id from the user_sequence table
 	var nextUserID uint64
-	err := db.conn.QueryRow("SELECT COALESCE(MAX(last_user_id), 0) + 1 AS next_user_id FROM user_sequence").Scan(&nextUserID)
+	err := db.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(last_user_id), 0) + 1 AS next_user_id FROM user_sequence").Scan(&nextUserID)
 	if err != nil {
 		return fmt.Errorf("failed to fetch next user_id: %w", err)
 	}
 
 	// Update the user_sequence table with the new user_id
-	_, err = db.conn.Exec("INSERT INTO user_sequence (last_user_id) VALUES (?)", nextUserID)
+	_, err = db.conn.ExecContext(ctx, "INSERT INTO user_sequence (last_user_id) VALUES (?)", nextUserID)
 	if err != nil {
 		return fmt.Errorf("failed to update user_sequence table: %w", err)
 	}
 
 	// Insert the new user with the generated user_id
-	query := `INSERT INTO users (user_id, username, password, role) VALUES (?, ?, ?, ?)`
-	_, err = db.conn.Exec(query, nextUserID, user.Username, user.Password, user.Role)
+	query := `INSERT INTO users (user_id, username, email, password, role) VALUES (?, ?, ?, ?, ?)`
+	_, err = db.conn.ExecContext(ctx, query, nextUserID, user.Username, user.Email, user.Password, user.Role)
 	if err != nil {
 		return fmt.Errorf("failed to insert user: %w", err)
 	}
@@ -140,33 +661,164 @@ func (db *DBService) SaveUser(user *models.User) error {
 	return nil
 }
 
+const userColumns = `user_id, username, email, email_verified, password, role, totp_secret, totp_last_step, mfa_enabled`
+
 // GetUserByUsername retrieves a user by their username
-func (db *DBService) GetUserByUsername(username string) (models.UserResponse, error) {
-	query := `SELECT user_id, username, password, role FROM users WHERE username = ?`
-	row := db.conn.QueryRow(query, username)
+func (db *DBService) GetUserByUsername(ctx context.Context, username string) (models.UserResponse, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	return scanUser(db.conn.QueryRowContext(ctx, query, username))
+}
+
+// GetUserByID retrieves a user by their ID
+func (db *DBService) GetUserByID(ctx context.Context, id uint64) (models.UserResponse, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE user_id = ?`
+	return scanUser(db.conn.QueryRowContext(ctx, query, id))
+}
 
+// GetUserByEmail retrieves a user by their email address (case-insensitive)
+func (db *DBService) GetUserByEmail(ctx context.Context, email string) (models.UserResponse, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower(?) LIMIT 1`
+	return scanUser(db.conn.QueryRowContext(ctx, query, email))
+}
+
+func scanUser(row *sql.Row) (models.UserResponse, error) {
 	var user models.UserResponse
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Role)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.Password, &user.Role, &user.TOTPSecret, &user.TOTPLastStep, &user.MFAEnabled)
 	if err != nil {
 		return models.UserResponse{}, err
 	}
 	return user, nil
 }
 
-func (db *DBService) GetAllItems() ([]models.ItemResponse, error) {
+// SetUserTOTP stores the user's TOTP secret and whether MFA is active
+func (db *DBService) SetUserTOTP(ctx context.Context, userID uint64, secret string, enabled bool) error {
+	query := `ALTER TABLE users UPDATE totp_secret = ?, mfa_enabled = ? WHERE user_id = ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, secret, enabled, userID); err != nil {
+		return fmt.Errorf("failed to update user TOTP settings: %w", err)
+	}
+	return nil
+}
+
+// SetTOTPLastStep records the time step of the last TOTP code the user was
+// accepted with. The step only moves forward.
+func (db *DBService) SetTOTPLastStep(ctx context.Context, userID uint64, step int64) error {
+	query := `ALTER TABLE users UPDATE totp_last_step = ? WHERE user_id = ? AND totp_last_step < ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, step, userID, step); err != nil {
+		return fmt.Errorf("failed to update user TOTP step: %w", err)
+	}
+	return nil
+}
+
+// RecordMFAFailure records an invalid code submitted with an MFA challenge
+func (db *DBService) RecordMFAFailure(ctx context.Context, userID uint64, challengeID string, at time.Time) error {
+	query := `INSERT INTO mfa_failures (user_id, challenge_id, ts) VALUES (?, ?, ?)`
+	if _, err := db.conn.ExecContext(ctx, query, userID, challengeID, at); err != nil {
+		return fmt.Errorf("failed to record MFA failure: %w", err)
+	}
+	return nil
+}
+
+// CountMFAFailures returns the number of invalid codes submitted with the challenge
+// and the number submitted for the user since the given time
+func (db *DBService) CountMFAFailures(ctx context.Context, userID uint64, challengeID string, since time.Time) (uint64, uint64, error) {
+	var challengeFailures, userFailures uint64
+	query := `SELECT countIf(challenge_id = ?), countIf(ts >= ?) FROM mfa_failures WHERE user_id = ?`
+	err := db.conn.QueryRowContext(ctx, query, challengeID, since, userID).Scan(&challengeFailures, &userFailures)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count MFA failures: %w", err)
+	}
+	return challengeFailures, userFailures, nil
+}
+
+// SetUserPassword stores a new password hash for the user
+func (db *DBService) SetUserPassword(ctx context.Context, userID uint64, hashedPassword string) error {
+	query := `ALTER TABLE users UPDATE password = ? WHERE user_id = ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, hashedPassword, userID); err != nil {
+		return fmt.Errorf("failed to update user password: %w", err)
+	}
+	return nil
+}
+
+// SetEmailVerified marks the user's email as verified if it still matches the given address
+func (db *DBService) SetEmailVerified(ctx context.Context, userID uint64, email string) error {
+	query := `ALTER TABLE users UPDATE email_verified = true WHERE user_id = ? AND email = ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, userID, email); err != nil {
+		return fmt.Errorf("failed to mark email as verified: %w", err)
+	}
+	return nil
+}
+
+// ConsumeToken records a single-use token ID and reports false if it was already used.
+// The check and the insert are separate queries: callers serialize the uses of a token.
+func (db *DBService) ConsumeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	var count uint64
+	if err := db.conn.QueryRowContext(ctx, `SELECT count() FROM consumed_tokens WHERE jti = ?`, jti).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up token: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	_, err := db.conn.ExecContext(ctx, `INSERT INTO consumed_tokens (jti, expires_at) VALUES (?, ?)`, jti, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record token use: %w", err)
+	}
+	return true, nil
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores the given hashes
+func (db *DBService) ReplaceRecoveryCodes(ctx context.Context, userID uint64, codeHashes []string) error {
+	_, err := db.conn.ExecContext(mutationContext(ctx), "DELETE FROM user_recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err := db.conn.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash)
+		if err != nil {
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode deletes a matching recovery code and reports whether one existed.
+// The check and the delete are separate queries: callers serialize the uses of a code.
+func (db *DBService) ConsumeRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error) {
+	var count uint64
+	query := `SELECT count() FROM user_recovery_codes WHERE user_id = ? AND code_hash = ?`
+	if err := db.conn.QueryRowContext(ctx, query, userID, codeHash).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up recovery code: %w", err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	query = `DELETE FROM user_recovery_codes WHERE user_id = ? AND code_hash = ?`
+	if _, err := db.conn.ExecContext(mutationContext(ctx), query, userID, codeHash); err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	return true, nil
+}
+
+func (db *DBService) GetAllItems(ctx context.Context) ([]models.ItemResponse, error) {
 	// Query to get all items
-	query := `SELECT id, name, price FROM items`
-	rows, err := db.conn.Query(query)
+	query := `SELECT ` + itemColumns + ` FROM items WHERE deleted_at IS NULL`
+	rows, err := db.conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch items: %w", err)
 	}
 	defer rows.Close()
 
+	return scanItems(rows)
+}
+
+// scanItems reads all remaining item rows, closing them is up to the caller
+func scanItems(rows *sql.Rows) ([]models.ItemResponse, error) {
 	var items []models.ItemResponse
 	// Iterate through the rows and append each item to the items slice
 	for rows.Next() {
-		var item models.ItemResponse
-		err := rows.Scan(&item.ID, &item.Name, &item.Price)
+		item, err := scanItem(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan item: %w", err)
 		}
@@ -180,3 +832,138 @@ func (db *DBService) GetAllItems() ([]models.ItemResponse, error) {
 
 	return items, nil
 }
+
+// itemSortColumns lists the columns items can be sorted by
+var itemSortColumns = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"sku":         true,
+	"category_id": true,
+	"price":       true,
+	"created_at":  true,
+	"updated_at":  true,
+}
+
+// itemCondition is one condition of an item filter
+type itemCondition struct {
+	// facet is the search facet the condition filters on, if any
+	facet  string
+	sql    string
+	params []interface{}
+}
+
+// itemFilterConditions returns the conditions of an item filter
+func itemFilterConditions(filter models.ItemFilter) []itemCondition {
+	conditions := []itemCondition{{sql: "deleted_at IS NULL"}}
+
+	// Add full-text search conditions if a search query is provided
+	if query := models.ParseSearchQuery(filter.Search); len(query) > 0 {
+		search, searchParams := searchClause(query, filter.Fuzzy)
+		conditions = append(conditions, itemCondition{sql: search, params: searchParams})
+	}
+
+	// Add price filtering, amounts are bound as strings to keep them exact
+	conditions = append(conditions, itemCondition{
+		facet:  models.FacetPriceRange,
+		sql:    "price BETWEEN toDecimal64(?, 4) AND toDecimal64(?, 4)",
+		params: []interface{}{filter.MinPrice, filter.MaxPrice},
+	})
+
+	if filter.CategoryID != 0 {
+		category, categoryParams := categoryClause(filter.CategoryID, filter.IncludeDescendants)
+		conditions = append(conditions, itemCondition{facet: models.FacetCategory, sql: category, params: categoryParams})
+	}
+	if filter.SKU != "" {
+		conditions = append(conditions, itemCondition{sql: "sku = ?", params: []interface{}{filter.SKU}})
+	}
+	// Items must carry every requested tag
+	if len(filter.Tags) > 0 {
+		conditions = append(conditions, itemCondition{facet: models.FacetTags, sql: "hasAll(tags, ?)", params: []interface{}{filter.Tags}})
+	}
+	return conditions
+}
+
+// joinItemConditions ANDs the conditions, leaving out those filtering on one of the
+// skipped facets. It returns "1" if no condition is left.
+func joinItemConditions(conditions []itemCondition, skip ...string) (string, []interface{}) {
+	var clauses []string
+	params := []interface{}{}
+	for _, condition := range conditions {
+		if condition.facet != "" && slices.Contains(skip, condition.facet) {
+			continue
+		}
+		clauses = append(clauses, condition.sql)
+		params = append(params, condition.params...)
+	}
+	if len(clauses) == 0 {
+		return "1", params
+	}
+	return strings.Join(clauses, " AND "), params
+}
+
+// itemFilterClause builds the WHERE clause and parameters for an item filter
+func itemFilterClause(filter models.ItemFilter) (string, []interface{}) {
+	clause, params := joinItemConditions(itemFilterConditions(filter))
+	return "WHERE " + clause, params
+}
+
+// itemOrderBy returns the ORDER BY expression for an item filter and its parameters.
+// Sort options are checked against a list, since they cannot be bound as parameters.
+// Sorting by relevance requires a search query.
+func itemOrderBy(filter models.ItemFilter) (string, []interface{}) {
+	if query := models.ParseSearchQuery(filter.Search); filter.SortBy == "relevance" && len(query) > 0 {
+		score, params := searchScore(query)
+		return score + " DESC, id", params
+	}
+
+	sortBy := filter.SortBy
+	if !itemSortColumns[sortBy] {
+		sortBy = "price"
+	}
+	sortOrder := filter.SortOrder
+	if sortOrder != "ASC" && sortOrder != "DESC" {
+		sortOrder = "ASC"
+	}
+	return sortBy + " " + sortOrder + ", id", nil
+}
+
+// SearchItems returns one page of items matching the filter and the total number of matches
+func (db *DBService) SearchItems(ctx context.Context, filter models.ItemFilter) ([]models.ItemResponse, uint64, error) {
+	where, params := itemFilterClause(filter)
+
+	var total uint64
+	if err := db.conn.QueryRowContext(ctx, "SELECT count() FROM items "+where, params...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count items: %w", err)
+	}
+
+	// Items found by a search query are returned with their relevance
+	score, scoreParams := "0", []interface{}{}
+	if query := models.ParseSearchQuery(filter.Search); len(query) > 0 {
+		score, scoreParams = searchScore(query)
+	}
+	orderBy, orderParams := itemOrderBy(filter)
+	query := fmt.Sprintf("SELECT %s, %s FROM items %s ORDER BY %s LIMIT ? OFFSET ?", itemColumns, score, where, orderBy)
+	params = append(append(scoreParams, params...), orderParams...)
+	params = append(params, filter.Limit, (filter.Page-1)*filter.Limit)
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.ItemResponse
+	for rows.Next() {
+		var item models.ItemResponse
+		err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.SKU, &item.CategoryID, &item.Tags,
+			&item.Price, &item.Currency, &item.CreatedAt, &item.UpdatedAt, &item.CreatedBy, &item.UpdatedBy, &item.Score)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan item: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error occurred while searching items: %w", err)
+	}
+	return items, total, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+const sessionColumns = `session_id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at, revoked`
+
+// sessionSelect reads sessionColumns, counting a session as revoked if it has a
+// revocation. It takes the user ID as its first parameter.
+const sessionSelect = `SELECT session_id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at,
+	revoked OR session_id IN (SELECT session_id FROM session_revocations WHERE user_id = ?) AS is_revoked
+	FROM user_sessions FINAL`
+
+// SaveSession inserts a new version of the session row
+func (db *DBService) SaveSession(ctx context.Context, session models.Session) error {
+	query := `INSERT INTO user_sessions (` + sessionColumns + `, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.conn.ExecContext(ctx, query, session.ID, session.UserID, session.Device, session.IP, session.UserAgent,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt, session.Revoked, uint64(time.Now().UnixNano()))
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves the latest version of a session
+func (db *DBService) GetSession(ctx context.Context, userID uint64, sessionID string) (models.Session, error) {
+	query := sessionSelect + ` WHERE user_id = ? AND session_id = ?`
+	row := db.conn.QueryRowContext(ctx, query, userID, userID, sessionID)
+
+	var session models.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.Device, &session.IP, &session.UserAgent,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.Revoked)
+	if err != nil {
+		return models.Session{}, err
+	}
+	return session, nil
+}
+
+// GetActiveSessions lists the user's sessions that are neither revoked nor expired
+func (db *DBService) GetActiveSessions(ctx context.Context, userID uint64) ([]models.Session, error) {
+	query := sessionSelect + ` WHERE user_id = ? AND expires_at > now() AND NOT is_revoked
+	ORDER BY last_seen_at DESC`
+	rows, err := db.conn.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.Device, &session.IP, &session.UserAgent,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.Revoked)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession records the revocation of a session
+func (db *DBService) RevokeSession(ctx context.Context, session models.Session) error {
+	query := `INSERT INTO session_revocations (user_id, session_id, revoked_at, expires_at) VALUES (?, ?, ?, ?)`
+	_, err := db.conn.ExecContext(ctx, query, session.UserID, session.ID, time.Now().UTC(), session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions records the revocation of every unexpired session of the user
+func (db *DBService) RevokeAllSessions(ctx context.Context, userID uint64) error {
+	query := `INSERT INTO session_revocations (user_id, session_id, revoked_at, expires_at)
+	SELECT user_id, session_id, now(), expires_at
+	FROM user_sessions FINAL
+	WHERE user_id = ? AND expires_at > now()`
+	if _, err := db.conn.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go-clickhouse-example/models"
+)
+
+// SaveStockMovement appends a movement to the stock ledger
+func (db *DBService) SaveStockMovement(ctx context.Context, movement models.StockMovement) error {
+	query := `INSERT INTO stock_movements (item_id, delta, reason, reference, actor_id, ts) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := db.conn.ExecContext(ctx, query, movement.ItemID, movement.Delta, movement.Reason, movement.Reference,
+		movement.ActorID, movement.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to save stock movement: %w", err)
+	}
+	return nil
+}
+
+// GetStockBalance returns the current stock of an item
+func (db *DBService) GetStockBalance(ctx context.Context, itemID uint64) (int64, error) {
+	var quantity int64
+	err := db.conn.QueryRowContext(ctx, `SELECT sum(quantity) FROM stock_balances WHERE item_id = ?`, itemID).Scan(&quantity)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch stock balance: %w", err)
+	}
+	return quantity, nil
+}
+
+// GetStockMovements returns the most recent movements of an item, newest first,
+// each with the running balance after it
+func (db *DBService) GetStockMovements(ctx context.Context, itemID uint64, limit int) ([]models.StockMovement, error) {
+	query := `
+	SELECT item_id, delta, reason, reference, actor_id, ts,
+		sum(delta) OVER (ORDER BY ts, delta ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS balance
+	FROM stock_movements
+	WHERE item_id = ?
+	ORDER BY ts DESC, delta DESC
+	LIMIT ?
+	`
+	rows, err := db.conn.QueryContext(ctx, query, itemID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stock movements: %w", err)
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		var movement models.StockMovement
+		err := rows.Scan(&movement.ItemID, &movement.Delta, &movement.Reason, &movement.Reference,
+			&movement.ActorID, &movement.Timestamp, &movement.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stock movement: %w", err)
+		}
+		movements = append(movements, movement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching stock movements: %w", err)
+	}
+	return movements, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go-clickhouse-example/models"
+)
+
+// GetItemNames calls fn with the ID and name of every item not in the trash
+func (db *DBService) GetItemNames(ctx context.Context, fn func(id uint64, name string)) error {
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, name FROM items WHERE deleted_at IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to fetch item names: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return fmt.Errorf("failed to scan item name: %w", err)
+		}
+		fn(id, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error occurred while fetching item names: %w", err)
+	}
+	return nil
+}
+
+// GetItemUnitsSold returns the number of units sold of each item, sales net of
+// returns, for items that were ever sold
+func (db *DBService) GetItemUnitsSold(ctx context.Context) (map[uint64]int64, error) {
+	query := `
+	SELECT item_id, -sum(delta)
+	FROM stock_movements
+	WHERE has(?, reason)
+	GROUP BY item_id
+	`
+	rows, err := db.conn.QueryContext(ctx, query, []string{models.StockReasonSale, models.StockReasonReturn})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch units sold: %w", err)
+	}
+	defer rows.Close()
+
+	sold := make(map[uint64]int64)
+	for rows.Next() {
+		var itemID uint64
+		var units int64
+		if err := rows.Scan(&itemID, &units); err != nil {
+			return nil, fmt.Errorf("failed to scan units sold: %w", err)
+		}
+		sold[itemID] = units
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching units sold: %w", err)
+	}
+	return sold, nil
+}
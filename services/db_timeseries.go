@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+// itemChangeRollup is an AggregatingMergeTree table summarizing item_versions per
+// interval, change and currency. It is fed by a materialized view on item_versions,
+// so every item write is counted when its version is recorded.
+type itemChangeRollup struct {
+	table    string
+	truncate string
+	step     time.Duration
+}
+
+// itemChangeRollups maps timeseries intervals to their rollup tables
+var itemChangeRollups = map[string]itemChangeRollup{
+	models.IntervalMinute: {table: "item_changes_1m", truncate: "toStartOfMinute", step: time.Minute},
+	models.IntervalHour:   {table: "item_changes_1h", truncate: "toStartOfHour", step: time.Hour},
+	models.IntervalDay:    {table: "item_changes_1d", truncate: "toStartOfDay", step: 24 * time.Hour},
+}
+
+// TimeseriesStep returns the length of a timeseries interval, and false for unknown intervals
+func TimeseriesStep(interval string) (time.Duration, bool) {
+	rollup, ok := itemChangeRollups[interval]
+	return rollup.step, ok
+}
+
+// selectQuery returns the query aggregating item_versions into the rollup's rows
+func (r itemChangeRollup) selectQuery() string {
+	return fmt.Sprintf(`
+	SELECT %s(recorded_at, 'UTC') AS bucket, change, currency, count() AS events, avgState(price) AS avg_price
+	FROM item_versions
+	GROUP BY bucket, change, currency`, r.truncate)
+}
+
+// createItemChangeRollups creates the rollup tables and their materialized views.
+// A rollup created after item versions were recorded is filled from item_versions
+// first, changes made by other instances while it is being filled may be missed.
+func (db *DBService) createItemChangeRollups() {
+	for _, interval := range []string{models.IntervalMinute, models.IntervalHour, models.IntervalDay} {
+		rollup := itemChangeRollups[interval]
+
+		tableQuery := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			bucket DateTime('UTC'),
+			change LowCardinality(String),
+			currency LowCardinality(String),
+			events SimpleAggregateFunction(sum, UInt64),
+			avg_price AggregateFunction(avg, Decimal(18, 4))
+		) ENGINE = AggregatingMergeTree()
+		ORDER BY (bucket, change, currency)
+		`, rollup.table)
+		if _, err := db.conn.Exec(tableQuery); err != nil {
+			panic(fmt.Sprintf("Failed to create %s table: %v", rollup.table, err))
+		}
+
+		// The view is created last, so an existing view means the rollup is complete
+		var views, rows uint64
+		viewQuery := `SELECT count() FROM system.tables WHERE database = currentDatabase() AND name = ?`
+		if err := db.conn.QueryRow(viewQuery, rollup.table+"_mv").Scan(&views); err != nil {
+			panic(fmt.Sprintf("Failed to look up %s view: %v", rollup.table, err))
+		}
+		if views > 0 {
+			continue
+		}
+		if err := db.conn.QueryRow("SELECT count() FROM " + rollup.table).Scan(&rows); err != nil {
+			panic(fmt.Sprintf("Failed to count %s rows: %v", rollup.table, err))
+		}
+		if rows == 0 {
+			backfillQuery := fmt.Sprintf("INSERT INTO %s %s", rollup.table, rollup.selectQuery())
+			if _, err := db.conn.Exec(backfillQuery); err != nil {
+				panic(fmt.Sprintf("Failed to backfill %s: %v", rollup.table, err))
+			}
+		}
+		createViewQuery := fmt.Sprintf("CREATE MATERIALIZED VIEW IF NOT EXISTS %s_mv TO %s AS %s",
+			rollup.table, rollup.table, rollup.selectQuery())
+		if _, err := db.conn.Exec(createViewQuery); err != nil {
+			panic(fmt.Sprintf("Failed to create %s view: %v", rollup.table, err))
+		}
+	}
+}
+
+// timeseriesChanges maps count metrics to the item version changes they count
+var timeseriesChanges = map[string][]string{
+	models.MetricItemsCreated:  {models.ItemChangeCreated},
+	models.MetricItemsUpdated:  {models.ItemChangeUpdated},
+	models.MetricItemsDeleted:  {models.ItemChangeDeleted},
+	models.MetricItemsRestored: {models.ItemChangeRestored},
+	models.MetricItemChanges: {models.ItemChangeCreated, models.ItemChangeUpdated,
+		models.ItemChangeDeleted, models.ItemChangeRestored},
+	models.MetricAvgPrice: {models.ItemChangeCreated, models.ItemChangeUpdated},
+}
+
+// GetTimeseries returns one point of the metric per interval in [from, to), which
+// must be aligned on the interval. Intervals without changes are filled in with
+// WITH FILL, as zero for counts and null for averages. currency restricts counts to
+// items of that currency, and is required for avg_price.
+func (db *DBService) GetTimeseries(ctx context.Context, metric, interval, currency string, from, to time.Time) ([]models.TimeseriesPoint, error) {
+	rollup, ok := itemChangeRollups[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown timeseries interval %q", interval)
+	}
+	changes, ok := timeseriesChanges[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown timeseries metric %q", metric)
+	}
+
+	value := "toFloat64(sum(events))"
+	if metric == models.MetricAvgPrice {
+		value = "toNullable(toFloat64(avgMerge(avg_price)))"
+	}
+	where := "WHERE bucket >= toDateTime(?, 'UTC') AND bucket < toDateTime(?, 'UTC') AND has(?, change)"
+	params := []interface{}{from.Unix(), to.Unix(), changes}
+	if currency != "" {
+		where += " AND currency = ?"
+		params = append(params, currency)
+	}
+
+	query := fmt.Sprintf(`
+	SELECT bucket, %s AS value
+	FROM %s
+	%s
+	GROUP BY bucket
+	ORDER BY bucket WITH FILL FROM toDateTime(?, 'UTC') TO toDateTime(?, 'UTC') STEP %d
+	`, value, rollup.table, where, int64(rollup.step/time.Second))
+	params = append(params, from.Unix(), to.Unix())
+
+	rows, err := db.conn.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch timeseries: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.TimeseriesPoint{}
+	for rows.Next() {
+		var point models.TimeseriesPoint
+		var value sql.NullFloat64
+		if err := rows.Scan(&point.Timestamp, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan timeseries point: %w", err)
+		}
+		point.Timestamp = point.Timestamp.UTC()
+		if value.Valid {
+			point.Value = &value.Float64
+		}
+		points = append(points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error occurred while fetching timeseries: %w", err)
+	}
+	return points, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/utils"
+)
+
+// ActionImpersonationStart is the audit action recorded when an impersonation begins
+const ActionImpersonationStart = "impersonation.start"
+
+var (
+	ErrUserNotFound      = apperr.NotFound("user_not_found", "user not found")
+	ErrCannotImpersonate = apperr.Forbidden("cannot_impersonate", "this user cannot be impersonated")
+	ErrImpersonateSelf   = apperr.Forbidden("impersonate_self", "cannot impersonate yourself")
+)
+
+// ImpersonationService lets admins act as another user to reproduce what they see
+type ImpersonationService struct {
+	DBService      *DBService
+	SessionService *SessionService
+	AuditService   *AuditService
+	TTL            time.Duration
+}
+
+// NewImpersonationService creates a new ImpersonationService instance
+func NewImpersonationService(dbService *DBService, sessionService *SessionService, auditService *AuditService, ttl time.Duration) *ImpersonationService {
+	return &ImpersonationService{
+		DBService:      dbService,
+		SessionService: sessionService,
+		AuditService:   auditService,
+		TTL:            ttl,
+	}
+}
+
+// Start issues a short-lived token for targetID acting as actorID. The admin's
+// authentication methods carry over so MFA requirements still apply.
+func (s *ImpersonationService) Start(ctx context.Context, actorID, targetID uint64, amr []string, ip, userAgent string) (*models.ImpersonationResponse, error) {
+	if actorID == targetID {
+		return nil, ErrImpersonateSelf
+	}
+
+	target, err := s.DBService.GetUserByID(ctx, targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	// Admins cannot be impersonated, which would let one admin act with another's identity
+	if target.Role == "admin" {
+		return nil, ErrCannotImpersonate
+	}
+
+	session, err := s.SessionService.CreateImpersonation(ctx, targetID, actorID, ip, userAgent, s.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateImpersonationJWT(&target, actorID, session.ID, amr, s.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.AuditService.Record(ctx, models.AuditEntry{
+		Timestamp: time.Now(),
+		ActorID:   actorID,
+		SubjectID: targetID,
+		Action:    ActionImpersonationStart,
+		IP:        ip,
+		SessionID: session.ID,
+	})
+
+	return &models.ImpersonationResponse{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		User:      &target,
+	}, nil
+}
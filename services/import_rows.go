@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go-clickhouse-example/models"
+)
+
+// maxNDJSONLine bounds the length of one NDJSON row
+const maxNDJSONLine = 1 << 20
+
+// importRow holds the values of one source row by column name. CSV values are
+// strings, NDJSON values are whatever the JSON holds.
+type importRow map[string]interface{}
+
+// rowError is returned by a rowSource for a malformed row, which is skipped
+type rowError struct {
+	message string
+}
+
+func (e *rowError) Error() string {
+	return e.message
+}
+
+// rowSource reads the rows of an uploaded file. Next returns io.EOF after the last
+// row and a *rowError for a malformed row; other errors end the import.
+type rowSource interface {
+	Next() (importRow, error)
+	// Columns returns the source columns when they are known up front (CSV headers)
+	Columns() []string
+}
+
+func newRowSource(format string, r io.Reader) (rowSource, error) {
+	switch format {
+	case models.ImportFormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		columns := make([]string, len(header))
+		for i, name := range header {
+			columns[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		}
+		return &csvSource{reader: reader, columns: columns}, nil
+	case models.ImportFormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+		return &ndjsonSource{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+type csvSource struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func (s *csvSource) Columns() []string {
+	return s.columns
+}
+
+func (s *csvSource) Next() (importRow, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &rowError{message: parseErr.Err.Error()}
+		}
+		return nil, err
+	}
+
+	row := make(importRow, len(s.columns))
+	for i, column := range s.columns {
+		if i < len(record) {
+			row[column] = record[i]
+		}
+	}
+	return row, nil
+}
+
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+}
+
+func (s *ndjsonSource) Columns() []string {
+	return nil
+}
+
+func (s *ndjsonSource) Next() (importRow, error) {
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		var row importRow
+		if err := decoder.Decode(&row); err != nil {
+			return nil, &rowError{message: "row is not a JSON object"}
+		}
+		return row, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// errNotCoercible is returned when a value cannot be converted to the field's type
+var errNotCoercible = errors.New("value has the wrong type")
+
+// coerceString converts strings, numbers and booleans to a trimmed string
+func coerceString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", errNotCoercible
+}
+
+// coerceUint converts a number or numeric string, empty values become 0
+func coerceUint(value interface{}) (uint64, error) {
+	s, err := coerceString(value)
+	if err != nil || s == "" {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("value is not a whole number")
+	}
+	return n, nil
+}
+
+// coerceMoney converts a number or an amount such as "$1,299.50". A leading currency
+// symbol is dropped and commas are taken as thousands separators.
+func coerceMoney(value interface{}) (models.Money, error) {
+	s, err := coerceString(value)
+	if err != nil || s == "" {
+		return models.Money{}, err
+	}
+	s = strings.TrimLeft(s, "$€£¥ ")
+	s = strings.ReplaceAll(s, ",", "")
+	money, err := models.NewMoney(s)
+	if err != nil {
+		return models.Money{}, errors.New("value is not a valid amount")
+	}
+	return money, nil
+}
+
+// coerceTags converts a JSON array or a list separated by commas, semicolons or pipes
+func coerceTags(value interface{}) ([]string, error) {
+	var parts []string
+	switch v := value.(type) {
+	case nil:
+		return []string{}, nil
+	case []interface{}:
+		for _, element := range v {
+			s, err := coerceString(element)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		}
+	default:
+		s, err := coerceString(v)
+		if err != nil {
+			return nil, err
+		}
+		parts = strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '|' })
+	}
+
+	tags := []string{}
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			tags = append(tags, part)
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,560 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/validation"
+)
+
+// importChunkSize is the number of rows written, and progress reported, at a time
+const importChunkSize = 1000
+
+// importQueueSize bounds the number of imports waiting for a worker
+const importQueueSize = 100
+
+const (
+	// importHeartbeatInterval is how often an instance records that it is alive
+	importHeartbeatInterval = 30 * time.Second
+	// importStaleAfter is how long an instance may miss heartbeats before its
+	// unfinished imports are marked as failed
+	importStaleAfter = 2 * time.Minute
+)
+
+var (
+	ErrImportNotFound  = apperr.NotFound("import_not_found", "import not found")
+	ErrImportQueueFull = apperr.Conflict("import_queue_full", "too many imports are waiting, try again later")
+	ErrImportFormat    = apperr.Validation(models.FieldError{
+		Field: "format", Code: "invalid_choice", Message: "format must be csv or ndjson",
+	})
+)
+
+// ImportService runs item imports in the background. Rows whose SKU belongs to an
+// existing item update the mapped fields of that item, the other rows create items.
+// Imports are run by the instance they were uploaded to, which records a heartbeat
+// while it is alive. The queued and running imports of an instance that stopped
+// sending heartbeats are marked as failed by the other instances, or by itself
+// once restarted.
+type ImportService struct {
+	DBService       *DBService
+	NATSService     *NATSService
+	CurrencyService *CurrencyService
+	BulkItemService *BulkItemService
+	Dir             string
+
+	instanceID string
+	queue      chan models.Import
+}
+
+// NewImportService creates a new ImportService instance and starts its workers
+func NewImportService(dbService *DBService, natsService *NATSService, currencyService *CurrencyService,
+	bulkItemService *BulkItemService, dir string, workers int) (*ImportService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create import directory: %w", err)
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate import instance ID: %w", err)
+	}
+	s := &ImportService{
+		DBService:       dbService,
+		NATSService:     natsService,
+		CurrencyService: currencyService,
+		BulkItemService: bulkItemService,
+		Dir:             dir,
+		instanceID:      hex.EncodeToString(raw),
+		queue:           make(chan models.Import, importQueueSize),
+	}
+
+	ctx := context.Background()
+	if err := s.DBService.SaveImportHeartbeat(ctx, s.instanceID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err := s.failStaleImports(ctx); err != nil {
+		return nil, err
+	}
+	go s.heartbeat()
+
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	return s, nil
+}
+
+// heartbeat records that this instance is alive and fails the imports of the
+// instances that are not
+func (s *ImportService) heartbeat() {
+	ctx := context.Background()
+	for range time.Tick(importHeartbeatInterval) {
+		if err := s.DBService.SaveImportHeartbeat(ctx, s.instanceID, time.Now().UTC()); err != nil {
+			logger.ErrorContext(ctx, "Failed to save import heartbeat", "error", err)
+		}
+		if err := s.failStaleImports(ctx); err != nil {
+			logger.ErrorContext(ctx, "Failed to check for stale imports", "error", err)
+		}
+	}
+}
+
+// failStaleImports marks the unfinished imports of stopped instances as failed
+func (s *ImportService) failStaleImports(ctx context.Context) error {
+	stale, err := s.DBService.GetStaleImports(ctx, time.Now().UTC().Add(-importStaleAfter))
+	if err != nil {
+		return err
+	}
+	for _, imp := range stale {
+		s.finish(ctx, &imp, errors.New("import was interrupted, its instance stopped"))
+	}
+	return nil
+}
+
+// Start stores the upload and queues its import. mapping maps item fields to source
+// columns; unmapped fields are read from columns of the same name.
+func (s *ImportService) Start(ctx context.Context, upload io.Reader, filename, format string, mapping map[string]string, actorID uint64) (*models.Import, error) {
+	if format != models.ImportFormatCSV && format != models.ImportFormatNDJSON {
+		return nil, ErrImportFormat
+	}
+	if mapping == nil {
+		mapping = map[string]string{}
+	}
+	for field, column := range mapping {
+		if !isImportField(field) {
+			return nil, apperr.Validation(models.FieldError{
+				Field: "mapping." + field, Code: "invalid_choice", Message: fmt.Sprintf("%s is not an item field", field),
+			})
+		}
+		if strings.TrimSpace(column) == "" {
+			return nil, apperr.Validation(models.FieldError{
+				Field: "mapping." + field, Code: "required", Message: fmt.Sprintf("column for %s is empty", field),
+			})
+		}
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate import ID: %w", err)
+	}
+	id := hex.EncodeToString(raw)
+
+	file, err := os.Create(s.path(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+	size, err := io.Copy(file, upload)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(s.path(id))
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	imp := models.Import{
+		ID:         id,
+		Filename:   filename,
+		Format:     format,
+		Mapping:    mapping,
+		Status:     models.ImportStatusQueued,
+		SizeBytes:  uint64(size),
+		CreatedBy:  actorID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		InstanceID: s.instanceID,
+	}
+	if err := s.DBService.SaveImport(ctx, imp); err != nil {
+		os.Remove(s.path(id))
+		return nil, err
+	}
+
+	select {
+	case s.queue <- imp:
+	default:
+		s.finish(ctx, &imp, errors.New("import queue is full"))
+		return nil, ErrImportQueueFull
+	}
+	return &imp, nil
+}
+
+// Get returns the current state of an import
+func (s *ImportService) Get(ctx context.Context, id string) (*models.Import, error) {
+	imp, err := s.DBService.GetImport(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch import: %w", err)
+	}
+	return &imp, nil
+}
+
+// Errors passes the row errors recorded so far to fn, in row order
+func (s *ImportService) Errors(ctx context.Context, id string, fn func(models.ImportError) error) error {
+	return s.DBService.GetImportErrors(ctx, id, fn)
+}
+
+func (s *ImportService) path(id string) string {
+	return filepath.Join(s.Dir, id)
+}
+
+func (s *ImportService) worker() {
+	ctx := context.Background()
+	for imp := range s.queue {
+		imp := imp
+		err := s.run(ctx, &imp)
+		s.finish(ctx, &imp, err)
+	}
+}
+
+// finish records the outcome of an import, removes its upload and publishes it
+func (s *ImportService) finish(ctx context.Context, imp *models.Import, err error) {
+	imp.Status = models.ImportStatusCompleted
+	if err != nil {
+		imp.Status = models.ImportStatusFailed
+		imp.Error = err.Error()
+	} else {
+		imp.ProcessedBytes = imp.SizeBytes
+	}
+	finishedAt := time.Now().UTC().Truncate(time.Millisecond)
+	imp.FinishedAt = &finishedAt
+	s.save(ctx, imp)
+
+	if err := os.Remove(s.path(imp.ID)); err != nil && !os.IsNotExist(err) {
+		logger.ErrorContext(ctx, "Failed to remove import upload", "import_id", imp.ID, "error", err)
+	}
+	if err := s.NATSService.PublishImportCompleted(ctx, *imp); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish import", "import_id", imp.ID, "error", err)
+	}
+}
+
+// save stores the import's progress. Failures are only logged, the import goes on.
+func (s *ImportService) save(ctx context.Context, imp *models.Import) {
+	// States are collapsed by updated_at, so it must increase with every save
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(imp.UpdatedAt) {
+		now = imp.UpdatedAt.Add(time.Millisecond)
+	}
+	imp.UpdatedAt = now
+	if imp.SizeBytes > 0 {
+		imp.Progress = float64(imp.ProcessedBytes) / float64(imp.SizeBytes)
+	}
+	if err := s.DBService.SaveImport(ctx, *imp); err != nil {
+		logger.ErrorContext(ctx, "Failed to save import", "import_id", imp.ID, "error", err)
+	}
+}
+
+// pendingRow is a coerced row waiting to be written
+type pendingRow struct {
+	number  uint64
+	item    models.ItemRequest
+	present map[string]bool
+}
+
+// run reads the upload and writes its rows chunk by chunk
+func (s *ImportService) run(ctx context.Context, imp *models.Import) error {
+	imp.Status = models.ImportStatusRunning
+	s.save(ctx, imp)
+
+	file, err := os.Open(s.path(imp.ID))
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	counter := &countingReader{reader: file}
+	source, err := newRowSource(imp.Format, counter)
+	if err != nil {
+		return err
+	}
+	if columns := source.Columns(); columns != nil {
+		for field, column := range imp.Mapping {
+			if !containsString(columns, column) {
+				return fmt.Errorf("column %q mapped to %s not found", column, field)
+			}
+		}
+	}
+
+	var chunk []pendingRow
+	var rowErrors []models.ImportError
+	flush := func() error {
+		errs, err := s.writeChunk(ctx, imp, chunk)
+		if err != nil {
+			return err
+		}
+		rowErrors = append(rowErrors, errs...)
+		if err := s.DBService.SaveImportErrors(ctx, imp.ID, rowErrors); err != nil {
+			return err
+		}
+		imp.ProcessedBytes = uint64(counter.count)
+		s.save(ctx, imp)
+		chunk, rowErrors = chunk[:0], rowErrors[:0]
+		return nil
+	}
+
+	for number := uint64(1); ; number++ {
+		row, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		imp.ProcessedRows++
+
+		var malformed *rowError
+		switch {
+		case errors.As(err, &malformed):
+			rowErrors = append(rowErrors, models.ImportError{Row: number, Code: "malformed_row", Message: malformed.message})
+			imp.FailedRows++
+		case err != nil:
+			return fmt.Errorf("failed to read row %d: %w", number, err)
+		default:
+			pending, errs := coerceRow(number, row, imp.Mapping)
+			if len(errs) > 0 {
+				rowErrors = append(rowErrors, errs...)
+				imp.FailedRows++
+			} else {
+				chunk = append(chunk, pending)
+			}
+		}
+
+		if len(chunk)+len(rowErrors) >= importChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// writeChunk creates or updates the items of the rows and returns the row errors
+func (s *ImportService) writeChunk(ctx context.Context, imp *models.Import, rows []pendingRow) ([]models.ImportError, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// Rows whose SKU is taken update the item using it
+	var skus []string
+	for _, row := range rows {
+		if row.item.SKU != "" {
+			skus = append(skus, row.item.SKU)
+		}
+	}
+	owners, err := s.DBService.GetSKUOwners(ctx, skus)
+	if err != nil {
+		return nil, err
+	}
+	var ownerIDs []uint64
+	for _, ids := range owners {
+		ownerIDs = append(ownerIDs, ids...)
+	}
+	current, err := s.DBService.GetItemsByIDs(ctx, ownerIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var rowErrors []models.ImportError
+	var entries []BulkItemEntry
+	var numbers []uint64
+	for _, row := range rows {
+		entry := BulkItemEntry{Op: models.BulkOpCreate}
+		request := row.item
+		if ids := owners[row.item.SKU]; row.item.SKU != "" && len(ids) > 0 {
+			item, ok := current[ids[0]]
+			if !ok {
+				rowErrors = append(rowErrors, models.ImportError{
+					Row: row.number, Column: importColumn(imp.Mapping, "sku"),
+					Code: "item_in_trash", Message: "the item using this SKU is in the trash",
+				})
+				imp.FailedRows++
+				continue
+			}
+			entry.Op = models.BulkOpUpdate
+			entry.ID = item.ID
+			request = mergeImportRow(item, row)
+		}
+
+		fields := validation.Struct(&request)
+		currency, err := s.CurrencyService.ValidatePrice(request.Price, request.Currency)
+		switch {
+		case errors.Is(err, ErrUnsupportedCurrency):
+			fields = append(fields, models.FieldError{Field: "currency", Code: "unsupported_currency", Message: err.Error()})
+		case err != nil:
+			fields = append(fields, models.FieldError{Field: "price", Code: "too_precise", Message: err.Error()})
+		}
+		if len(fields) > 0 {
+			rowErrors = append(rowErrors, importFieldErrors(row.number, imp.Mapping, fields)...)
+			imp.FailedRows++
+			continue
+		}
+
+		entry.Item = models.ItemResponse{
+			Name:        request.Name,
+			Description: request.Description,
+			SKU:         request.SKU,
+			CategoryID:  request.CategoryID,
+			Tags:        request.Tags,
+			Price:       request.Price,
+			Currency:    currency,
+		}
+		entries = append(entries, entry)
+		numbers = append(numbers, row.number)
+	}
+
+	if len(entries) == 0 {
+		return rowErrors, nil
+	}
+	response, err := s.BulkItemService.Apply(ctx, entries, models.BulkModeBestEffort, imp.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range response.Results {
+		switch result.Status {
+		case "created":
+			imp.CreatedItems++
+		case "updated":
+			imp.UpdatedItems++
+		default:
+			imp.FailedRows++
+			if len(result.Error.Fields) > 0 {
+				rowErrors = append(rowErrors, importFieldErrors(numbers[i], imp.Mapping, result.Error.Fields)...)
+				continue
+			}
+			column := ""
+			if result.Error.Code == ErrDuplicateSKU.Code {
+				column = importColumn(imp.Mapping, "sku")
+			}
+			rowErrors = append(rowErrors, models.ImportError{
+				Row: numbers[i], Column: column, Code: result.Error.Code, Message: result.Error.Message,
+			})
+		}
+	}
+	return rowErrors, nil
+}
+
+// coerceRow converts the mapped columns of a row to an item request
+func coerceRow(number uint64, row importRow, mapping map[string]string) (pendingRow, []models.ImportError) {
+	pending := pendingRow{number: number, present: map[string]bool{}}
+	var rowErrors []models.ImportError
+	for _, field := range models.ImportFields {
+		column := importColumn(mapping, field)
+		value, ok := row[column]
+		if !ok {
+			continue
+		}
+		pending.present[field] = true
+
+		var err error
+		item := &pending.item
+		switch field {
+		case "name":
+			item.Name, err = coerceString(value)
+		case "description":
+			item.Description, err = coerceString(value)
+		case "sku":
+			item.SKU, err = coerceString(value)
+		case "category_id":
+			item.CategoryID, err = coerceUint(value)
+		case "tags":
+			item.Tags, err = coerceTags(value)
+		case "price":
+			item.Price, err = coerceMoney(value)
+		case "currency":
+			item.Currency, err = coerceString(value)
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportError{Row: number, Column: column, Code: "invalid", Message: err.Error()})
+		}
+	}
+	return pending, rowErrors
+}
+
+// mergeImportRow applies the fields present in the row to an existing item
+func mergeImportRow(item models.ItemResponse, row pendingRow) models.ItemRequest {
+	request := models.ItemRequest{
+		Name:        item.Name,
+		Description: item.Description,
+		SKU:         item.SKU,
+		CategoryID:  item.CategoryID,
+		Tags:        item.Tags,
+		Price:       item.Price,
+		Currency:    item.Currency,
+	}
+	if row.present["name"] {
+		request.Name = row.item.Name
+	}
+	if row.present["description"] {
+		request.Description = row.item.Description
+	}
+	if row.present["category_id"] {
+		request.CategoryID = row.item.CategoryID
+	}
+	if row.present["tags"] {
+		request.Tags = row.item.Tags
+	}
+	if row.present["price"] {
+		request.Price = row.item.Price
+	}
+	if row.present["currency"] {
+		request.Currency = row.item.Currency
+	}
+	return request
+}
+
+// importFieldErrors converts field errors of a row into import errors on the source columns
+func importFieldErrors(number uint64, mapping map[string]string, fields []models.FieldError) []models.ImportError {
+	rowErrors := make([]models.ImportError, len(fields))
+	for i, field := range fields {
+		// Paths such as "tags[2]" belong to the column of their top-level field. Errors
+		// of bulk operations locate the field in the operation's item.
+		name := strings.TrimPrefix(field.Field, "item.")
+		if end := strings.IndexAny(name, "[."); end >= 0 {
+			name = name[:end]
+		}
+		rowErrors[i] = models.ImportError{
+			Row: number, Column: importColumn(mapping, name), Code: field.Code, Message: field.Message,
+		}
+	}
+	return rowErrors
+}
+
+// importColumn returns the source column of an item field
+func importColumn(mapping map[string]string, field string) string {
+	if column, ok := mapping[field]; ok {
+		return column
+	}
+	return field
+}
+
+func isImportField(field string) bool {
+	return containsString(models.ImportFields, field)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// countingReader counts the bytes read so far, for progress reporting
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
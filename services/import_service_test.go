@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go-clickhouse-example/models"
+)
+
+// sameItemRequest compares requests, prices by value
+func sameItemRequest(a, b models.ItemRequest) bool {
+	if !a.Price.Equal(b.Price.Decimal) {
+		return false
+	}
+	a.Price, b.Price = models.Money{}, models.Money{}
+	return reflect.DeepEqual(a, b)
+}
+
+func mustMoney(t *testing.T, value string) models.Money {
+	t.Helper()
+	m, err := models.NewMoney(value)
+	if err != nil {
+		t.Fatalf("NewMoney(%q): %v", value, err)
+	}
+	return m
+}
+
+func TestCoerceRow(t *testing.T) {
+	mapping := map[string]string{"name": "Title", "price": "Unit Price"}
+
+	tests := []struct {
+		name        string
+		row         importRow
+		wantItem    models.ItemRequest
+		wantPresent []string
+		wantErrors  []models.ImportError
+	}{
+		{
+			name: "CSV strings",
+			row: importRow{"Title": " Widget ", "description": "A widget", "sku": "W-1", "category_id": "3",
+				"tags": "a, b;c|| d", "Unit Price": "$1,299.50", "currency": "EUR"},
+			wantItem: models.ItemRequest{Name: "Widget", Description: "A widget", SKU: "W-1", CategoryID: 3,
+				Tags: []string{"a", "b", "c", "d"}, Price: mustMoney(t, "1299.5"), Currency: "EUR"},
+			wantPresent: []string{"name", "description", "sku", "category_id", "tags", "price", "currency"},
+		},
+		{
+			name: "JSON values",
+			row: importRow{"Title": "Widget", "sku": json.Number("42"), "category_id": json.Number("7"),
+				"tags": []interface{}{"a", json.Number("2"), true, " "}, "Unit Price": json.Number("19.99")},
+			wantItem: models.ItemRequest{Name: "Widget", SKU: "42", CategoryID: 7,
+				Tags: []string{"a", "2", "true"}, Price: mustMoney(t, "19.99")},
+			wantPresent: []string{"name", "sku", "category_id", "tags", "price"},
+		},
+		{
+			name:        "empty and null values",
+			row:         importRow{"Title": nil, "category_id": "", "tags": nil, "Unit Price": ""},
+			wantItem:    models.ItemRequest{Tags: []string{}},
+			wantPresent: []string{"name", "category_id", "tags", "price"},
+		},
+		{
+			name:        "unmapped field names are ignored",
+			row:         importRow{"name": "Widget", "price": "1", "color": "red"},
+			wantPresent: []string{},
+		},
+		{
+			name: "invalid values",
+			row: importRow{"Title": []interface{}{"x"}, "category_id": "-3", "tags": []interface{}{map[string]interface{}{}},
+				"Unit Price": "twelve", "currency": map[string]interface{}{}},
+			wantPresent: []string{"name", "category_id", "tags", "price", "currency"},
+			wantErrors: []models.ImportError{
+				{Row: 4, Column: "Title", Code: "invalid", Message: "value has the wrong type"},
+				{Row: 4, Column: "category_id", Code: "invalid", Message: "value is not a whole number"},
+				{Row: 4, Column: "tags", Code: "invalid", Message: "value has the wrong type"},
+				{Row: 4, Column: "Unit Price", Code: "invalid", Message: "value is not a valid amount"},
+				{Row: 4, Column: "currency", Code: "invalid", Message: "value has the wrong type"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, rowErrors := coerceRow(4, tt.row, mapping)
+			if pending.number != 4 {
+				t.Errorf("coerceRow() row number = %d, want 4", pending.number)
+			}
+			if len(tt.wantErrors) == 0 && !sameItemRequest(pending.item, tt.wantItem) {
+				t.Errorf("coerceRow() item = %+v, want %+v", pending.item, tt.wantItem)
+			}
+			wantPresent := map[string]bool{}
+			for _, field := range tt.wantPresent {
+				wantPresent[field] = true
+			}
+			if !reflect.DeepEqual(pending.present, wantPresent) {
+				t.Errorf("coerceRow() present = %v, want %v", pending.present, wantPresent)
+			}
+			if !reflect.DeepEqual(rowErrors, tt.wantErrors) {
+				t.Errorf("coerceRow() errors = %+v, want %+v", rowErrors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestMergeImportRow(t *testing.T) {
+	item := models.ItemResponse{ID: 9, Name: "Widget", Description: "Old", SKU: "W-1", CategoryID: 3,
+		Tags: []string{"a"}, Price: mustMoney(t, "10"), Currency: "USD"}
+	stored := models.ItemRequest{Name: "Widget", Description: "Old", SKU: "W-1", CategoryID: 3,
+		Tags: []string{"a"}, Price: mustMoney(t, "10"), Currency: "USD"}
+
+	tests := []struct {
+		name string
+		row  pendingRow
+		want models.ItemRequest
+	}{
+		{"no fields keeps the item", pendingRow{present: map[string]bool{}}, stored},
+		{
+			name: "present fields replace the item's",
+			row: pendingRow{
+				item:    models.ItemRequest{Name: "New", Description: "", Tags: []string{}, Price: mustMoney(t, "12.5")},
+				present: map[string]bool{"name": true, "description": true, "tags": true, "price": true},
+			},
+			want: models.ItemRequest{Name: "New", Description: "", SKU: "W-1", CategoryID: 3,
+				Tags: []string{}, Price: mustMoney(t, "12.5"), Currency: "USD"},
+		},
+		{
+			name: "absent fields keep the item's",
+			row: pendingRow{
+				item:    models.ItemRequest{Name: "Ignored", CategoryID: 5, Currency: "EUR"},
+				present: map[string]bool{"category_id": true, "currency": true},
+			},
+			want: models.ItemRequest{Name: "Widget", Description: "Old", SKU: "W-1", CategoryID: 5,
+				Tags: []string{"a"}, Price: mustMoney(t, "10"), Currency: "EUR"},
+		},
+		{
+			name: "the SKU identifies the item and is kept",
+			row: pendingRow{
+				item:    models.ItemRequest{SKU: "w-1"},
+				present: map[string]bool{"sku": true},
+			},
+			want: stored,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeImportRow(item, tt.row); !sameItemRequest(got, tt.want) {
+				t.Errorf("mergeImportRow() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportFieldErrors(t *testing.T) {
+	mapping := map[string]string{"price": "Unit Price", "tags": "Labels"}
+	fields := []models.FieldError{
+		{Field: "price", Code: "too_small", Message: "price must be at least 0"},
+		{Field: "tags[2]", Code: "too_long", Message: "tags[2] must have at most 50 characters"},
+		{Field: "item.name", Code: "required", Message: "name is required"},
+		{Field: "item.category_id", Code: "not_found", Message: "category not found"},
+	}
+	want := []models.ImportError{
+		{Row: 8, Column: "Unit Price", Code: "too_small", Message: "price must be at least 0"},
+		{Row: 8, Column: "Labels", Code: "too_long", Message: "tags[2] must have at most 50 characters"},
+		{Row: 8, Column: "name", Code: "required", Message: "name is required"},
+		{Row: 8, Column: "category_id", Code: "not_found", Message: "category not found"},
+	}
+	if got := importFieldErrors(8, mapping, fields); !reflect.DeepEqual(got, want) {
+		t.Errorf("importFieldErrors() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string
+		wantMax  int
+		wantLeft int
+	}{
+		{"same key is serialized", []string{"a", "a", "a", "a"}, 1, 0},
+		{"different keys run concurrently", []string{"a", "b", "c", "d"}, 4, 0},
+		{"mixed keys", []string{"a", "a", "b", "b"}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var k keyedMutex
+			var mu sync.Mutex
+			running := map[string]int{}
+			total, maxTotal := 0, 0
+
+			var wg sync.WaitGroup
+			for _, key := range tt.keys {
+				wg.Add(1)
+				go func(key string) {
+					defer wg.Done()
+					unlock := k.Lock(key)
+					defer unlock()
+
+					mu.Lock()
+					running[key]++
+					if running[key] > 1 {
+						t.Errorf("key %q held twice", key)
+					}
+					total++
+					maxTotal = max(maxTotal, total)
+					mu.Unlock()
+
+					time.Sleep(50 * time.Millisecond)
+
+					mu.Lock()
+					running[key]--
+					total--
+					mu.Unlock()
+				}(key)
+			}
+			wg.Wait()
+
+			if maxTotal != tt.wantMax {
+				t.Errorf("%d keys held at once, want %d", maxTotal, tt.wantMax)
+			}
+			if len(k.locks) != tt.wantLeft {
+				t.Errorf("%d locks left after unlocking, want %d", len(k.locks), tt.wantLeft)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package services
+
+import "go-clickhouse-example/logging"
+
+// logger writes the package's logs, at the level configured for "services"
+var logger = logging.For("services")
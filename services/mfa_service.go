@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/utils"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued on activation
+	recoveryCodeCount = 10
+	// maxChallengeFailures is the number of invalid codes an MFA challenge allows
+	// before the user must log in with the password again
+	maxChallengeFailures = 5
+	// maxUserMFAFailures is the number of invalid codes a user may submit within
+	// mfaFailureWindow across all challenges
+	maxUserMFAFailures = 10
+	mfaFailureWindow   = 15 * time.Minute
+)
+
+var (
+	ErrMFAAlreadyEnabled = apperr.Conflict("mfa_already_enabled", "MFA is already enabled")
+	ErrMFANotEnrolled    = apperr.Invalid("mfa_not_enrolled", "MFA enrollment has not been started")
+	ErrMFANotEnabled     = apperr.Invalid("mfa_not_enabled", "MFA is not enabled")
+	ErrInvalidMFACode    = apperr.Unauthorized("invalid_mfa_code", "invalid MFA code")
+	// ErrInvalidMFAChallenge is returned when the token from the first login step is invalid or expired
+	ErrInvalidMFAChallenge = apperr.Unauthorized("invalid_mfa_challenge", "invalid or expired MFA challenge")
+	// ErrMFAChallengeExhausted is returned once a challenge was used with too many invalid codes
+	ErrMFAChallengeExhausted = apperr.Unauthorized("mfa_challenge_exhausted", "too many invalid MFA codes, log in again")
+	ErrTooManyMFAAttempts    = apperr.TooManyRequests("too_many_mfa_attempts", "too many invalid MFA codes, try again later")
+)
+
+// MFAStore is the storage used by MFAService, implemented by DBService
+type MFAStore interface {
+	GetUserByID(ctx context.Context, id uint64) (models.UserResponse, error)
+	SetUserTOTP(ctx context.Context, userID uint64, secret string, enabled bool) error
+	SetTOTPLastStep(ctx context.Context, userID uint64, step int64) error
+	RecordMFAFailure(ctx context.Context, userID uint64, challengeID string, at time.Time) error
+	CountMFAFailures(ctx context.Context, userID uint64, challengeID string, since time.Time) (uint64, uint64, error)
+	ConsumeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uint64, codeHashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error)
+}
+
+// MFAService handles TOTP enrollment and verification.
+// The store cannot check and consume a code, challenge or recovery code atomically,
+// so every operation checking a code is serialized per user, from reading the user
+// to recording the use. This holds within this instance; running several instances
+// requires routing the MFA routes of a user to one of them.
+type MFAService struct {
+	Store  MFAStore
+	Issuer string
+
+	users keyedMutex
+}
+
+// NewMFAService creates a new MFAService instance
+func NewMFAService(dbService *DBService, issuer string) *MFAService {
+	return &MFAService{Store: dbService, Issuer: issuer}
+}
+
+// lockUser serializes the code checks of a user and returns the unlock function
+func (s *MFAService) lockUser(userID uint64) func() {
+	return s.users.Lock(strconv.FormatUint(userID, 10))
+}
+
+// Enroll generates a new TOTP secret for the user. MFA stays inactive until
+// the user proves possession of the secret with Activate.
+func (s *MFAService) Enroll(ctx context.Context, userID uint64) (*models.TOTPEnrollResponse, error) {
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.SetUserTOTP(ctx, userID, secret, false); err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.Issuer, user.Username, secret),
+	}, nil
+}
+
+// Activate verifies the first TOTP code, enables MFA and returns new recovery codes
+func (s *MFAService) Activate(ctx context.Context, userID uint64, code string) ([]string, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	if err := s.checkTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.SetUserTOTP(ctx, userID, user.TOTPSecret, true); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying a TOTP code
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint64, code string) ([]string, error) {
+	defer s.lockUser(userID)()
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.checkTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// Disable turns MFA off after verifying a TOTP code
+func (s *MFAService) Disable(ctx context.Context, userID uint64, code string) error {
+	defer s.lockUser(userID)()
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+	if err := s.checkTOTP(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := s.Store.SetUserTOTP(ctx, userID, "", false); err != nil {
+		return err
+	}
+	return s.Store.ReplaceRecoveryCodes(ctx, userID, nil)
+}
+
+// VerifyLogin completes the second login step. Exactly one of code and
+// recoveryCode is expected; a recovery code can only be used once. The challenge
+// is consumed on success, and is refused after maxChallengeFailures invalid
+// codes, as are all challenges of a user who submitted maxUserMFAFailures invalid
+// codes within mfaFailureWindow. Attempts of a user are serialized, so that
+// concurrent requests cannot reuse a code or exceed the failure limits.
+func (s *MFAService) VerifyLogin(ctx context.Context, challengeToken, code, recoveryCode string) (*models.UserResponse, error) {
+	challenge, err := utils.ParseMFAChallenge(challengeToken)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	userID := challenge.UserID
+
+	// The failure counts, the user with its last TOTP step and the challenge are
+	// all read after taking the lock
+	defer s.lockUser(userID)()
+
+	now := time.Now().UTC()
+	challengeFailures, userFailures, err := s.Store.CountMFAFailures(ctx, userID, challenge.ID, now.Add(-mfaFailureWindow))
+	if err != nil {
+		return nil, err
+	}
+	if challengeFailures >= maxChallengeFailures {
+		return nil, ErrMFAChallengeExhausted
+	}
+	if userFailures >= maxUserMFAFailures {
+		return nil, ErrTooManyMFAAttempts
+	}
+
+	user, err := s.Store.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	switch {
+	case code != "":
+		err = s.checkTOTP(ctx, user, code)
+	case recoveryCode != "":
+		var ok bool
+		ok, err = s.Store.ConsumeRecoveryCode(ctx, userID, hashRecoveryCode(recoveryCode))
+		if err == nil && !ok {
+			err = ErrInvalidMFACode
+		}
+	default:
+		err = ErrInvalidMFACode
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := s.Store.RecordMFAFailure(ctx, userID, challenge.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fresh, err := s.Store.ConsumeToken(ctx, challenge.ID, challenge.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return &user, nil
+}
+
+// checkTOTP validates a TOTP code of the user and records its time step, so that
+// neither the code nor an earlier one can be used again. The caller holds the
+// user's lock and has read the user after taking it.
+func (s *MFAService) checkTOTP(ctx context.Context, user models.UserResponse, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return s.Store.SetTOTPLastStep(ctx, user.ID, step)
+}
+
+func (s *MFAService) issueRecoveryCodes(ctx context.Context, userID uint64) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := s.Store.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode normalizes user input before hashing so that case and surrounding
+// whitespace do not matter
+func hashRecoveryCode(code string) string {
+	return utils.HashToken(strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/utils"
+)
+
+// memMFAStore keeps MFA state in memory. Like the database, each method is atomic
+// on its own but a check followed by a write is not; every read sleeps briefly so
+// that concurrent requests interleave between them.
+type memMFAStore struct {
+	mu            sync.Mutex
+	user          models.UserResponse
+	consumed      map[string]bool
+	recoveryCodes map[string]bool
+	failures      []mfaFailure
+}
+
+type mfaFailure struct {
+	challengeID string
+	at          time.Time
+}
+
+func (m *memMFAStore) pause() { time.Sleep(time.Millisecond) }
+
+func (m *memMFAStore) GetUserByID(ctx context.Context, id uint64) (models.UserResponse, error) {
+	m.mu.Lock()
+	user := m.user
+	m.mu.Unlock()
+	m.pause()
+	return user, nil
+}
+
+func (m *memMFAStore) SetUserTOTP(ctx context.Context, userID uint64, secret string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.user.TOTPSecret, m.user.MFAEnabled = secret, enabled
+	return nil
+}
+
+func (m *memMFAStore) SetTOTPLastStep(ctx context.Context, userID uint64, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.user.TOTPLastStep = max(m.user.TOTPLastStep, step)
+	return nil
+}
+
+func (m *memMFAStore) RecordMFAFailure(ctx context.Context, userID uint64, challengeID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, mfaFailure{challengeID, at})
+	return nil
+}
+
+func (m *memMFAStore) CountMFAFailures(ctx context.Context, userID uint64, challengeID string, since time.Time) (uint64, uint64, error) {
+	m.mu.Lock()
+	var challengeFailures, userFailures uint64
+	for _, f := range m.failures {
+		if f.challengeID == challengeID {
+			challengeFailures++
+		}
+		if !f.at.Before(since) {
+			userFailures++
+		}
+	}
+	m.mu.Unlock()
+	m.pause()
+	return challengeFailures, userFailures, nil
+}
+
+func (m *memMFAStore) ConsumeToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	used := m.consumed[jti]
+	m.mu.Unlock()
+	m.pause()
+	if used {
+		return false, nil
+	}
+	m.mu.Lock()
+	m.consumed[jti] = true
+	m.mu.Unlock()
+	return true, nil
+}
+
+func (m *memMFAStore) ReplaceRecoveryCodes(ctx context.Context, userID uint64, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recoveryCodes = map[string]bool{}
+	for _, hash := range codeHashes {
+		m.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+func (m *memMFAStore) ConsumeRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error) {
+	m.mu.Lock()
+	exists := m.recoveryCodes[codeHash]
+	m.mu.Unlock()
+	m.pause()
+	if !exists {
+		return false, nil
+	}
+	m.mu.Lock()
+	delete(m.recoveryCodes, codeHash)
+	m.mu.Unlock()
+	return true, nil
+}
+
+// currentTOTP computes the code of the secret for the current time step (RFC 6238)
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding TOTP secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestVerifyLoginConcurrentReuse(t *testing.T) {
+	const attempts = 20
+
+	tests := []struct {
+		name string
+		// sameChallenge sends every attempt with one challenge, otherwise each
+		// attempt logs in again and gets a challenge of its own
+		sameChallenge bool
+		// code and recoveryCode return the codes submitted, given the valid ones
+		code         func(totp string) string
+		recoveryCode func(recovery string) string
+		want         map[error]int
+	}{
+		{
+			name: "one TOTP code with one challenge", sameChallenge: true,
+			code: func(totp string) string { return totp },
+			want: map[error]int{nil: 1, ErrInvalidMFACode: maxChallengeFailures, ErrMFAChallengeExhausted: attempts - 1 - maxChallengeFailures},
+		},
+		{
+			name: "one TOTP code with many challenges",
+			code: func(totp string) string { return totp },
+			want: map[error]int{nil: 1, ErrInvalidMFACode: maxUserMFAFailures, ErrTooManyMFAAttempts: attempts - 1 - maxUserMFAFailures},
+		},
+		{
+			name:         "one recovery code with many challenges",
+			recoveryCode: func(recovery string) string { return recovery },
+			want:         map[error]int{nil: 1, ErrInvalidMFACode: maxUserMFAFailures, ErrTooManyMFAAttempts: attempts - 1 - maxUserMFAFailures},
+		},
+		{
+			name: "invalid codes with one challenge", sameChallenge: true,
+			code: func(string) string { return "not-a-code" },
+			want: map[error]int{ErrInvalidMFACode: maxChallengeFailures, ErrMFAChallengeExhausted: attempts - maxChallengeFailures},
+		},
+		{
+			name: "invalid codes with many challenges",
+			code: func(string) string { return "not-a-code" },
+			want: map[error]int{ErrInvalidMFACode: maxUserMFAFailures, ErrTooManyMFAAttempts: attempts - maxUserMFAFailures},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := utils.GenerateTOTPSecret()
+			if err != nil {
+				t.Fatalf("GenerateTOTPSecret: %v", err)
+			}
+			const recovery = "abcde-12345"
+			store := &memMFAStore{
+				user:          models.UserResponse{ID: 1, MFAEnabled: true, TOTPSecret: secret},
+				consumed:      map[string]bool{},
+				recoveryCodes: map[string]bool{hashRecoveryCode(recovery): true},
+			}
+			service := &MFAService{Store: store}
+
+			challenges := make([]string, attempts)
+			for i := range challenges {
+				if i == 0 || !tt.sameChallenge {
+					if challenges[i], err = utils.GenerateMFAChallenge(&store.user); err != nil {
+						t.Fatalf("GenerateMFAChallenge: %v", err)
+					}
+				} else {
+					challenges[i] = challenges[0]
+				}
+			}
+			var code, recoveryCode string
+			if tt.code != nil {
+				code = tt.code(currentTOTP(t, secret))
+			}
+			if tt.recoveryCode != nil {
+				recoveryCode = tt.recoveryCode(recovery)
+			}
+
+			results := make(chan error, attempts)
+			var wg sync.WaitGroup
+			for _, challenge := range challenges {
+				wg.Add(1)
+				go func(challenge string) {
+					defer wg.Done()
+					_, err := service.VerifyLogin(context.Background(), challenge, code, recoveryCode)
+					results <- err
+				}(challenge)
+			}
+			wg.Wait()
+			close(results)
+
+			got := map[error]int{}
+			for err := range results {
+				got[classifyMFAError(err, tt.want)]++
+			}
+			for err, n := range tt.want {
+				if got[err] != n {
+					t.Errorf("%d attempts ended with %v, want %d (all results: %v)", got[err], err, n, got)
+				}
+			}
+		})
+	}
+}
+
+// classifyMFAError maps err to the expected error it is, or returns it unchanged
+func classifyMFAError(err error, want map[error]int) error {
+	for expected := range want {
+		if expected != nil && errors.Is(err, expected) {
+			return expected
+		}
+	}
+	return err
+}
@@ -1,14 +1,27 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"time"
 
+	"go-clickhouse-example/logging"
+	"go-clickhouse-example/metrics"
 	"go-clickhouse-example/models"
 
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// natsSystem marks the spans of NATS messages
+var natsSystem = semconv.MessagingSystemKey.String("nats")
+
 type NATSService struct {
 	js          nats.JetStreamContext
 	streamName  string
@@ -16,23 +29,38 @@ type NATSService struct {
 }
 
 func NewNATSService(natsURL, streamName, subjectName string) *NATSService {
-	nc, err := nats.Connect(natsURL)
+	nc, err := nats.Connect(natsURL,
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			metrics.NATSDisconnects.Inc()
+			logger.Warn("Disconnected from NATS", "error", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			metrics.NATSReconnects.Inc()
+			logger.Info("Reconnected to NATS", "url", nc.ConnectedUrlRedacted())
+		}),
+	)
 	if err != nil {
-		log.Fatalf("Failed to connect to NATS: %v", err)
+		logging.Fatal(logger, "Failed to connect to NATS", "error", err)
 	}
 
 	js, err := nc.JetStream()
 	if err != nil {
-		log.Fatalf("Failed to create JetStream context: %v", err)
+		logging.Fatal(logger, "Failed to create JetStream context", "error", err)
 	}
 
-	_, err = js.AddStream(&nats.StreamConfig{
+	// Item events are published on the subject itself, other events on subjects below it
+	streamConfig := &nats.StreamConfig{
 		Name:     streamName,
-		Subjects: []string{subjectName},
+		Subjects: []string{subjectName, subjectName + ".>"},
 		Storage:  nats.FileStorage,
-	})
+	}
+	_, err = js.AddStream(streamConfig)
+	if errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+		// Streams created by older versions only cover the item subject
+		_, err = js.UpdateStream(streamConfig)
+	}
 	if err != nil {
-		log.Fatalf("Failed to create stream: %v", err)
+		logging.Fatal(logger, "Failed to create stream", "stream", streamName, "error", err)
 	}
 
 	return &NATSService{
@@ -42,23 +70,136 @@ func NewNATSService(natsURL, streamName, subjectName string) *NATSService {
 	}
 }
 
-func (n *NATSService) PublishItem(item models.ItemResponse) error {
-	data, err := json.Marshal(item)
+func (n *NATSService) PublishItem(ctx context.Context, item models.ItemResponse) error {
+	return n.publish(ctx, "item", n.subjectName, item)
+}
+
+// StockSubject returns the subject stock movements are published on
+func (n *NATSService) StockSubject() string {
+	return n.subjectName + ".stock"
+}
+
+// PublishStockMovement publishes a recorded stock movement with the resulting balance
+func (n *NATSService) PublishStockMovement(ctx context.Context, movement models.StockMovement) error {
+	return n.publish(ctx, "stock_movement", n.StockSubject(), movement)
+}
+
+// BulkSubject returns the subject bulk item events are published on
+func (n *NATSService) BulkSubject() string {
+	return n.subjectName + ".bulk"
+}
+
+// PublishBulkItems publishes the aggregated event of a bulk request
+func (n *NATSService) PublishBulkItems(ctx context.Context, event models.BulkItemEvent) error {
+	return n.publish(ctx, "bulk_items", n.BulkSubject(), event)
+}
+
+// ImportCompletedSubject returns the subject finished imports are published on
+func (n *NATSService) ImportCompletedSubject() string {
+	return n.subjectName + ".import.completed"
+}
+
+// PublishImportCompleted publishes an import that completed or failed
+func (n *NATSService) PublishImportCompleted(ctx context.Context, imp models.Import) error {
+	return n.publish(ctx, "import_completed", n.ImportCompletedSubject(), imp)
+}
+
+// SavedSearchSubject returns the subject the matches of a user's saved searches are
+// published on
+func (n *NATSService) SavedSearchSubject(userID uint64) string {
+	return fmt.Sprintf("%s.saved_searches.%d", n.subjectName, userID)
+}
+
+// PublishSavedSearchMatch publishes a new match of a saved search to its user
+func (n *NATSService) PublishSavedSearchMatch(ctx context.Context, match models.SavedSearchMatch) error {
+	return n.publish(ctx, "saved_search_match", n.SavedSearchSubject(match.UserID), match)
+}
+
+// publish sends v as JSON and waits for JetStream to store it. The event names the
+// kind of message in the publish metrics. The message headers carry the trace
+// context of the publish span, so that subscribers continue the trace.
+func (n *NATSService) publish(ctx context.Context, event, subject string, v interface{}) error {
+	data, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	_, err = n.js.Publish(n.subjectName, data)
+	ctx, span := tracer.Start(ctx, subject+" publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(natsSystem, semconv.MessagingDestinationName(subject), semconv.MessagingOperationTypePublish))
+	defer span.End()
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+
+	start := time.Now()
+	_, err = n.js.PublishMsg(msg)
+	metrics.NATSPublishDuration.WithLabelValues(event).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.NATSPublishFailures.WithLabelValues(event).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish failed")
+	}
+	return err
+}
+
+// SubscribeItemsSince delivers the item events published since the given time,
+// then new ones as they are published. Deleted items have DeletedAt set.
+func (n *NATSService) SubscribeItemsSince(since time.Time, handler func(context.Context, models.ItemResponse)) error {
+	return subscribeSince(n.js, n.subjectName, since, handler)
+}
+
+// SubscribeBulkItemsSince delivers the bulk item events published since the given time
+func (n *NATSService) SubscribeBulkItemsSince(since time.Time, handler func(context.Context, models.BulkItemEvent)) error {
+	return subscribeSince(n.js, n.BulkSubject(), since, handler)
+}
+
+// SubscribeStockMovementsSince delivers the stock movements published since the given time
+func (n *NATSService) SubscribeStockMovementsSince(since time.Time, handler func(context.Context, models.StockMovement)) error {
+	return subscribeSince(n.js, n.StockSubject(), since, handler)
+}
+
+// subscribeSince creates an ephemeral consumer of the subject starting at the given
+// time and decodes each message into a T
+func subscribeSince[T any](js nats.JetStreamContext, subject string, since time.Time, handler func(context.Context, T)) error {
+	_, err := js.Subscribe(subject, decode(handler), nats.StartTime(since), nats.AckNone())
 	return err
 }
 
-func (n *NATSService) SubscribeItem(handler func(models.ItemResponse)) error {
-	_, err := n.js.Subscribe(n.subjectName, func(msg *nats.Msg) {
-		var item models.ItemResponse
-		if err := json.Unmarshal(msg.Data, &item); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
+// QueueSubscribeItems delivers new item events to one member of the queue group of
+// a durable consumer, so that instances sharing the name split the events between
+// them and resume where they left off after a restart
+func (n *NATSService) QueueSubscribeItems(durable string, handler func(context.Context, models.ItemResponse)) error {
+	return queueSubscribe(n.js, n.subjectName, durable, handler)
+}
+
+// QueueSubscribeBulkItems is QueueSubscribeItems for bulk item events
+func (n *NATSService) QueueSubscribeBulkItems(durable string, handler func(context.Context, models.BulkItemEvent)) error {
+	return queueSubscribe(n.js, n.BulkSubject(), durable, handler)
+}
+
+// queueSubscribe creates, or binds to, a durable queue consumer of the subject
+// delivering new messages and decodes each message into a T
+func queueSubscribe[T any](js nats.JetStreamContext, subject, durable string, handler func(context.Context, T)) error {
+	_, err := js.QueueSubscribe(subject, durable, decode(handler), nats.Durable(durable), nats.DeliverNew())
+	return err
+}
+
+// decode returns a message handler decoding each message into a T. The handler
+// runs in a span continuing the trace found in the message headers.
+func decode[T any](handler func(context.Context, T)) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(msg.Header))
+		ctx, span := tracer.Start(ctx, msg.Subject+" process", trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(natsSystem, semconv.MessagingDestinationName(msg.Subject), semconv.MessagingOperationTypeDeliver))
+		defer span.End()
+
+		var v T
+		if err := json.Unmarshal(msg.Data, &v); err != nil {
+			logger.ErrorContext(ctx, "Failed to unmarshal message", "subject", msg.Subject, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "invalid message")
 			return
 		}
-		handler(item)
-	})
-	return err
+		handler(ctx, v)
+	}
 }
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// MaxSavedSearches bounds the number of saved searches of a user
+	MaxSavedSearches = 50
+	// savedSearchReloadInterval is how often the saved searches are reloaded, so that
+	// changes made through other instances are picked up
+	savedSearchReloadInterval = 30 * time.Second
+	// savedSearchWebhookTimeout bounds each webhook request
+	savedSearchWebhookTimeout = 5 * time.Second
+	// savedSearchConsumer names the durable NATS consumers shared by every instance
+	savedSearchConsumer = "saved_searches"
+)
+
+var (
+	ErrSavedSearchNotFound  = apperr.NotFound("saved_search_not_found", "saved search not found")
+	ErrTooManySavedSearches = apperr.Conflict("too_many_saved_searches",
+		fmt.Sprintf("a user cannot have more than %d saved searches", MaxSavedSearches))
+	ErrInvalidWebhookURL = apperr.Validation(models.FieldError{
+		Field: "webhook_url", Code: "invalid_webhook_url", Message: "webhook URL must be an http or https URL",
+	})
+	ErrWebhookNotAllowed = apperr.Validation(models.FieldError{
+		Field: "webhook_url", Code: "webhook_not_allowed", Message: "webhook host must resolve to public addresses only",
+	})
+)
+
+// SavedSearchService manages the users' saved searches and notifies them of new
+// matches. Every item event of the NATS stream is evaluated against every saved
+// search; an item matching a search is delivered once per search, on the user's
+// NATS subject and to the search's webhook. Items are only matched against
+// searches saved before they were last changed, so that saving a search does
+// not notify about the items that already existed. Recording a match is
+// serialized per search and item within this instance, so that concurrent events
+// of an item cannot both be delivered.
+type SavedSearchService struct {
+	DBService   *DBService
+	NATSService *NATSService
+
+	client  *http.Client
+	matches keyedMutex
+
+	mu       sync.RWMutex
+	searches []compiledSearch
+}
+
+type compiledSearch struct {
+	search models.SavedSearch
+	expr   *models.FilterExpr
+}
+
+// NewSavedSearchService creates a new SavedSearchService instance
+func NewSavedSearchService(dbService *DBService, natsService *NATSService) *SavedSearchService {
+	return &SavedSearchService{
+		DBService:   dbService,
+		NATSService: natsService,
+		client:      newWebhookClient(savedSearchWebhookTimeout),
+	}
+}
+
+// Start loads the saved searches, subscribes to the item events and reloads the
+// searches periodically
+func (s *SavedSearchService) Start() error {
+	if err := s.reload(context.Background()); err != nil {
+		return err
+	}
+	if err := s.NATSService.QueueSubscribeItems(savedSearchConsumer+"_items", s.matchItem); err != nil {
+		return fmt.Errorf("failed to subscribe to item events: %w", err)
+	}
+	if err := s.NATSService.QueueSubscribeBulkItems(savedSearchConsumer+"_bulk", s.matchBulkItems); err != nil {
+		return fmt.Errorf("failed to subscribe to bulk item events: %w", err)
+	}
+
+	go func() {
+		for range time.Tick(savedSearchReloadInterval) {
+			if err := s.reload(context.Background()); err != nil {
+				logger.Error("Failed to reload saved searches", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// List returns the user's saved searches, oldest first
+func (s *SavedSearchService) List(ctx context.Context, userID uint64) ([]models.SavedSearch, error) {
+	return s.DBService.GetSavedSearches(ctx, userID)
+}
+
+// Get returns one of the user's saved searches
+func (s *SavedSearchService) Get(ctx context.Context, userID uint64, id string) (*models.SavedSearch, error) {
+	search, err := s.DBService.GetSavedSearch(ctx, userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSavedSearchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch saved search: %w", err)
+	}
+	return &search, nil
+}
+
+// Create saves a new search for the user
+func (s *SavedSearchService) Create(ctx context.Context, userID uint64, request models.SavedSearchRequest) (*models.SavedSearch, error) {
+	if err := validateSavedSearch(ctx, request); err != nil {
+		return nil, err
+	}
+	searches, err := s.DBService.GetSavedSearches(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(searches) >= MaxSavedSearches {
+		return nil, ErrTooManySavedSearches
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate saved search ID: %w", err)
+	}
+	now := time.Now().UTC()
+	search := models.SavedSearch{
+		ID:         hex.EncodeToString(raw),
+		UserID:     userID,
+		Name:       request.Name,
+		Expression: request.Expression,
+		WebhookURL: request.WebhookURL,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.DBService.SaveSavedSearch(ctx, search); err != nil {
+		return nil, err
+	}
+	s.reloadLocal(ctx)
+	return &search, nil
+}
+
+// Update replaces the name, expression and webhook of one of the user's saved searches
+func (s *SavedSearchService) Update(ctx context.Context, userID uint64, id string, request models.SavedSearchRequest) (*models.SavedSearch, error) {
+	if err := validateSavedSearch(ctx, request); err != nil {
+		return nil, err
+	}
+	search, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	search.Name = request.Name
+	search.Expression = request.Expression
+	search.WebhookURL = request.WebhookURL
+	search.UpdatedAt = time.Now().UTC()
+	if err := s.DBService.SaveSavedSearch(ctx, *search); err != nil {
+		return nil, err
+	}
+	s.reloadLocal(ctx)
+	return search, nil
+}
+
+// Delete removes one of the user's saved searches
+func (s *SavedSearchService) Delete(ctx context.Context, userID uint64, id string) error {
+	search, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.DBService.DeleteSavedSearch(ctx, *search, time.Now().UTC()); err != nil {
+		return err
+	}
+	s.reloadLocal(ctx)
+	return nil
+}
+
+// validateSavedSearch checks the expression parses and the webhook is an HTTP URL
+// whose host resolves to public addresses only
+func validateSavedSearch(ctx context.Context, request models.SavedSearchRequest) error {
+	if _, err := models.ParseFilterExpr(request.Expression); err != nil {
+		return apperr.Validation(models.FieldError{
+			Field: "expression", Code: "invalid_expression", Message: err.Error(),
+		})
+	}
+	if request.WebhookURL != "" {
+		u, err := url.Parse(request.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidWebhookURL
+		}
+		if err := checkWebhookHost(ctx, u.Hostname()); err != nil {
+			return ErrWebhookNotAllowed
+		}
+	}
+	return nil
+}
+
+// reload replaces the in-memory searches with the saved ones
+func (s *SavedSearchService) reload(ctx context.Context) error {
+	searches, err := s.DBService.GetSavedSearches(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]compiledSearch, 0, len(searches))
+	for _, search := range searches {
+		expr, err := models.ParseFilterExpr(search.Expression)
+		if err != nil {
+			logger.WarnContext(ctx, "Skipping saved search with an invalid expression", "saved_search_id", search.ID, "error", err)
+			continue
+		}
+		compiled = append(compiled, compiledSearch{search: search, expr: expr})
+	}
+
+	s.mu.Lock()
+	s.searches = compiled
+	s.mu.Unlock()
+	return nil
+}
+
+// reloadLocal applies a change made through this instance right away
+func (s *SavedSearchService) reloadLocal(ctx context.Context) {
+	if err := s.reload(ctx); err != nil {
+		logger.ErrorContext(ctx, "Failed to reload saved searches", "error", err)
+	}
+}
+
+// matchItem delivers an item event to the saved searches it newly matches
+func (s *SavedSearchService) matchItem(ctx context.Context, item models.ItemResponse) {
+	if item.DeletedAt != nil {
+		return
+	}
+
+	s.mu.RLock()
+	searches := s.searches
+	s.mu.RUnlock()
+
+	for _, compiled := range searches {
+		if !item.UpdatedAt.After(compiled.search.UpdatedAt) || !compiled.expr.Match(item) {
+			continue
+		}
+		now := time.Now().UTC()
+		unlock := s.matches.Lock(fmt.Sprintf("%s/%d", compiled.search.ID, item.ID))
+		first, err := s.DBService.RecordSavedSearchMatch(ctx, compiled.search.ID, item.ID, now)
+		unlock()
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to record saved search match", "saved_search_id", compiled.search.ID, "item_id", item.ID, "error", err)
+			continue
+		}
+		if first {
+			s.deliver(ctx, compiled.search, models.SavedSearchMatch{
+				SearchID:   compiled.search.ID,
+				SearchName: compiled.search.Name,
+				UserID:     compiled.search.UserID,
+				Item:       item,
+				MatchedAt:  now,
+			})
+		}
+	}
+}
+
+// matchBulkItems matches the items created or updated by a bulk request
+func (s *SavedSearchService) matchBulkItems(ctx context.Context, event models.BulkItemEvent) {
+	items, err := s.DBService.GetItemsByIDs(ctx, append(event.Created, event.Updated...))
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to fetch bulk items for saved searches", "error", err)
+		return
+	}
+	for _, item := range items {
+		s.matchItem(ctx, item)
+	}
+}
+
+// deliver publishes a match to the user's subject and posts it to the webhook in
+// the background
+func (s *SavedSearchService) deliver(ctx context.Context, search models.SavedSearch, match models.SavedSearchMatch) {
+	if err := s.NATSService.PublishSavedSearchMatch(ctx, match); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish saved search match", "saved_search_id", search.ID, "item_id", match.Item.ID, "error", err)
+	}
+	if search.WebhookURL == "" {
+		return
+	}
+
+	go func() {
+		if err := s.postWebhook(ctx, search.WebhookURL, match); err != nil {
+			logger.WarnContext(ctx, "Failed to call saved search webhook", "saved_search_id", search.ID, "item_id", match.Item.ID, "error", err)
+		}
+	}()
+}
+
+// postWebhook posts a match to a webhook, passing on the trace context of the match
+func (s *SavedSearchService) postWebhook(ctx context.Context, webhookURL string, match models.SavedSearchMatch) error {
+	body, err := json.Marshal(match)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", response.Status)
+	}
+	return nil
+}
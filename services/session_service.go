@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+	"go-clickhouse-example/utils"
+)
+
+// touchInterval limits how often last-seen updates are written per session
+const touchInterval = time.Minute
+
+var (
+	ErrSessionNotFound = apperr.NotFound("session_not_found", "session not found")
+	ErrSessionRevoked  = apperr.Unauthorized("session_revoked", "session has been revoked or has expired")
+)
+
+// SessionService records login sessions and checks them on every request.
+// Sessions are cached in memory for CacheTTL so that most requests do not hit ClickHouse;
+// revocations made through this instance take effect immediately, revocations made
+// by other instances within CacheTTL.
+type SessionService struct {
+	DBService *DBService
+	CacheTTL  time.Duration
+
+	mu        sync.Mutex
+	cache     map[string]*cachedSession
+	lastSweep time.Time
+}
+
+type cachedSession struct {
+	session   models.Session
+	fetchedAt time.Time
+}
+
+// NewSessionService creates a new SessionService instance
+func NewSessionService(dbService *DBService, cacheTTL time.Duration) *SessionService {
+	return &SessionService{
+		DBService: dbService,
+		CacheTTL:  cacheTTL,
+		cache:     make(map[string]*cachedSession),
+	}
+}
+
+// Create starts a new session for the user
+func (s *SessionService) Create(ctx context.Context, userID uint64, ip, userAgent string) (*models.Session, error) {
+	return s.create(ctx, userID, describeDevice(userAgent), ip, userAgent, utils.AccessTokenTTL)
+}
+
+// CreateImpersonation starts a session for userID used by the admin actorID. It is
+// listed among the user's sessions so that the user can see and end it.
+func (s *SessionService) CreateImpersonation(ctx context.Context, userID, actorID uint64, ip, userAgent string, ttl time.Duration) (*models.Session, error) {
+	device := fmt.Sprintf("Impersonation by user %d (%s)", actorID, describeDevice(userAgent))
+	return s.create(ctx, userID, device, ip, userAgent, ttl)
+}
+
+func (s *SessionService) create(ctx context.Context, userID uint64, device, ip, userAgent string, ttl time.Duration) (*models.Session, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session := models.Session{
+		ID:         hex.EncodeToString(raw),
+		UserID:     userID,
+		Device:     device,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := s.DBService.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	s.store(session)
+	return &session, nil
+}
+
+// Validate checks that the session is still active and records the user's activity
+func (s *SessionService) Validate(ctx context.Context, userID uint64, sessionID, ip, userAgent string) error {
+	session, err := s.get(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Revoked || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+
+	// Write the last-seen time at most once per touchInterval. Revocations are stored
+	// apart from the session rows, so this cannot undo one made concurrently.
+	now := time.Now().UTC().Truncate(time.Second)
+	if now.Sub(session.LastSeenAt) >= touchInterval || session.IP != ip {
+		session.LastSeenAt = now
+		session.IP = ip
+		session.UserAgent = userAgent
+		s.store(session)
+		if err := s.DBService.SaveSession(ctx, session); err != nil {
+			logger.ErrorContext(ctx, "Failed to update session last seen time", "session_id", sessionID, "error", err)
+		}
+	}
+	return nil
+}
+
+// List returns the user's active sessions, marking the current one
+func (s *SessionService) List(ctx context.Context, userID uint64, currentSessionID string) ([]models.Session, error) {
+	sessions, err := s.DBService.GetActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke ends one of the user's sessions
+func (s *SessionService) Revoke(ctx context.Context, userID uint64, sessionID string) error {
+	session, err := s.DBService.GetSession(ctx, userID, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch session: %w", err)
+	}
+	if session.Revoked {
+		return ErrSessionNotFound
+	}
+
+	if err := s.DBService.RevokeSession(ctx, session); err != nil {
+		return err
+	}
+	session.Revoked = true
+	s.store(session)
+	return nil
+}
+
+// RevokeAll ends every session of the user
+func (s *SessionService) RevokeAll(ctx context.Context, userID uint64) error {
+	if err := s.DBService.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, cached := range s.cache {
+		if cached.session.UserID == userID {
+			delete(s.cache, id)
+		}
+	}
+	return nil
+}
+
+// get returns the session from the cache, loading it from ClickHouse when missing or stale
+func (s *SessionService) get(ctx context.Context, userID uint64, sessionID string) (models.Session, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[sessionID]
+	s.mu.Unlock()
+	if ok && cached.session.UserID == userID && time.Since(cached.fetchedAt) < s.CacheTTL {
+		return cached.session, nil
+	}
+	return s.load(ctx, userID, sessionID)
+}
+
+// load reads the session from ClickHouse and refreshes the cache
+func (s *SessionService) load(ctx context.Context, userID uint64, sessionID string) (models.Session, error) {
+	session, err := s.DBService.GetSession(ctx, userID, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return models.Session{}, fmt.Errorf("failed to fetch session: %w", err)
+	}
+
+	s.store(session)
+	return session, nil
+}
+
+func (s *SessionService) store(session models.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Periodically drop expired entries so the cache does not grow without bound
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= touchInterval {
+		for id, cached := range s.cache {
+			if now.After(cached.session.ExpiresAt) {
+				delete(s.cache, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.cache[session.ID] = &cachedSession{session: session, fetchedAt: now}
+}
+
+// describeDevice derives a short human readable description from a User-Agent header
+func describeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Windows", "Windows"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Android", "Android"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	}
+
+	browser := ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, sys := range systems {
+		if strings.Contains(userAgent, sys.token) {
+			system = sys.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
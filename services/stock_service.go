@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-clickhouse-example/apperr"
+	"go-clickhouse-example/models"
+)
+
+var (
+	ErrInsufficientStock = apperr.Conflict("insufficient_stock", "not enough stock for this movement")
+	ErrInvalidStockDelta = apperr.Validation(models.FieldError{
+		Field: "delta", Code: "invalid", Message: "delta has the wrong sign for this reason",
+	})
+)
+
+// StockStore is the storage used by StockService, implemented by DBService
+type StockStore interface {
+	GetItemByID(ctx context.Context, id uint64) (models.ItemResponse, error)
+	GetStockBalance(ctx context.Context, itemID uint64) (int64, error)
+	SaveStockMovement(ctx context.Context, movement models.StockMovement) error
+	GetStockMovements(ctx context.Context, itemID uint64, limit int) ([]models.StockMovement, error)
+}
+
+// StockPublisher publishes recorded movements, implemented by NATSService
+type StockPublisher interface {
+	PublishStockMovement(ctx context.Context, movement models.StockMovement) error
+}
+
+// StockService records stock movements in the append-only ledger.
+// Movements are serialized so that the negative stock check cannot race within this
+// instance; running several instances requires routing stock writes to one of them.
+type StockService struct {
+	Store     StockStore
+	Publisher StockPublisher
+
+	mu sync.Mutex
+}
+
+// NewStockService creates a new StockService instance
+func NewStockService(dbService *DBService, natsService *NATSService) *StockService {
+	return &StockService{Store: dbService, Publisher: natsService}
+}
+
+// Record appends a movement for the item and publishes it. Movements that would
+// make the stock negative are rejected with ErrInsufficientStock.
+func (s *StockService) Record(ctx context.Context, itemID uint64, req models.StockMovementRequest, actorID uint64) (*models.StockMovement, error) {
+	if !deltaMatchesReason(req.Delta, req.Reason) {
+		return nil, ErrInvalidStockDelta
+	}
+	if _, err := s.Store.GetItemByID(ctx, itemID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, err := s.Store.GetStockBalance(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if balance+req.Delta < 0 {
+		return nil, ErrInsufficientStock.WithMessage(fmt.Sprintf("not enough stock, %d available", balance))
+	}
+
+	movement := models.StockMovement{
+		ItemID:    itemID,
+		Delta:     req.Delta,
+		Reason:    req.Reason,
+		Reference: req.Reference,
+		ActorID:   actorID,
+		Timestamp: time.Now().UTC().Truncate(time.Millisecond),
+		Balance:   balance + req.Delta,
+	}
+	if err := s.Store.SaveStockMovement(ctx, movement); err != nil {
+		return nil, err
+	}
+
+	// The movement is recorded at this point, so a failed publish must not fail the request
+	if err := s.Publisher.PublishStockMovement(ctx, movement); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish stock movement", "item_id", itemID, "error", err)
+	}
+	return &movement, nil
+}
+
+// Level returns the current stock of the item
+func (s *StockService) Level(ctx context.Context, itemID uint64) (*models.StockLevel, error) {
+	if _, err := s.Store.GetItemByID(ctx, itemID); err != nil {
+		return nil, err
+	}
+	quantity, err := s.Store.GetStockBalance(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.StockLevel{ItemID: itemID, Quantity: quantity}, nil
+}
+
+// History returns the item's most recent movements, newest first
+func (s *StockService) History(ctx context.Context, itemID uint64, limit int) ([]models.StockMovement, error) {
+	if _, err := s.Store.GetItemByID(ctx, itemID); err != nil {
+		return nil, err
+	}
+	return s.Store.GetStockMovements(ctx, itemID, limit)
+}
+
+// deltaMatchesReason checks that receipts and returns add stock and sales remove it
+func deltaMatchesReason(delta int64, reason string) bool {
+	switch reason {
+	case models.StockReasonReceipt, models.StockReasonReturn:
+		return delta > 0
+	case models.StockReasonSale:
+		return delta < 0
+	default:
+		return delta != 0
+	}
+}
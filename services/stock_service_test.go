@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+// memStockStore is an in-memory StockStore for item 1. Reads pause briefly so that
+// unserialized movements would interleave.
+type memStockStore struct {
+	mu        sync.Mutex
+	balance   int64
+	movements []models.StockMovement
+}
+
+func (m *memStockStore) GetItemByID(ctx context.Context, id uint64) (models.ItemResponse, error) {
+	if id != 1 {
+		return models.ItemResponse{}, ErrItemNotFound
+	}
+	return models.ItemResponse{ID: id}, nil
+}
+
+func (m *memStockStore) GetStockBalance(ctx context.Context, itemID uint64) (int64, error) {
+	m.mu.Lock()
+	balance := m.balance
+	m.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	return balance, nil
+}
+
+func (m *memStockStore) SaveStockMovement(ctx context.Context, movement models.StockMovement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.balance += movement.Delta
+	m.movements = append(m.movements, movement)
+	return nil
+}
+
+func (m *memStockStore) GetStockMovements(ctx context.Context, itemID uint64, limit int) ([]models.StockMovement, error) {
+	return m.movements, nil
+}
+
+// nopStockPublisher discards the movements
+type nopStockPublisher struct{}
+
+func (nopStockPublisher) PublishStockMovement(ctx context.Context, movement models.StockMovement) error {
+	return nil
+}
+
+func TestStockServiceRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		itemID      uint64
+		balance     int64
+		delta       int64
+		reason      string
+		wantErr     error
+		wantBalance int64
+	}{
+		{"receipt", 1, 0, 5, models.StockReasonReceipt, nil, 5},
+		{"return", 1, 0, 1, models.StockReasonReturn, nil, 1},
+		{"sale", 1, 5, -2, models.StockReasonSale, nil, 3},
+		{"sale of the whole stock", 1, 5, -5, models.StockReasonSale, nil, 0},
+		{"sale beyond the stock", 1, 5, -6, models.StockReasonSale, ErrInsufficientStock, 5},
+		{"sale without stock", 1, 0, -1, models.StockReasonSale, ErrInsufficientStock, 0},
+		{"adjustment down", 1, 5, -5, models.StockReasonAdjustment, nil, 0},
+		{"adjustment below zero", 1, 5, -6, models.StockReasonAdjustment, ErrInsufficientStock, 5},
+		{"adjustment up", 1, 0, 3, models.StockReasonAdjustment, nil, 3},
+		{"negative receipt", 1, 5, -1, models.StockReasonReceipt, ErrInvalidStockDelta, 5},
+		{"negative return", 1, 5, -1, models.StockReasonReturn, ErrInvalidStockDelta, 5},
+		{"positive sale", 1, 5, 1, models.StockReasonSale, ErrInvalidStockDelta, 5},
+		{"zero adjustment", 1, 5, 0, models.StockReasonAdjustment, ErrInvalidStockDelta, 5},
+		{"missing item", 2, 0, 5, models.StockReasonReceipt, ErrItemNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memStockStore{balance: tt.balance}
+			service := &StockService{Store: store, Publisher: nopStockPublisher{}}
+
+			movement, err := service.Record(context.Background(), tt.itemID,
+				models.StockMovementRequest{Delta: tt.delta, Reason: tt.reason}, 7)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Record(%d %s) error = %v, want %v", tt.delta, tt.reason, err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Record(%d %s): %v", tt.delta, tt.reason, err)
+			} else if movement.Balance != tt.wantBalance {
+				t.Errorf("Record(%d %s) balance = %d, want %d", tt.delta, tt.reason, movement.Balance, tt.wantBalance)
+			}
+			if store.balance != tt.wantBalance {
+				t.Errorf("stored balance = %d, want %d", store.balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestStockServiceRecordConcurrentSales(t *testing.T) {
+	const stock, attempts = 5, 20
+	store := &memStockStore{balance: stock}
+	service := &StockService{Store: store, Publisher: nopStockPublisher{}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.Record(context.Background(), 1,
+				models.StockMovementRequest{Delta: -1, Reason: models.StockReasonSale}, 7)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	sold := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			sold++
+		case !errors.Is(err, ErrInsufficientStock):
+			t.Errorf("Record() error = %v, want nil or %v", err, ErrInsufficientStock)
+		}
+	}
+	if sold != stock || store.balance != 0 {
+		t.Errorf("sold %d with balance %d left, want %d sold and none left", sold, store.balance, stock)
+	}
+}
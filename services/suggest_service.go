@@ -0,0 +1,306 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go-clickhouse-example/models"
+)
+
+const (
+	// MaxSuggestions is the most suggestions returned for a prefix, and the number
+	// of best items cached by each trie node
+	MaxSuggestions = 20
+	// suggestKeyRunes bounds the depth, and so the size, of the trie. Longer
+	// prefixes are looked up on their first suggestKeyRunes runes and the best
+	// items found are then checked against the whole prefix, so they may get
+	// fewer suggestions than there are matches.
+	suggestKeyRunes = 24
+)
+
+// SuggestService suggests item names for a prefix typed into a search box. Names
+// are held in memory in a trie, keyed by every suffix of the lowercase name that
+// starts a word, so that "run" suggests "Red running shoes". Each node caches the
+// most popular items below it, recomputed lazily after changes. Popularity is the
+// number of units sold. The trie is loaded from ClickHouse at startup and kept up
+// to date from the item, bulk and stock events of the NATS stream.
+type SuggestService struct {
+	DBService   *DBService
+	NATSService *NATSService
+
+	mu    sync.Mutex
+	root  *suggestNode
+	items map[uint64]*suggestItem
+}
+
+type suggestItem struct {
+	name       string
+	popularity int64
+}
+
+type suggestNode struct {
+	children map[rune]*suggestNode
+	// items holds the items with a key ending at this node
+	items []uint64
+	// best caches the most popular items of the subtree, unless dirty
+	best  []uint64
+	dirty bool
+}
+
+// NewSuggestService creates a new SuggestService instance
+func NewSuggestService(dbService *DBService, natsService *NATSService) *SuggestService {
+	return &SuggestService{
+		DBService:   dbService,
+		NATSService: natsService,
+		root:        &suggestNode{},
+		items:       make(map[uint64]*suggestItem),
+	}
+}
+
+// Start loads the item names and units sold from ClickHouse and subscribes to the
+// item events. Events published since the load started are replayed, so that no
+// change is missed while loading.
+func (s *SuggestService) Start() error {
+	ctx := context.Background()
+	start := time.Now()
+
+	sold, err := s.DBService.GetItemUnitsSold(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	err = s.DBService.GetItemNames(ctx, func(id uint64, name string) {
+		s.put(id, name, sold[id])
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.NATSService.SubscribeItemsSince(start, s.applyItem); err != nil {
+		return fmt.Errorf("failed to subscribe to item events: %w", err)
+	}
+	if err := s.NATSService.SubscribeBulkItemsSince(start, s.applyBulkItems); err != nil {
+		return fmt.Errorf("failed to subscribe to bulk item events: %w", err)
+	}
+	if err := s.NATSService.SubscribeStockMovementsSince(start, s.applyStockMovement); err != nil {
+		return fmt.Errorf("failed to subscribe to stock movements: %w", err)
+	}
+	return nil
+}
+
+// Suggest returns up to limit items whose name has a word starting with the prefix,
+// most popular first
+func (s *SuggestService) Suggest(prefix string, limit int) []models.Suggestion {
+	suggestions := []models.Suggestion{}
+	prefix = suggestKey(prefix)
+	key := []rune(prefix)
+	if len(key) == 0 {
+		return suggestions
+	}
+	truncated := len(key) > suggestKeyRunes
+	if truncated {
+		key = key[:suggestKeyRunes]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node := s.root
+	for _, r := range key {
+		if node = node.children[r]; node == nil {
+			return suggestions
+		}
+	}
+	for _, id := range s.best(node) {
+		if len(suggestions) == limit {
+			break
+		}
+		item := s.items[id]
+		if truncated && !hasWordPrefix(item.name, prefix) {
+			continue
+		}
+		suggestions = append(suggestions, models.Suggestion{ID: id, Name: item.name, Popularity: item.popularity})
+	}
+	return suggestions
+}
+
+// applyItem updates the trie with an item event
+func (s *SuggestService) applyItem(_ context.Context, item models.ItemResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item.DeletedAt != nil {
+		s.remove(item.ID)
+		return
+	}
+	popularity := int64(0)
+	if current, ok := s.items[item.ID]; ok {
+		// Only a new name changes the keys of the item
+		if current.name == item.Name {
+			return
+		}
+		popularity = current.popularity
+	}
+	s.put(item.ID, item.Name, popularity)
+}
+
+// applyBulkItems updates the trie with the items changed by a bulk request
+func (s *SuggestService) applyBulkItems(ctx context.Context, event models.BulkItemEvent) {
+	items, err := s.DBService.GetItemsByIDs(ctx, append(event.Created, event.Updated...))
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to fetch bulk items for suggestions", "error", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range event.Deleted {
+		s.remove(id)
+	}
+	for _, item := range items {
+		popularity := int64(0)
+		if current, ok := s.items[item.ID]; ok {
+			popularity = current.popularity
+		}
+		s.put(item.ID, item.Name, popularity)
+	}
+}
+
+// applyStockMovement counts sales and returns into the item's popularity
+func (s *SuggestService) applyStockMovement(_ context.Context, movement models.StockMovement) {
+	if movement.Reason != models.StockReasonSale && movement.Reason != models.StockReasonReturn {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item, ok := s.items[movement.ItemID]; ok {
+		s.put(movement.ItemID, item.name, item.popularity-movement.Delta)
+	}
+}
+
+// put adds or replaces an item. The caller must hold mu.
+func (s *SuggestService) put(id uint64, name string, popularity int64) {
+	s.remove(id)
+	s.items[id] = &suggestItem{name: name, popularity: popularity}
+	for _, key := range suggestKeys(name, suggestKeyRunes) {
+		node := s.root
+		node.dirty = true
+		for _, r := range key {
+			child := node.children[r]
+			if child == nil {
+				if node.children == nil {
+					node.children = make(map[rune]*suggestNode)
+				}
+				child = &suggestNode{}
+				node.children[r] = child
+			}
+			node = child
+			node.dirty = true
+		}
+		if !slices.Contains(node.items, id) {
+			node.items = append(node.items, id)
+		}
+	}
+}
+
+// remove drops an item, pruning the nodes left empty. The caller must hold mu.
+func (s *SuggestService) remove(id uint64) {
+	item, ok := s.items[id]
+	if !ok {
+		return
+	}
+	delete(s.items, id)
+
+	for _, key := range suggestKeys(item.name, suggestKeyRunes) {
+		path := []*suggestNode{s.root}
+		for _, r := range key {
+			path = append(path, path[len(path)-1].children[r])
+		}
+		last := path[len(path)-1]
+		last.items = slices.DeleteFunc(last.items, func(other uint64) bool { return other == id })
+		for i := len(path) - 1; i >= 0; i-- {
+			path[i].dirty = true
+			if i > 0 && len(path[i].items) == 0 && len(path[i].children) == 0 {
+				delete(path[i-1].children, key[i-1])
+			}
+		}
+	}
+}
+
+// best returns the most popular items of the node's subtree, recomputing them from
+// the children's if the subtree changed. The caller must hold mu.
+func (s *SuggestService) best(node *suggestNode) []uint64 {
+	if !node.dirty {
+		return node.best
+	}
+
+	candidates := slices.Clone(node.items)
+	for _, child := range node.children {
+		candidates = append(candidates, s.best(child)...)
+	}
+	slices.SortFunc(candidates, func(a, b uint64) int {
+		x, y := s.items[a], s.items[b]
+		return cmp.Or(cmp.Compare(y.popularity, x.popularity), cmp.Compare(x.name, y.name), cmp.Compare(a, b))
+	})
+	// An item appears once per word of its name matching the prefix
+	candidates = slices.Compact(candidates)
+	if len(candidates) > MaxSuggestions {
+		candidates = candidates[:MaxSuggestions]
+	}
+
+	node.best = candidates
+	node.dirty = false
+	return node.best
+}
+
+// suggestKey normalizes text the way names are keyed
+func suggestKey(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// suggestKeys returns the keys of a name: its normalized suffixes starting at each
+// word, cut to maxRunes runes
+func suggestKeys(name string, maxRunes int) [][]rune {
+	normalized := []rune(suggestKey(name))
+	var keys [][]rune
+	for i, r := range normalized {
+		if !isWordStart(normalized, i, r) {
+			continue
+		}
+		key := normalized[i:]
+		if len(key) > maxRunes {
+			key = key[:maxRunes]
+		}
+		if !slices.ContainsFunc(keys, func(other []rune) bool { return slices.Equal(other, key) }) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// hasWordPrefix reports whether one of the words of name starts with the
+// normalized prefix, including the words following it
+func hasWordPrefix(name, prefix string) bool {
+	normalized := []rune(suggestKey(name))
+	for i, r := range normalized {
+		if isWordStart(normalized, i, r) && strings.HasPrefix(string(normalized[i:]), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWordStart reports whether the rune r at index i of text starts a word
+func isWordStart(text []rune, i int, r rune) bool {
+	if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+		return false
+	}
+	return i == 0 || (!unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]))
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+func newTestSuggestService(items map[uint64]suggestItem) *SuggestService {
+	s := &SuggestService{root: &suggestNode{}, items: make(map[uint64]*suggestItem)}
+	for id, item := range items {
+		s.put(id, item.name, item.popularity)
+	}
+	return s
+}
+
+// suggestionIDs returns the IDs of the suggestions in order
+func suggestionIDs(suggestions []models.Suggestion) []uint64 {
+	ids := []uint64{}
+	for _, suggestion := range suggestions {
+		ids = append(ids, suggestion.ID)
+	}
+	return ids
+}
+
+func TestSuggest(t *testing.T) {
+	s := newTestSuggestService(map[uint64]suggestItem{
+		1:  {"Red running shoes", 50},
+		2:  {"Running socks", 80},
+		3:  {"Runner's guide", 10},
+		4:  {"Blue shoes", 50},
+		5:  {"Run", 50},
+		6:  {"trail-running pack", 5},
+		7:  {"Shoe rack", 0},
+		8:  {"Extraordinarily comfortable walking boots", 0},
+		9:  {"Extraordinarily comfortable wading boots", 1},
+		10: {"Run run run", 1},
+	})
+
+	tests := []struct {
+		name   string
+		prefix string
+		limit  int
+		want   []uint64
+	}{
+		// most popular first, then by name, each item once
+		{"word prefix anywhere in the name", "run", 20, []uint64{2, 1, 5, 3, 6, 10}},
+		{"case and spaces are ignored", "  RUN ", 20, []uint64{2, 1, 5, 3, 6, 10}},
+		{"equal popularity by name", "shoe", 20, []uint64{4, 1, 7}},
+		{"prefix across words", "running s", 20, []uint64{2, 1}},
+		{"repeated spaces", "red   running", 20, []uint64{1}},
+		{"limit", "run", 2, []uint64{2, 1}},
+		{"middle of a word", "unning", 20, []uint64{}},
+		{"no match", "xyz", 20, []uint64{}},
+		{"empty prefix", " ", 20, []uint64{}},
+		{"prefix longer than the keys", "extraordinarily comfortable walking", 20, []uint64{8}},
+		{"prefix as long as the keys", "extraordinarily comforta", 20, []uint64{9, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestionIDs(s.Suggest(tt.prefix, tt.limit)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest(%q, %d) = %v, want %v", tt.prefix, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestFollowsChanges(t *testing.T) {
+	s := newTestSuggestService(map[uint64]suggestItem{
+		1: {"Red running shoes", 50},
+		2: {"Running socks", 80},
+		3: {"Runner's guide", 10},
+	})
+	ctx := context.Background()
+	deletedAt := time.Now()
+
+	tests := []struct {
+		name   string
+		change func()
+		want   []uint64
+	}{
+		{"initial ranking", func() {}, []uint64{2, 1, 3}},
+		{"sales raise the popularity", func() {
+			s.applyStockMovement(ctx, models.StockMovement{ItemID: 3, Delta: -100, Reason: models.StockReasonSale})
+		}, []uint64{3, 2, 1}},
+		{"returns lower it", func() {
+			s.applyStockMovement(ctx, models.StockMovement{ItemID: 3, Delta: 60, Reason: models.StockReasonReturn})
+		}, []uint64{2, 1, 3}},
+		{"receipts are ignored", func() {
+			s.applyStockMovement(ctx, models.StockMovement{ItemID: 1, Delta: 500, Reason: models.StockReasonReceipt})
+		}, []uint64{2, 1, 3}},
+		{"a renamed item keeps its popularity", func() {
+			s.applyItem(ctx, models.ItemResponse{ID: 2, Name: "Wool socks"})
+		}, []uint64{1, 3}},
+		{"a new item is added", func() {
+			s.applyItem(ctx, models.ItemResponse{ID: 4, Name: "Runway lights"})
+		}, []uint64{1, 3, 4}},
+		{"a deleted item is removed", func() {
+			s.applyItem(ctx, models.ItemResponse{ID: 1, Name: "Red running shoes", DeletedAt: &deletedAt})
+		}, []uint64{3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			if got := suggestionIDs(s.Suggest("run", MaxSuggestions)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest(\"run\") = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := suggestionIDs(s.Suggest("wool", MaxSuggestions)); !reflect.DeepEqual(got, []uint64{2}) {
+		t.Errorf("Suggest(\"wool\") = %v, want [2]", got)
+	}
+	if node := s.root.children['r'].children['e']; node != nil {
+		t.Errorf("trie kept the \"re\" node of the deleted item")
+	}
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// TrashPurger permanently removes items that have been in the trash for longer than Retention
+type TrashPurger struct {
+	DBService *DBService
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// NewTrashPurger creates a new TrashPurger instance
+func NewTrashPurger(dbService *DBService, retention, interval time.Duration) *TrashPurger {
+	return &TrashPurger{DBService: dbService, Retention: retention, Interval: interval}
+}
+
+// Start purges the trash in the background, once right away and then every Interval
+func (p *TrashPurger) Start() {
+	go func() {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+		for {
+			p.Purge(context.Background())
+			<-ticker.C
+		}
+	}()
+}
+
+// Purge removes the items deleted more than Retention ago
+func (p *TrashPurger) Purge(ctx context.Context) {
+	if err := p.DBService.PurgeTrashedItems(ctx, time.Now().UTC().Add(-p.Retention)); err != nil {
+		logger.ErrorContext(ctx, "Failed to purge item trash", "error", err)
+	}
+}
@@ -2,8 +2,13 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"go-clickhouse-example/models"
+	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -12,15 +17,211 @@ import (
 // Secret key for signing the JWT token (in a real app, use environment variables or a secure vault)
 var secretKey = []byte("test_secret_key")
 
-// GenerateJWT generates a JWT token for the authenticated user
-func GenerateJWT(user *models.UserResponse) (string, error) {
+// Token types carried in the "typ" claim
+const (
+	TokenTypeAccess       = "access"
+	TokenTypeMFAChallenge = "mfa_challenge"
+
+	// Single-use tokens sent by email
+	TokenTypePasswordReset     = "password_reset"
+	TokenTypeEmailVerification = "email_verification"
+)
+
+// Authentication method references carried in the "amr" claim (RFC 8176)
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+)
+
+// AccessTokenTTL is the lifetime of access tokens and of the sessions they belong to
+const AccessTokenTTL = 24 * time.Hour
+
+// mfaChallengeTTL is how long a user has to complete the second login step
+const mfaChallengeTTL = 5 * time.Minute
+
+// TokenClaims holds the application claims extracted from a validated token
+type TokenClaims struct {
+	UserID    uint64
+	Role      string
+	AMR       []string
+	SessionID string
+	// ActorID is the admin acting on behalf of UserID when impersonating, otherwise 0
+	ActorID uint64
+}
+
+// IsImpersonated reports whether the token was issued to an admin impersonating the user
+func (c *TokenClaims) IsImpersonated() bool {
+	return c.ActorID != 0
+}
+
+// HasAMR reports whether the token was issued after the given authentication method
+func (c *TokenClaims) HasAMR(method string) bool {
+	return ContainsAMR(c.AMR, method)
+}
+
+// ContainsAMR reports whether method is present in the list of authentication methods
+func ContainsAMR(amr []string, method string) bool {
+	for _, m := range amr {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateJWT generates a JWT token for the authenticated user within the given session.
+// amr lists the authentication methods the user completed, e.g. "pwd" and "otp".
+func GenerateJWT(user *models.UserResponse, sessionID string, amr ...string) (string, error) {
+	if len(amr) == 0 {
+		amr = []string{AMRPassword}
+	}
+
 	// Define the token claims with a Unix timestamp for expiration
 	claims := jwt.MapClaims{
+		"sub":     strconv.FormatUint(user.ID, 10),
+		"user_id": user.ID,
+		"role":    user.Role,
+		"typ":     TokenTypeAccess,
+		"amr":     amr,
+		"sid":     sessionID,
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(), // Token expires in 24 hours (Unix timestamp)
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateImpersonationJWT generates a short-lived access token for user on behalf of
+// the admin actorID. The actor is carried in the "act" claim (RFC 8693).
+func GenerateImpersonationJWT(user *models.UserResponse, actorID uint64, sessionID string, amr []string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     strconv.FormatUint(user.ID, 10),
+		"act":     map[string]string{"sub": strconv.FormatUint(actorID, 10)},
 		"user_id": user.ID,
 		"role":    user.Role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours (Unix timestamp)
+		"typ":     TokenTypeAccess,
+		"amr":     amr,
+		"sid":     sessionID,
+		"exp":     time.Now().Add(ttl).Unix(),
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateMFAChallenge generates a short-lived token proving that the user passed
+// the password step. It can only be exchanged for an access token at /login/mfa,
+// once: its "jti" is consumed when the exchange succeeds.
+func GenerateMFAChallenge(user *models.UserResponse) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":     jti,
+		"user_id": user.ID,
+		"typ":     TokenTypeMFAChallenge,
+		"exp":     time.Now().Add(mfaChallengeTTL).Unix(),
+	}
+
+	return signClaims(claims)
+}
+
+// MFAChallengeClaims holds the claims of an MFA challenge token
+type MFAChallengeClaims struct {
+	// ID is the unique token ID ("jti") used to enforce single use
+	ID        string
+	UserID    uint64
+	ExpiresAt time.Time
+}
+
+// ActionClaims holds the claims of a single-use token sent by email
+type ActionClaims struct {
+	// ID is the unique token ID ("jti") used to enforce single use
+	ID        string
+	UserID    uint64
+	Email     string
+	ExpiresAt time.Time
+	// PasswordFingerprint identifies the password the user had when the token was issued
+	PasswordFingerprint string
+}
+
+// IssuedFor reports whether the token was issued for the user's current email and
+// password, so that changing either invalidates the tokens sent before
+func (c *ActionClaims) IssuedFor(user *models.UserResponse) bool {
+	return c.UserID == user.ID && c.Email == user.Email &&
+		hmac.Equal([]byte(c.PasswordFingerprint), []byte(passwordFingerprint(user.Password)))
+}
+
+// GenerateActionToken generates a signed single-use token of the given type
+// (TokenTypePasswordReset or TokenTypeEmailVerification) bound to the user's email
+// and password.
+func GenerateActionToken(tokenType string, user *models.UserResponse, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":     jti,
+		"user_id": user.ID,
+		"email":   user.Email,
+		"pwd":     passwordFingerprint(user.Password),
+		"typ":     tokenType,
+		"exp":     time.Now().Add(ttl).Unix(),
 	}
 
+	return signClaims(claims)
+}
+
+// ParseActionToken validates a single-use token of the given type. Checking that
+// the token has not been used yet is up to the caller.
+func ParseActionToken(tokenType, tokenString string) (*ActionClaims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, fmt.Errorf("unexpected token type %q", typ)
+	}
+
+	jti, _ := claims["jti"].(string)
+	email, _ := claims["email"].(string)
+	fingerprint, _ := claims["pwd"].(string)
+	userID, ok := claims["user_id"].(float64)
+	if !ok || jti == "" {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	return &ActionClaims{
+		ID:        jti,
+		UserID:    uint64(userID),
+		Email:     email,
+		ExpiresAt: time.Unix(int64(claims["exp"].(float64)), 0),
+
+		PasswordFingerprint: fingerprint,
+	}, nil
+}
+
+// passwordFingerprint derives a short value from a password hash that changes with
+// the password. It is keyed, so that tokens do not reveal anything about the hash.
+func passwordFingerprint(passwordHash string) string {
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte("password:" + passwordHash))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// newTokenID generates a random token ID for the "jti" claim
+func newTokenID() (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("could not generate token ID: %v", err)
+	}
+	return hex.EncodeToString(jti), nil
+}
+
+// signClaims signs the given claims with the secret key
+func signClaims(claims jwt.MapClaims) (string, error) {
 	// Create a new token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -33,11 +234,75 @@ func GenerateJWT(user *models.UserResponse) (string, error) {
 	return tokenString, nil
 }
 
-// ParseJWT parses and validates the JWT token
-func ParseJWT(tokenString string) (*models.User, error) {
-	// Print the raw token to inspect its parts
-	fmt.Println("Token:", tokenString)
+// ParseJWT parses and validates an access token
+func ParseJWT(tokenString string) (*TokenClaims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued before the "typ" claim existed are access tokens
+	if typ, ok := claims["typ"].(string); ok && typ != TokenTypeAccess {
+		return nil, fmt.Errorf("unexpected token type %q", typ)
+	}
+
+	role, ok := claims["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid 'role' claim in token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid 'user_id' claim in token")
+	}
+
+	// Return the user information from the claims
+	result := &TokenClaims{
+		UserID: uint64(userID),
+		Role:   role,
+		AMR:    stringSliceClaim(claims["amr"]),
+	}
+	result.SessionID, _ = claims["sid"].(string)
+
+	// An "act" claim means the token was issued for impersonation
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		actorSub, _ := act["sub"].(string)
+		actorID, err := strconv.ParseUint(actorSub, 10, 64)
+		if err != nil || actorID == 0 {
+			return nil, fmt.Errorf("invalid 'act' claim in token")
+		}
+		result.ActorID = actorID
+	}
+	return result, nil
+}
+
+// ParseMFAChallenge validates an MFA challenge token. Checking that the token has
+// not been used yet is up to the caller.
+func ParseMFAChallenge(tokenString string) (*MFAChallengeClaims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != TokenTypeMFAChallenge {
+		return nil, fmt.Errorf("not an MFA challenge token")
+	}
+
+	jti, _ := claims["jti"].(string)
+	userID, ok := claims["user_id"].(float64)
+	if !ok || jti == "" {
+		return nil, fmt.Errorf("invalid token claims")
+	}
 
+	return &MFAChallengeClaims{
+		ID:        jti,
+		UserID:    uint64(userID),
+		ExpiresAt: time.Unix(int64(claims["exp"].(float64)), 0),
+	}, nil
+}
+
+// parseClaims verifies the token signature and expiration and returns its claims
+func parseClaims(tokenString string) (jwt.MapClaims, error) {
 	// Parse the token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Ensure the token's signing method is HMAC
@@ -52,29 +317,37 @@ func ParseJWT(tokenString string) (*models.User, error) {
 	}
 
 	// Extract claims from the token
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Print the claims to check their structure
-		fmt.Println("Claims:", claims)
-
-		// Decode the expiration time (Unix timestamp)
-		exp, ok := claims["exp"].(float64)
-		if !ok {
-			return nil, fmt.Errorf("invalid 'exp' claim in token")
-		}
-		expirationTime := time.Unix(int64(exp), 0)
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
 
-		// Check if the token has expired
-		if time.Now().After(expirationTime) {
-			return nil, fmt.Errorf("token is expired")
-		}
+	// Decode the expiration time (Unix timestamp)
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid 'exp' claim in token")
+	}
+	expirationTime := time.Unix(int64(exp), 0)
 
-		// Return the user information from the claims
-		user := &models.User{
-			ID:   uint64(claims["user_id"].(float64)),
-			Role: claims["role"].(string),
-		}
-		return user, nil
+	// Check if the token has expired
+	if time.Now().After(expirationTime) {
+		return nil, fmt.Errorf("token is expired")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	return claims, nil
+}
+
+// stringSliceClaim converts a JSON array claim into a string slice
+func stringSliceClaim(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
 }
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"go-clickhouse-example/models"
+)
+
+func TestActionTokenIssuedFor(t *testing.T) {
+	user := models.UserResponse{ID: 7, Email: "alice@example.com", Password: "$2a$10$old"}
+	token, err := GenerateActionToken(TokenTypePasswordReset, &user, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+	claims, err := ParseActionToken(TokenTypePasswordReset, token)
+	if err != nil {
+		t.Fatalf("ParseActionToken: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		user models.UserResponse
+		want bool
+	}{
+		{"same user", user, true},
+		{"password changed", models.UserResponse{ID: 7, Email: "alice@example.com", Password: "$2a$10$new"}, false},
+		{"email changed", models.UserResponse{ID: 7, Email: "alice@example.org", Password: "$2a$10$old"}, false},
+		{"other user", models.UserResponse{ID: 8, Email: "alice@example.com", Password: "$2a$10$old"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claims.IssuedFor(&tt.user); got != tt.want {
+				t.Errorf("IssuedFor(%+v) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseActionToken(t *testing.T) {
+	user := models.UserResponse{ID: 7, Email: "alice@example.com", Password: "hash"}
+	reset, err := GenerateActionToken(TokenTypePasswordReset, &user, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+	expired, err := GenerateActionToken(TokenTypePasswordReset, &user, -time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		tokenType string
+		token     string
+		wantErr   bool
+	}{
+		{"valid", TokenTypePasswordReset, reset, false},
+		{"other type", TokenTypeEmailVerification, reset, true},
+		{"expired", TokenTypePasswordReset, expired, true},
+		{"tampered", TokenTypePasswordReset, reset + "x", true},
+		{"garbage", TokenTypePasswordReset, "not-a-token", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseActionToken(tt.tokenType, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseActionToken() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.UserID != user.ID || claims.Email != user.Email || claims.ID == "") {
+				t.Errorf("ParseActionToken() = %+v, want the claims of user %d", claims, user.ID)
+			}
+		})
+	}
+}
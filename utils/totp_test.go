@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key of RFC 6238, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 gives 07081804 for time 1111111109, the code of step 37037036
+	const code = "081804"
+	const step = 37037036
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       int64
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, code, 1111111109, 0, step, true},
+		{"start of the step", rfc6238Secret, code, step * totpPeriod, 0, step, true},
+		{"end of the step", rfc6238Secret, code, (step+1)*totpPeriod - 1, 0, step, true},
+		{"one step later", rfc6238Secret, code, (step + 1) * totpPeriod, 0, step, true},
+		{"end of one step later", rfc6238Secret, code, (step+2)*totpPeriod - 1, 0, step, true},
+		{"two steps later", rfc6238Secret, code, (step + 2) * totpPeriod, 0, 0, false},
+		{"one step earlier", rfc6238Secret, code, (step - 1) * totpPeriod, 0, step, true},
+		{"two steps earlier", rfc6238Secret, code, step*totpPeriod - totpPeriod - 1, 0, 0, false},
+		{"other RFC vector", rfc6238Secret, "279037", 2000000000, 0, 2000000000 / totpPeriod, true},
+		{"wrong code", rfc6238Secret, "081805", 1111111109, 0, 0, false},
+		{"surrounding spaces", rfc6238Secret, " 081804 ", 1111111109, 0, step, true},
+		{"lowercase padded secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", code, 1111111109, 0, step, true},
+		{"too short", rfc6238Secret, "08180", 1111111109, 0, 0, false},
+		{"too long", rfc6238Secret, "0818040", 1111111109, 0, 0, false},
+		{"invalid secret", "not base32!", code, 1111111109, 0, 0, false},
+
+		// a code is accepted only for steps after the last accepted one
+		{"after last step", rfc6238Secret, code, 1111111109, step - 1, step, true},
+		{"at last step", rfc6238Secret, code, 1111111109, step, 0, false},
+		{"before last step", rfc6238Secret, code, 1111111109, step + 1, 0, false},
+		{"reused one step later", rfc6238Secret, code, (step + 1) * totpPeriod, step, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.at, 0), tt.lastStep)
+			if gotStep != tt.wantStep || gotOK != tt.wantOK {
+				t.Errorf("ValidateTOTP(%q, %q, %d, %d) = (%d, %v), want (%d, %v)",
+					tt.secret, tt.code, tt.at, tt.lastStep, gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPGeneratedSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding generated secret: %v", err)
+	}
+
+	at := time.Now()
+	counter := at.Unix() / totpPeriod
+	step, ok := ValidateTOTP(secret, totpCode(key, uint64(counter)), at, 0)
+	if !ok || step != counter {
+		t.Fatalf("ValidateTOTP of the current code = (%d, %v), want (%d, true)", step, ok, counter)
+	}
+	// Storing the returned step makes the same code fail
+	if _, ok := ValidateTOTP(secret, totpCode(key, uint64(counter)), at, step); ok {
+		t.Errorf("ValidateTOTP accepted a code at or below lastStep %d", step)
+	}
+}
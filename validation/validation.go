@@ -0,0 +1,173 @@
+// Package validation registers the custom rules used in the binding tags of the
+// request models and translates validation failures into field errors.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go-clickhouse-example/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+)
+
+// usernamePattern allows letters, digits, dots, dashes and underscores
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// Register installs the custom rules and types on gin's validator. It must be called
+// once before the router serves requests.
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected validator engine")
+	}
+
+	// Report fields by their JSON names
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	// Decimal amounts are compared as numbers by rules such as gte and lt
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		switch value := field.Interface().(type) {
+		case models.Money:
+			return value.InexactFloat64()
+		case decimal.Decimal:
+			return value.InexactFloat64()
+		}
+		return nil
+	}, models.Money{}, decimal.Decimal{})
+
+	return v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+}
+
+// Struct runs the binding rules of obj outside of a request and returns its invalid
+// fields, or nil if it is valid
+func Struct(obj interface{}) []models.FieldError {
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		if fields := FieldErrors(err); fields != nil {
+			return fields
+		}
+		return []models.FieldError{{Field: "", Code: "invalid", Message: err.Error()}}
+	}
+	return nil
+}
+
+// FieldErrors converts the error returned by binding into field errors. It returns
+// nil if err is not a validation error, e.g. when the body is not valid JSON.
+func FieldErrors(err error) []models.FieldError {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	fields := make([]models.FieldError, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, models.FieldError{
+			Field:   fieldPath(fe),
+			Code:    code(fe),
+			Message: message(fe),
+		})
+	}
+	return fields
+}
+
+// fieldPath returns the JSON path of the field without the struct name, e.g. "tags[2]"
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fe.Field()
+}
+
+// isLength reports whether min/max style rules apply to a length rather than a value
+func isLength(fe validator.FieldError) bool {
+	switch fe.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// code returns the machine-readable code for a failed rule
+func code(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "required"
+	case "min", "gte", "gt":
+		if isLength(fe) {
+			return "too_short"
+		}
+		return "too_small"
+	case "max", "lte", "lt":
+		if isLength(fe) {
+			return "too_long"
+		}
+		return "too_large"
+	case "len":
+		return "invalid_length"
+	case "email":
+		return "invalid_email"
+	case "username":
+		return "invalid_characters"
+	case "oneof":
+		return "invalid_choice"
+	default:
+		return "invalid"
+	}
+}
+
+// message returns a human readable description of a failed rule
+func message(fe validator.FieldError) string {
+	field := fieldPath(fe)
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	} else if isLength(fe) {
+		unit = " entries"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "min", "gte":
+		if isLength(fe) {
+			return fmt.Sprintf("%s must have at least %s%s", field, fe.Param(), unit)
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "max", "lte":
+		if isLength(fe) {
+			return fmt.Sprintf("%s must have at most %s%s", field, fe.Param(), unit)
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must have exactly %s%s", field, fe.Param(), unit)
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", field)
+	case "username":
+		return fmt.Sprintf("%s may only contain letters, digits, '.', '-' and '_'", field)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid", field)
+	}
+}
@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-clickhouse-example/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMain(m *testing.M) {
+	if err := Register(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func mustMoney(t *testing.T, value string) models.Money {
+	t.Helper()
+	m, err := models.NewMoney(value)
+	if err != nil {
+		t.Fatalf("NewMoney(%q): %v", value, err)
+	}
+	return m
+}
+
+func TestStruct(t *testing.T) {
+	item := func(edit func(*models.ItemRequest)) *models.ItemRequest {
+		req := &models.ItemRequest{Name: "Widget", Tags: []string{"a"}, Price: mustMoney(t, "19.99")}
+		edit(req)
+		return req
+	}
+	user := func(edit func(*models.UserRequest)) *models.UserRequest {
+		req := &models.UserRequest{Username: "alice", Password: "correct-horse"}
+		edit(req)
+		return req
+	}
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		want []models.FieldError
+	}{
+		{"valid item", item(func(r *models.ItemRequest) {}), nil},
+		{"valid user", user(func(r *models.UserRequest) {}), nil},
+		{"required", item(func(r *models.ItemRequest) { r.Name = "" }),
+			[]models.FieldError{{Field: "name", Code: "required", Message: "name is required"}}},
+		{"string too long", item(func(r *models.ItemRequest) { r.SKU = strings.Repeat("x", 65) }),
+			[]models.FieldError{{Field: "sku", Code: "too_long", Message: "sku must have at most 64 characters"}}},
+		{"string too short", user(func(r *models.UserRequest) { r.Password = "short" }),
+			[]models.FieldError{{Field: "password", Code: "too_short", Message: "password must have at least 8 characters"}}},
+		{"too many entries", item(func(r *models.ItemRequest) { r.Tags = make([]string, 51) }),
+			[]models.FieldError{{Field: "tags", Code: "too_long", Message: "tags must have at most 50 entries"}}},
+		{"entry path", item(func(r *models.ItemRequest) { r.Tags = []string{"a", ""} }),
+			[]models.FieldError{{Field: "tags[1]", Code: "required", Message: "tags[1] is required"}}},
+		{"exact length", item(func(r *models.ItemRequest) { r.Currency = "EURO" }),
+			[]models.FieldError{{Field: "currency", Code: "invalid_length", Message: "currency must have exactly 3 characters"}}},
+		{"money too small", item(func(r *models.ItemRequest) { r.Price = mustMoney(t, "-0.01") }),
+			[]models.FieldError{{Field: "price", Code: "too_small", Message: "price must be at least 0"}}},
+		{"money too large", item(func(r *models.ItemRequest) { r.Price = mustMoney(t, "100000000000000") }),
+			[]models.FieldError{{Field: "price", Code: "too_large", Message: "price must be less than 100000000000000"}}},
+		{"decimal not greater", &models.ExchangeRate{Base: "EUR", Quote: "USD", Rate: decimal.Zero},
+			[]models.FieldError{{Field: "rate", Code: "too_small", Message: "rate must be greater than 0"}}},
+		{"email", user(func(r *models.UserRequest) { r.Email = "alice" }),
+			[]models.FieldError{{Field: "email", Code: "invalid_email", Message: "email must be a valid email address"}}},
+		{"username characters", user(func(r *models.UserRequest) { r.Username = "alice smith" }),
+			[]models.FieldError{{Field: "username", Code: "invalid_characters", Message: "username may only contain letters, digits, '.', '-' and '_'"}}},
+		{"oneof", &models.StockMovementRequest{Delta: 1, Reason: "theft"},
+			[]models.FieldError{{Field: "reason", Code: "invalid_choice", Message: "reason must be one of: receipt sale return adjustment"}}},
+		{"several fields", user(func(r *models.UserRequest) { r.Username, r.Password = "", "" }),
+			[]models.FieldError{
+				{Field: "username", Code: "required", Message: "username is required"},
+				{Field: "password", Code: "required", Message: "password is required"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Struct(tt.obj); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldErrorsIgnoresOtherErrors(t *testing.T) {
+	if fields := FieldErrors(os.ErrNotExist); fields != nil {
+		t.Errorf("FieldErrors(%v) = %+v, want nil", os.ErrNotExist, fields)
+	}
+}